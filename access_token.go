@@ -0,0 +1,259 @@
+package jwthelper
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+)
+
+// AccessToken is the JWT access token of RFC 9068 profile.
+// See https://www.rfc-editor.org/rfc/rfc9068#section-2.2
+type AccessToken struct {
+	// Issuer is "iss" claim.
+	Issuer string
+	// Subject is "sub" claim.
+	Subject string
+	// Audience is "aud" claim: resource indicators of the resource servers.
+	Audience []string
+	// ClientID is "client_id" claim.
+	ClientID string
+	// Expiry is "exp" claim.
+	Expiry time.Time
+	// IssuedAt is "iat" claim. It's set to now when signing if it's zero.
+	IssuedAt time.Time
+	// ID is "jti" claim. A random ID is set when signing if it's empty.
+	ID string
+	// Scope is "scope" claim. It's a space-delimited string in the token.
+	Scope []string
+	// AuthTime is "auth_time" claim. It's zero if absent.
+	AuthTime time.Time
+	// ACR is "acr" claim.
+	ACR string
+	// AMR is "amr" claim.
+	AMR []string
+	// Groups is "groups" claim(RFC 9068 section 2.2.3.1).
+	Groups []string
+	// Roles is "roles" claim.
+	Roles []string
+	// Entitlements is "entitlements" claim.
+	Entitlements []string
+	// Claims stores all claims including the claims above.
+	// Claims other than above ones are added when signing.
+	Claims Claims
+}
+
+// AccessTokenValidator validates JWT access tokens to RFC 9068 profile for a resource server.
+// It implements TokenParser and can be used with BearerMiddleware().
+// See https://www.rfc-editor.org/rfc/rfc9068#section-4
+type AccessTokenValidator struct {
+	parser   TokenParser
+	issuer   string
+	audience string
+}
+
+var (
+	// ErrInvalidAccessToken represents the error of access token which breaks RFC 9068 profile.
+	// The error of the rule is wrapped with it.
+	// e.g. ErrInvalidTokenType, ErrInvalidIssuer, ErrInvalidAudience, ErrClaimNotFound, ErrClaimType.
+	ErrInvalidAccessToken = fmt.Errorf("invalid access token")
+)
+
+// SignedAccessToken returns the signed string of the JWT access token(RFC 9068).
+//
+// t: access token. "iss", "sub", "aud", "client_id" and "exp" are required.
+// comments:
+// "typ" header parameter is "at+jwt".
+// "iat" and "jti" are set if they're absent.
+func (s *Signer) SignedAccessToken(t *AccessToken) (string, error) {
+	for name, v := range map[string]string{
+		"iss":       t.Issuer,
+		"sub":       t.Subject,
+		"client_id": t.ClientID,
+	} {
+		if v == "" {
+			return "", wrapError(ErrInvalidAccessToken, claimError(ErrClaimNotFound, name))
+		}
+	}
+	if len(t.Audience) == 0 {
+		return "", wrapError(ErrInvalidAccessToken, claimError(ErrClaimNotFound, "aud"))
+	}
+	if t.Expiry.IsZero() {
+		return "", wrapError(ErrInvalidAccessToken, claimError(ErrClaimNotFound, "exp"))
+	}
+
+	iat := t.IssuedAt
+	if iat.IsZero() {
+		iat = time.Now()
+	}
+	jti := t.ID
+	if jti == "" {
+		var err error
+		if jti, err = newJTI(); err != nil {
+			return "", err
+		}
+	}
+
+	claims := []Claim{}
+	for k, v := range t.Claims {
+		claims = append(claims, NewClaim(k, v))
+	}
+
+	var aud interface{} = t.Audience
+	if len(t.Audience) == 1 {
+		aud = t.Audience[0]
+	}
+
+	claims = append(claims,
+		NewHeader("typ", AccessTokenType),
+		NewClaim("iss", t.Issuer),
+		NewClaim("sub", t.Subject),
+		NewClaim("aud", aud),
+		NewClaim("client_id", t.ClientID),
+		TimeClaim("exp", t.Expiry),
+		TimeClaim("iat", iat),
+		NewClaim("jti", jti),
+	)
+
+	if len(t.Scope) > 0 {
+		claims = append(claims, NewClaim("scope", strings.Join(t.Scope, " ")))
+	}
+	if !t.AuthTime.IsZero() {
+		claims = append(claims, TimeClaim("auth_time", t.AuthTime))
+	}
+	if t.ACR != "" {
+		claims = append(claims, NewClaim("acr", t.ACR))
+	}
+	for name, v := range map[string][]string{
+		"amr":          t.AMR,
+		"groups":       t.Groups,
+		"roles":        t.Roles,
+		"entitlements": t.Entitlements,
+	} {
+		if len(v) > 0 {
+			claims = append(claims, NewClaim(name, v))
+		}
+	}
+
+	return s.SignedString(claims...)
+}
+
+// NewAccessTokenValidator creates a validator of JWT access tokens(RFC 9068).
+//
+// p: parser with the keys of the authorization server. e.g. Parser, JWKSParser.
+// issuer: issuer of the authorization server. "iss" claim must match it exactly.
+// audience: resource indicator of the resource server. "aud" claim must contain it.
+func NewAccessTokenValidator(p TokenParser, issuer, audience string) *AccessTokenValidator {
+	return &AccessTokenValidator{
+		parser:   p,
+		issuer:   issuer,
+		audience: audience,
+	}
+}
+
+// isAccessTokenType returns true if "typ" is "at+jwt" or "application/at+jwt".
+// Media types are case-insensitive.
+func isAccessTokenType(typ string) bool {
+	t, _, err := mime.ParseMediaType(typ)
+	if err != nil {
+		return false
+	}
+	return t == AccessTokenType || t == "application/"+AccessTokenType
+}
+
+// Validate validates the access token and returns the claims of RFC 9068 profile.
+//
+// comments:
+// The signature, "exp", "nbf" and "iat" are verified by the parser.
+// Errors of the parser are returned as is.
+// Other errors are wrapped with ErrInvalidAccessToken.
+// Use Policy to check scopes, groups, roles and entitlements.
+func (v *AccessTokenValidator) Validate(tokenString string) (*AccessToken, error) {
+	claims, err := v.parser.Parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// The header is authentic after the signature is verified.
+	header, err := ParseHeader(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if typ, _ := header["typ"].(string); !isAccessTokenType(typ) {
+		return nil, wrapError(ErrInvalidAccessToken, fmt.Errorf("%w: %q", ErrInvalidTokenType, typ))
+	}
+
+	c := Claims(claims)
+	t := &AccessToken{Claims: c}
+
+	// Required claims.
+	for name, dst := range map[string]*string{
+		"iss":       &t.Issuer,
+		"sub":       &t.Subject,
+		"client_id": &t.ClientID,
+		"jti":       &t.ID,
+	} {
+		if *dst, err = c.String(name); err != nil {
+			return nil, wrapError(ErrInvalidAccessToken, err)
+		}
+	}
+	if t.Audience, err = c.Audience(); err != nil {
+		return nil, wrapError(ErrInvalidAccessToken, err)
+	}
+	if t.Expiry, err = c.Time("exp"); err != nil {
+		return nil, wrapError(ErrInvalidAccessToken, err)
+	}
+	if t.IssuedAt, err = c.Time("iat"); err != nil {
+		return nil, wrapError(ErrInvalidAccessToken, err)
+	}
+
+	// Optional claims.
+	if c.Has("scope") {
+		// "scope" is a space-delimited string(RFC 8693 section 4.2).
+		scope, err := c.String("scope")
+		if err != nil {
+			return nil, wrapError(ErrInvalidAccessToken, err)
+		}
+		t.Scope = strings.Fields(scope)
+	}
+	if c.Has("auth_time") {
+		if t.AuthTime, err = c.Time("auth_time"); err != nil {
+			return nil, wrapError(ErrInvalidAccessToken, err)
+		}
+	}
+	if c.Has("acr") {
+		if t.ACR, err = c.String("acr"); err != nil {
+			return nil, wrapError(ErrInvalidAccessToken, err)
+		}
+	}
+	for name, dst := range map[string]*[]string{
+		"amr":          &t.AMR,
+		"groups":       &t.Groups,
+		"roles":        &t.Roles,
+		"entitlements": &t.Entitlements,
+	} {
+		if c.Has(name) {
+			if *dst, err = c.StringSlice(name); err != nil {
+				return nil, wrapError(ErrInvalidAccessToken, err)
+			}
+		}
+	}
+
+	if t.Issuer != v.issuer {
+		return nil, wrapError(ErrInvalidAccessToken, fmt.Errorf("%w: %q", ErrInvalidIssuer, t.Issuer))
+	}
+	if !contains(t.Audience, v.audience) {
+		return nil, wrapError(ErrInvalidAccessToken, fmt.Errorf("%w: %q", ErrInvalidAudience, t.Audience))
+	}
+	return t, nil
+}
+
+// Parse validates the access token and returns the claims.
+// It implements TokenParser.
+func (v *AccessTokenValidator) Parse(tokenString string) (map[string]interface{}, error) {
+	t, err := v.Validate(tokenString)
+	if err != nil {
+		return map[string]interface{}{}, err
+	}
+	return t.Claims, nil
+}
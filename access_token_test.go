@@ -0,0 +1,259 @@
+package jwthelper_test
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleAccessTokenValidator_Validate() {
+	// Authorization server.
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-1"))
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+
+	str, err := s.SignedAccessToken(&jwthelper.AccessToken{
+		Issuer:   "https://as.example.com",
+		Subject:  "frank",
+		Audience: []string{"https://api.example.com"},
+		ClientID: "client-1",
+		Expiry:   time.Now().Add(5 * time.Minute),
+		Scope:    []string{"read", "write"},
+		Roles:    []string{"admin"},
+	})
+	if err != nil {
+		log.Printf("SignedAccessToken() error: %v", err)
+		return
+	}
+
+	// Resource server.
+	p, err := jwthelper.NewJWKSParser([]byte(testJWKS))
+	if err != nil {
+		log.Printf("NewJWKSParser() error: %v", err)
+		return
+	}
+	v := jwthelper.NewAccessTokenValidator(p, "https://as.example.com", "https://api.example.com")
+
+	t, err := v.Validate(str)
+	if err != nil {
+		log.Printf("Validate() error: %v", err)
+		return
+	}
+	fmt.Println(t.Subject, t.ClientID, t.Scope, t.Roles)
+
+	// Output:
+	// frank client-1 [read write] [admin]
+}
+
+func TestAccessTokenValidator(t *testing.T) {
+	const (
+		issuer   = "https://as.example.com"
+		audience = "https://api.example.com"
+	)
+
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-1"))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	p, err := jwthelper.NewJWKSParser([]byte(testJWKS))
+	if err != nil {
+		t.Fatalf("NewJWKSParser() error: %v", err)
+	}
+	v := jwthelper.NewAccessTokenValidator(p, issuer, audience)
+
+	now := time.Now()
+
+	// sign signs the access token with the claims overridden by claims.
+	// Claims with nil value are removed.
+	sign := func(typ interface{}, claims map[string]interface{}) string {
+		m := map[string]interface{}{
+			"iss":          issuer,
+			"sub":          "frank",
+			"aud":          []string{audience, "https://other.example.com"},
+			"client_id":    "client-1",
+			"exp":          now.Add(time.Hour).Unix(),
+			"iat":          now.Unix(),
+			"jti":          "jti-1",
+			"scope":        "read write",
+			"auth_time":    now.Add(-time.Minute).Unix(),
+			"acr":          "1",
+			"amr":          []string{"pwd"},
+			"groups":       []string{"dev"},
+			"roles":        "admin",
+			"entitlements": []string{"beta"},
+		}
+		for k, v := range claims {
+			if v == nil {
+				delete(m, k)
+				continue
+			}
+			m[k] = v
+		}
+
+		c := []jwthelper.Claim{jwthelper.NewHeader("typ", typ)}
+		for k, v := range m {
+			c = append(c, jwthelper.NewClaim(k, v))
+		}
+		str, err := s.SignedString(c...)
+		if err != nil {
+			t.Fatalf("SignedString() error: %v", err)
+		}
+		return str
+	}
+
+	tests := []struct {
+		name   string
+		typ    interface{}
+		claims map[string]interface{}
+		err    error
+	}{
+		{"valid", "at+jwt", nil, nil},
+		{"media type", "application/AT+JWT", nil, nil},
+		{"single audience", "at+jwt", map[string]interface{}{"aud": audience}, nil},
+		{"no optional claims", "at+jwt", map[string]interface{}{"scope": nil, "auth_time": nil, "acr": nil, "amr": nil, "groups": nil, "roles": nil, "entitlements": nil}, nil},
+		{"typ JWT", "JWT", nil, jwthelper.ErrInvalidTokenType},
+		{"typ rt+jwt", "rt+jwt", nil, jwthelper.ErrInvalidTokenType},
+		{"typ not string", 1, nil, jwthelper.ErrInvalidTokenType},
+		{"other issuer", "at+jwt", map[string]interface{}{"iss": "https://evil.example.com"}, jwthelper.ErrInvalidIssuer},
+		{"other audience", "at+jwt", map[string]interface{}{"aud": "https://other.example.com"}, jwthelper.ErrInvalidAudience},
+		{"no iss", "at+jwt", map[string]interface{}{"iss": nil}, jwthelper.ErrClaimNotFound},
+		{"no sub", "at+jwt", map[string]interface{}{"sub": nil}, jwthelper.ErrClaimNotFound},
+		{"no aud", "at+jwt", map[string]interface{}{"aud": nil}, jwthelper.ErrClaimNotFound},
+		{"no client_id", "at+jwt", map[string]interface{}{"client_id": nil}, jwthelper.ErrClaimNotFound},
+		{"no exp", "at+jwt", map[string]interface{}{"exp": nil}, jwthelper.ErrClaimNotFound},
+		{"no iat", "at+jwt", map[string]interface{}{"iat": nil}, jwthelper.ErrClaimNotFound},
+		{"no jti", "at+jwt", map[string]interface{}{"jti": nil}, jwthelper.ErrClaimNotFound},
+		{"scope array", "at+jwt", map[string]interface{}{"scope": []string{"read"}}, jwthelper.ErrClaimType},
+		{"groups not strings", "at+jwt", map[string]interface{}{"groups": []int{1}}, jwthelper.ErrClaimType},
+		{"expired", "at+jwt", map[string]interface{}{"exp": now.Add(-time.Minute).Unix()}, jwthelper.ErrTokenExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := v.Validate(sign(tt.typ, tt.claims))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Validate() error: %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if tt.err != jwthelper.ErrTokenExpired && !errors.Is(err, jwthelper.ErrInvalidAccessToken) {
+					t.Errorf("Validate() error: %v, want %v", err, jwthelper.ErrInvalidAccessToken)
+				}
+				return
+			}
+			if token.Issuer != issuer || token.Subject != "frank" || token.ClientID != "client-1" || token.ID != "jti-1" {
+				t.Errorf("access token = %+v", token)
+			}
+		})
+	}
+
+	token, err := v.Validate(sign("at+jwt", nil))
+	if err != nil {
+		t.Fatalf("Validate() error: %v", err)
+	}
+	if len(token.Scope) != 2 || token.ACR != "1" || len(token.AMR) != 1 || token.AuthTime.IsZero() ||
+		token.Groups[0] != "dev" || token.Roles[0] != "admin" || token.Entitlements[0] != "beta" {
+		t.Errorf("access token = %+v", token)
+	}
+}
+
+func TestSignedAccessToken(t *testing.T) {
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-1"))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	p, err := jwthelper.NewJWKSParser([]byte(testJWKS))
+	if err != nil {
+		t.Fatalf("NewJWKSParser() error: %v", err)
+	}
+	v := jwthelper.NewAccessTokenValidator(p, "https://as.example.com", "https://api.example.com")
+
+	newToken := func() *jwthelper.AccessToken {
+		return &jwthelper.AccessToken{
+			Issuer:   "https://as.example.com",
+			Subject:  "frank",
+			Audience: []string{"https://api.example.com"},
+			ClientID: "client-1",
+			Expiry:   time.Now().Add(time.Minute),
+			Claims:   jwthelper.Claims{"tenant": "t-1", "iss": "https://evil.example.com"},
+		}
+	}
+
+	str, err := s.SignedAccessToken(newToken())
+	if err != nil {
+		t.Fatalf("SignedAccessToken() error: %v", err)
+	}
+	header, _ := jwthelper.ParseHeader(str)
+	if header["typ"] != jwthelper.AccessTokenType {
+		t.Errorf("typ = %v, want %v", header["typ"], jwthelper.AccessTokenType)
+	}
+
+	token, err := v.Validate(str)
+	if err != nil {
+		t.Fatalf("Validate() error: %v", err)
+	}
+	if token.ID == "" || token.IssuedAt.IsZero() || token.Scope != nil || token.Claims["tenant"] != "t-1" || token.Issuer != "https://as.example.com" {
+		t.Errorf("access token = %+v", token)
+	}
+	if _, ok := token.Claims["aud"].(string); !ok {
+		t.Errorf("single audience = %v, want string", token.Claims["aud"])
+	}
+
+	// Required claims.
+	for name, f := range map[string]func(t *jwthelper.AccessToken){
+		"iss":       func(t *jwthelper.AccessToken) { t.Issuer = "" },
+		"sub":       func(t *jwthelper.AccessToken) { t.Subject = "" },
+		"aud":       func(t *jwthelper.AccessToken) { t.Audience = nil },
+		"client_id": func(t *jwthelper.AccessToken) { t.ClientID = "" },
+		"exp":       func(t *jwthelper.AccessToken) { t.Expiry = time.Time{} },
+	} {
+		token := newToken()
+		f(token)
+		if _, err = s.SignedAccessToken(token); !errors.Is(err, jwthelper.ErrClaimNotFound) || !errors.Is(err, jwthelper.ErrInvalidAccessToken) {
+			t.Errorf("SignedAccessToken() without %v error: %v, want %v", name, err, jwthelper.ErrClaimNotFound)
+		}
+	}
+
+	// The validator works with BearerMiddleware.
+	h := jwthelper.BearerMiddleware(v)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := jwthelper.ClaimsFromContext(r.Context())
+		fmt.Fprint(w, claims["sub"])
+	}))
+
+	// ID Tokens and other JWTs are not access tokens.
+	jwt, err := s.SignedString(
+		jwthelper.NewClaim("iss", "https://as.example.com"),
+		jwthelper.NewClaim("sub", "frank"),
+		jwthelper.NewClaim("aud", "https://api.example.com"),
+		jwthelper.NewClaim("client_id", "client-1"),
+		jwthelper.NewClaim("jti", "jti-1"),
+		jwthelper.TimeClaim("iat", time.Now()),
+		jwthelper.TimeClaim("exp", time.Now().Add(time.Minute)),
+	)
+	if err != nil {
+		t.Fatalf("SignedString() error: %v", err)
+	}
+
+	for _, tt := range []struct {
+		token  string
+		status int
+	}{
+		{str, http.StatusOK},
+		{jwt, http.StatusUnauthorized},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+tt.token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("status = %v, want %v", w.Code, tt.status)
+		}
+	}
+}
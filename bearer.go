@@ -0,0 +1,110 @@
+package jwthelper
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TokenParser parses and verifies JWT token strings.
+// It's implemented by Parser and MultipleKeysParser.
+type TokenParser interface {
+	Parse(tokenString string) (map[string]interface{}, error)
+}
+
+var (
+	// ErrNoBearerToken represents the error of no bearer token in the request.
+	ErrNoBearerToken = fmt.Errorf("no bearer token in request")
+)
+
+// BearerToken returns the bearer token in "Authorization" header of the request.
+// See https://tools.ietf.org/html/rfc6750#section-2.1
+func BearerToken(r *http.Request) (string, error) {
+	token, ok := authToken(r, "Bearer")
+	if !ok {
+		return "", ErrNoBearerToken
+	}
+	return token, nil
+}
+
+// authToken returns the token of the authentication scheme in "Authorization" header.
+// The scheme is case-insensitive.
+func authToken(r *http.Request, scheme string) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	n := len(scheme) + 1
+	if len(auth) < n || !strings.EqualFold(auth[:n], scheme+" ") {
+		return "", false
+	}
+
+	token := strings.TrimSpace(auth[n:])
+	if token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// bearerError responds the error with "WWW-Authenticate" header.
+// See https://tools.ietf.org/html/rfc6750#section-3
+func bearerError(w http.ResponseWriter, status int, code, scope string) {
+	challenge := "Bearer"
+	if code != "" {
+		challenge += fmt.Sprintf(` error="%s"`, code)
+	}
+	if scope != "" {
+		challenge += fmt.Sprintf(`, scope="%s"`, scope)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, http.StatusText(status), status)
+}
+
+// CheckBearerToken checks the verified token which is presented as a bearer token.
+// Refresh tokens, stream tickets and DPoP-bound tokens are rejected with ErrInvalidTokenType.
+//
+// tokenString: the token string which is verified by the parser.
+// claims: the claims returned by the parser.
+// comments:
+// Parsers don't check the token type, so call it after Parse() when accepting bearer tokens
+// outside of BearerMiddleware(). e.g. gRPC interceptors.
+func CheckBearerToken(tokenString string, claims map[string]interface{}) error {
+	header, err := ParseHeader(tokenString)
+	if err != nil {
+		return err
+	}
+	if typ, _ := header["typ"].(string); typ == RefreshTokenType || typ == StreamTicketType {
+		return fmt.Errorf("%w: %q", ErrInvalidTokenType, typ)
+	}
+	// DPoP-bound tokens must not be used as bearer tokens(RFC 9449 section 7.2).
+	if _, ok := confirmationJKT(claims); ok {
+		return fmt.Errorf("%w: DPoP-bound token", ErrInvalidTokenType)
+	}
+	return nil
+}
+
+// BearerMiddleware returns the middleware which verifies the bearer token with the parser
+// and stores the claims in the request context before calling next.
+// Use ClaimsFromContext() to get the claims.
+// It responds 401 with "WWW-Authenticate" header(RFC 6750) if the token is missing or invalid.
+// Refresh tokens("typ" is RefreshTokenType) are rejected because they may be signed by the same key.
+// Tokens bound to a DPoP key("cnf" claim with "jkt") are rejected. Use DPoPMiddleware() for them.
+func BearerMiddleware(p TokenParser) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := BearerToken(r)
+			if err != nil {
+				bearerError(w, http.StatusUnauthorized, "", "")
+				return
+			}
+
+			claims, err := p.Parse(token)
+			if err != nil {
+				bearerError(w, http.StatusUnauthorized, "invalid_token", "")
+				return
+			}
+			if err = CheckBearerToken(token, claims); err != nil {
+				bearerError(w, http.StatusUnauthorized, "invalid_token", "")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+		})
+	}
+}
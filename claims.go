@@ -1,17 +1,17 @@
 package jwthelper
 
 import (
+	"encoding/json"
 	"sync"
 	"time"
-
-	"github.com/dgrijalva/jwt-go"
 )
 
 // claims stores JWT claims.
-// it contains a jwt.MapClaims.
+// it contains a claims map and extra JOSE header parameters.
 type claims struct {
 	m      sync.Mutex
-	claims jwt.MapClaims
+	claims map[string]interface{}
+	header map[string]interface{}
 }
 
 // Claim represents JWT claim.
@@ -26,6 +26,7 @@ func newClaims() claims {
 	return claims{
 		sync.Mutex{},
 		map[string]interface{}{},
+		map[string]interface{}{},
 	}
 }
 
@@ -38,8 +39,72 @@ func NewClaim(name string, value interface{}) Claim {
 	}}
 }
 
+// NewHeader returns a Claim which sets the JOSE header parameter instead of a claim.
+// e.g. NewHeader("typ", "at+jwt"), NewHeader("kid", "key-1").
+// "alg" header parameter can not be overridden.
+func NewHeader(name string, value interface{}) Claim {
+	return Claim{func(c *claims) {
+		c.m.Lock()
+		defer c.m.Unlock()
+		c.header[name] = value
+	}}
+}
+
 // TimeClaim returns a Claim with time.Time value.
 // It'll convert the time.Time to a Unix timestamp.
 func TimeClaim(name string, value time.Time) Claim {
 	return NewClaim(name, value.Unix())
 }
+
+// numericDate converts a NumericDate claim value to time.Time.
+// The value may be json.Number or float64 depending on ParserUseJSONNumber option.
+func numericDate(v interface{}) (time.Time, bool) {
+	var f float64
+	switch n := v.(type) {
+	case json.Number:
+		var err error
+		if f, err = n.Float64(); err != nil {
+			return time.Time{}, false
+		}
+	case float64:
+		f = n
+	case int64:
+		f = float64(n)
+	case int:
+		f = float64(n)
+	default:
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+// stringList returns the values of a string-or-array claim.
+// e.g. "aud" may be a single string or an array of strings.
+func stringList(v interface{}) []string {
+	switch a := v.(type) {
+	case string:
+		return []string{a}
+	case []string:
+		return a
+	case []interface{}:
+		auds := []string{}
+		for _, e := range a {
+			if s, ok := e.(string); ok {
+				auds = append(auds, s)
+			}
+		}
+		return auds
+	default:
+		return nil
+	}
+}
+
+// hasAudience returns true if "aud" claim contains the audience.
+func hasAudience(claims map[string]interface{}, aud string) bool {
+	for _, a := range stringList(claims["aud"]) {
+		if a == aud {
+			return true
+		}
+	}
+	return false
+}
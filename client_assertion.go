@@ -0,0 +1,298 @@
+package jwthelper
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ClientAssertionType is "client_assertion_type" of JWT client assertions.
+// See https://www.rfc-editor.org/rfc/rfc7523#section-2.2
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// ClientAssertionBuilder builds JWT client assertions(RFC 7523 / OIDC "private_key_jwt")
+// to authenticate the client to token endpoints.
+type ClientAssertionBuilder struct {
+	clientID string
+	sign     func(claims ...Claim) (string, error)
+	ttl      time.Duration
+}
+
+// ClientKeys looks up the parser with the keys of a client.
+// e.g. a parser with the JWK Set registered by the client.
+type ClientKeys interface {
+	// ClientParser returns the parser of the client.
+	// It returns ErrUnknownClient if the client is not registered.
+	ClientParser(clientID string) (TokenParser, error)
+}
+
+// ClientParsers is a ClientKeys which maps "client_id" to the parser.
+// The parser may be a Parser, MultipleKeysParser or JWKSParser.
+type ClientParsers map[string]TokenParser
+
+// ClientAssertionVerifier verifies JWT client assertions at the authorization server.
+// It's safe for concurrent use if the ClientKeys is.
+type ClientAssertionVerifier struct {
+	keys        ClientKeys
+	audiences   []string
+	seen        SeenStore
+	maxLifetime time.Duration
+}
+
+// ClientAssertionOption represents the option for building or verifying client assertions.
+// Use option helper functions to set options:
+// e.g. ClientAssertionTTL(), ClientAssertionReplayStore()
+type ClientAssertionOption struct {
+	f func(o *clientAssertionOptions)
+}
+
+// clientAssertionOptions stores the options for client assertions.
+type clientAssertionOptions struct {
+	ttl         time.Duration
+	seen        SeenStore
+	maxLifetime time.Duration
+}
+
+var (
+	// ErrInvalidClientAssertion represents the error of invalid client assertion.
+	// The error of the rule is wrapped with it.
+	// e.g. ErrInvalidAudience, ErrClaimNotFound, ErrTokenReplayed, ErrClientMismatch.
+	ErrInvalidClientAssertion = fmt.Errorf("invalid client assertion")
+	// ErrUnknownClient represents the error of client which is not registered.
+	ErrUnknownClient = fmt.Errorf("unknown client")
+	// ErrClientMismatch represents the error of "iss", "sub" and "client_id" which are not the same client.
+	// It's wrapped with ErrInvalidClientAssertion.
+	ErrClientMismatch = fmt.Errorf("client mismatch")
+	// ErrLifetimeTooLong represents the error of "exp" which is too far in the future.
+	// It's wrapped with ErrInvalidClientAssertion.
+	ErrLifetimeTooLong = fmt.Errorf("lifetime is too long")
+)
+
+// ClientAssertionTTL returns the option for the lifetime of built assertions.
+// It's 1 minute by default.
+func ClientAssertionTTL(ttl time.Duration) ClientAssertionOption {
+	return ClientAssertionOption{func(o *clientAssertionOptions) {
+		o.ttl = ttl
+	}}
+}
+
+// ClientAssertionReplayStore returns the option for the seen store of "jti".
+// A MemorySeenStore is used by default. Use a shared store for multiple instances.
+func ClientAssertionReplayStore(store SeenStore) ClientAssertionOption {
+	return ClientAssertionOption{func(o *clientAssertionOptions) {
+		o.seen = store
+	}}
+}
+
+// ClientAssertionMaxLifetime returns the option for the max lifetime of verified assertions.
+// Assertions which "exp" is later than now + max lifetime are rejected,
+// so that "jti" is not recorded for too long. It's 5 minutes by default.
+func ClientAssertionMaxLifetime(d time.Duration) ClientAssertionOption {
+	return ClientAssertionOption{func(o *clientAssertionOptions) {
+		o.maxLifetime = d
+	}}
+}
+
+// newClientAssertionOptions returns the options with default values.
+func newClientAssertionOptions(options []ClientAssertionOption) clientAssertionOptions {
+	o := clientAssertionOptions{
+		ttl:         time.Minute,
+		maxLifetime: 5 * time.Minute,
+	}
+	for _, op := range options {
+		op.f(&o)
+	}
+	return o
+}
+
+// NewClientAssertionBuilder creates a client assertion builder with given signer.
+//
+// clientID: "client_id" of the client. It's "iss" and "sub" of the assertions.
+// s: signer with the private key of the client.
+// options: variadic options returned by option helper functions.
+// e.g. ClientAssertionTTL(30 * time.Second)
+func NewClientAssertionBuilder(clientID string, s *Signer, options ...ClientAssertionOption) *ClientAssertionBuilder {
+	o := newClientAssertionOptions(options)
+	return &ClientAssertionBuilder{
+		clientID: clientID,
+		sign:     s.SignedString,
+		ttl:      o.ttl,
+	}
+}
+
+// NewClientAssertionBuilderWithKeys creates a client assertion builder which signs with the signer of the "kid".
+//
+// clientID: "client_id" of the client.
+// s: multiple keys signer with the private keys of the client.
+// kid: "kid" of the signer. e.g. the current key in the JWK Set registered by the client.
+func NewClientAssertionBuilderWithKeys(clientID string, s *MultipleKeysSigner, kid string, options ...ClientAssertionOption) *ClientAssertionBuilder {
+	o := newClientAssertionOptions(options)
+	return &ClientAssertionBuilder{
+		clientID: clientID,
+		sign: func(claims ...Claim) (string, error) {
+			return s.SignedString(kid, claims...)
+		},
+		ttl: o.ttl,
+	}
+}
+
+// Assertion returns a signed client assertion.
+//
+// audience: URL of the token endpoint(or the issuer identifier of the authorization server).
+// comments:
+// "iss" and "sub" are the client. "jti" is random and "exp" is now + TTL.
+// See https://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication
+func (b *ClientAssertionBuilder) Assertion(audience string) (string, error) {
+	jti, err := newJTI()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	return b.sign(
+		NewClaim("iss", b.clientID),
+		NewClaim("sub", b.clientID),
+		NewClaim("aud", audience),
+		NewClaim("jti", jti),
+		TimeClaim("iat", now),
+		TimeClaim("exp", now.Add(b.ttl)),
+	)
+}
+
+// FormValues returns the form parameters of the token request to authenticate the client:
+// "client_id", "client_assertion_type" and "client_assertion".
+// Add other parameters of the request. e.g. "grant_type".
+func (b *ClientAssertionBuilder) FormValues(audience string) (url.Values, error) {
+	assertion, err := b.Assertion(audience)
+	if err != nil {
+		return nil, err
+	}
+	return url.Values{
+		"client_id":             {b.clientID},
+		"client_assertion_type": {ClientAssertionType},
+		"client_assertion":      {assertion},
+	}, nil
+}
+
+// ClientParser implements ClientKeys interface.
+func (m ClientParsers) ClientParser(clientID string) (TokenParser, error) {
+	p, ok := m[clientID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownClient, clientID)
+	}
+	return p, nil
+}
+
+// NewClientAssertionVerifier creates a client assertion verifier.
+//
+// keys: parsers of the registered clients. e.g. ClientParsers.
+// audiences: URL of the token endpoint and the issuer identifier. "aud" claim must contain one of them.
+// options: variadic options returned by option helper functions.
+// e.g. ClientAssertionReplayStore(), ClientAssertionMaxLifetime()
+func NewClientAssertionVerifier(keys ClientKeys, audiences []string, options ...ClientAssertionOption) *ClientAssertionVerifier {
+	o := newClientAssertionOptions(options)
+	if o.seen == nil {
+		o.seen = NewMemorySeenStore()
+	}
+	return &ClientAssertionVerifier{
+		keys:        keys,
+		audiences:   audiences,
+		seen:        o.seen,
+		maxLifetime: o.maxLifetime,
+	}
+}
+
+// invalidAssertion returns the error wrapped with ErrInvalidClientAssertion.
+func invalidAssertion(err error) error {
+	return wrapError(ErrInvalidClientAssertion, err)
+}
+
+// Verify verifies the client assertion and returns the authenticated "client_id".
+//
+// assertion: "client_assertion" parameter.
+// clientID: "client_id" parameter. It may be empty because it's optional.
+// comments:
+// The parser of the client is selected by the unverified "sub" claim.
+// Each assertion("jti") is accepted only once.
+// Errors of the parser are returned as is.
+func (v *ClientAssertionVerifier) Verify(assertion, clientID string) (string, error) {
+	unverified, err := ParseClaims(assertion)
+	if err != nil {
+		return "", err
+	}
+	sub, _ := unverified["sub"].(string)
+	if sub == "" {
+		return "", invalidAssertion(claimError(ErrClaimNotFound, "sub"))
+	}
+	if clientID != "" && sub != clientID {
+		return "", invalidAssertion(fmt.Errorf("%w: sub %q is not %q", ErrClientMismatch, sub, clientID))
+	}
+
+	p, err := v.keys.ClientParser(sub)
+	if err != nil {
+		return "", err
+	}
+	claims, err := p.Parse(assertion)
+	if err != nil {
+		return "", err
+	}
+
+	c := Claims(claims)
+	for _, name := range []string{"iss", "sub"} {
+		s, err := c.String(name)
+		if err != nil {
+			return "", invalidAssertion(err)
+		}
+		if s != sub {
+			return "", invalidAssertion(fmt.Errorf("%w: %v %q is not %q", ErrClientMismatch, name, s, sub))
+		}
+	}
+
+	aud, err := c.Audience()
+	if err != nil {
+		return "", invalidAssertion(err)
+	}
+	ok := false
+	for _, a := range v.audiences {
+		ok = ok || contains(aud, a)
+	}
+	if !ok {
+		return "", invalidAssertion(fmt.Errorf("%w: %q", ErrInvalidAudience, aud))
+	}
+
+	jti, err := c.String("jti")
+	if err != nil {
+		return "", invalidAssertion(err)
+	}
+	exp, err := c.Time("exp")
+	if err != nil {
+		return "", invalidAssertion(err)
+	}
+	if exp.After(time.Now().Add(v.maxLifetime)) {
+		return "", invalidAssertion(ErrLifetimeTooLong)
+	}
+
+	// Record "jti" at last so that rejected assertions are not recorded.
+	seen, err := v.seen.Seen(sub+":"+jti, exp)
+	if err != nil {
+		return "", err
+	}
+	if seen {
+		return "", invalidAssertion(ErrTokenReplayed)
+	}
+	return sub, nil
+}
+
+// VerifyRequest verifies the client assertion in the form parameters of the token request.
+// It returns the authenticated "client_id".
+// The request body is parsed by r.ParseForm().
+func (v *ClientAssertionVerifier) VerifyRequest(r *http.Request) (string, error) {
+	if err := r.ParseForm(); err != nil {
+		return "", err
+	}
+	if r.PostForm.Get("client_assertion_type") != ClientAssertionType {
+		return "", invalidAssertion(fmt.Errorf("client_assertion_type %q is not %q", r.PostForm.Get("client_assertion_type"), ClientAssertionType))
+	}
+	return v.Verify(r.PostForm.Get("client_assertion"), r.PostForm.Get("client_id"))
+}
@@ -0,0 +1,173 @@
+package jwthelper_test
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleClientAssertionBuilder_FormValues() {
+	const tokenEndpoint = "https://as.example.com/token"
+
+	// Client signs the assertion with its private key.
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-1"))
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+	b := jwthelper.NewClientAssertionBuilder("client-1", s)
+
+	form, err := b.FormValues(tokenEndpoint)
+	if err != nil {
+		log.Printf("FormValues() error: %v", err)
+		return
+	}
+	form.Set("grant_type", "client_credentials")
+
+	// Authorization server verifies the assertion with the JWK Set registered by the client.
+	p, err := jwthelper.NewJWKSParser([]byte(testJWKS))
+	if err != nil {
+		log.Printf("NewJWKSParser() error: %v", err)
+		return
+	}
+	v := jwthelper.NewClientAssertionVerifier(jwthelper.ClientParsers{"client-1": p}, []string{tokenEndpoint})
+
+	r := httptest.NewRequest("POST", tokenEndpoint, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	clientID, err := v.VerifyRequest(r)
+	fmt.Println(clientID, err)
+
+	// Each assertion is accepted only once.
+	_, err = v.Verify(form.Get("client_assertion"), "client-1")
+	fmt.Println(errors.Is(err, jwthelper.ErrTokenReplayed))
+
+	// Output:
+	// client-1 <nil>
+	// true
+}
+
+func TestClientAssertionVerifier(t *testing.T) {
+	const (
+		issuer        = "https://as.example.com"
+		tokenEndpoint = "https://as.example.com/token"
+	)
+
+	// client-1 registers a JWK Set and client-2 registers keys with "kid".
+	jwksParser, err := jwthelper.NewJWKSParser([]byte(testJWKS))
+	if err != nil {
+		t.Fatalf("NewJWKSParser() error: %v", err)
+	}
+	apiParser, err := jwthelper.NewParserFromFile("RS384", "keys/rsa-pub-api.pem")
+	if err != nil {
+		t.Fatalf("NewParserFromFile() error: %v", err)
+	}
+	mp := jwthelper.NewMultipleKeysParser()
+	mp.Set("kid-api", apiParser)
+
+	v := jwthelper.NewClientAssertionVerifier(jwthelper.ClientParsers{
+		"client-1": jwksParser,
+		"client-2": mp,
+	}, []string{tokenEndpoint, issuer})
+
+	s1, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-1"))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	s2, err := jwthelper.NewSignerFromFile("RS384", "keys/rsa-priv-api.pem")
+	if err != nil {
+		t.Fatalf("NewSignerFromFile() error: %v", err)
+	}
+	ms := jwthelper.NewMultipleKeysSigner()
+	ms.Set("kid-api", s2)
+
+	b1 := jwthelper.NewClientAssertionBuilder("client-1", s1)
+	b2 := jwthelper.NewClientAssertionBuilderWithKeys("client-2", ms, "kid-api", jwthelper.ClientAssertionTTL(30*time.Second))
+
+	assertion := func(b *jwthelper.ClientAssertionBuilder, aud string) string {
+		str, err := b.Assertion(aud)
+		if err != nil {
+			t.Fatalf("Assertion() error: %v", err)
+		}
+		return str
+	}
+
+	// sign signs an assertion of client-1 with the claims overridden.
+	// Claims with nil value are removed.
+	now := time.Now()
+	sign := func(claims map[string]interface{}) string {
+		m := map[string]interface{}{
+			"iss": "client-1",
+			"sub": "client-1",
+			"aud": tokenEndpoint,
+			"jti": fmt.Sprintf("jti-%v", time.Now().UnixNano()),
+			"exp": now.Add(time.Minute).Unix(),
+		}
+		for k, v := range claims {
+			m[k] = v
+		}
+		c := []jwthelper.Claim{}
+		for k, v := range m {
+			if v != nil {
+				c = append(c, jwthelper.NewClaim(k, v))
+			}
+		}
+		str, err := s1.SignedString(c...)
+		if err != nil {
+			t.Fatalf("SignedString() error: %v", err)
+		}
+		return str
+	}
+
+	replayed := assertion(b1, tokenEndpoint)
+	if _, err = v.Verify(replayed, ""); err != nil {
+		t.Fatalf("Verify() error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		assertion string
+		clientID  string
+		want      string
+		err       error
+	}{
+		{"signer", assertion(b1, tokenEndpoint), "client-1", "client-1", nil},
+		{"multiple keys signer", assertion(b2, tokenEndpoint), "client-2", "client-2", nil},
+		{"issuer as audience", assertion(b1, issuer), "", "client-1", nil},
+		{"replayed", replayed, "client-1", "", jwthelper.ErrTokenReplayed},
+		{"other audience", assertion(b1, "https://other.example.com/token"), "client-1", "", jwthelper.ErrInvalidAudience},
+		{"client_id mismatch", assertion(b1, tokenEndpoint), "client-2", "", jwthelper.ErrClientMismatch},
+		{"iss is not sub", sign(map[string]interface{}{"iss": "client-2"}), "", "", jwthelper.ErrClientMismatch},
+		{"unknown client", sign(map[string]interface{}{"iss": "client-3", "sub": "client-3"}), "", "", jwthelper.ErrUnknownClient},
+		{"key of other client", assertion(jwthelper.NewClientAssertionBuilder("client-2", s1), tokenEndpoint), "", "", jwthelper.ErrUnknownKID},
+		{"no sub", sign(map[string]interface{}{"sub": nil}), "", "", jwthelper.ErrClaimNotFound},
+		{"no jti", sign(map[string]interface{}{"jti": nil}), "", "", jwthelper.ErrClaimNotFound},
+		{"no exp", sign(map[string]interface{}{"exp": nil}), "", "", jwthelper.ErrClaimNotFound},
+		{"expired", sign(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()}), "", "", jwthelper.ErrTokenExpired},
+		{"lifetime too long", sign(map[string]interface{}{"exp": now.Add(time.Hour).Unix()}), "", "", jwthelper.ErrLifetimeTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientID, err := v.Verify(tt.assertion, tt.clientID)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Verify() error: %v, want %v", err, tt.err)
+			}
+			if clientID != tt.want {
+				t.Errorf("Verify() = %v, want %v", clientID, tt.want)
+			}
+		})
+	}
+
+	// client_assertion_type is required.
+	r := httptest.NewRequest("POST", tokenEndpoint, strings.NewReader("client_assertion="+assertion(b1, tokenEndpoint)))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if _, err = v.VerifyRequest(r); !errors.Is(err, jwthelper.ErrInvalidClientAssertion) {
+		t.Errorf("VerifyRequest() error: %v, want %v", err, jwthelper.ErrInvalidClientAssertion)
+	}
+}
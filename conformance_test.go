@@ -0,0 +1,430 @@
+package jwthelper_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/northbright/jwthelper"
+)
+
+// Conformance vectors come from RFC 7515 appendix A, RFC 7519 section 3.1,
+// RFC 7520 section 4(JOSE cookbook) and RFC 8037 appendix A.
+
+var b64 = base64.RawURLEncoding
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := b64.DecodeString(s)
+	if err != nil {
+		t.Fatalf("DecodeString(%q) error: %v", s, err)
+	}
+	return b
+}
+
+func bigInt(t *testing.T, s string) *big.Int {
+	return new(big.Int).SetBytes(mustDecode(t, s))
+}
+
+// keyPEMs returns PKCS #8 private key PEM and PKIX public key PEM.
+func keyPEMs(t *testing.T, priv crypto.Signer) ([]byte, []byte) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() error: %v", err)
+	}
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	if der, err = x509.MarshalPKIXPublicKey(priv.Public()); err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() error: %v", err)
+	}
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	return privPEM, pubPEM
+}
+
+// vectorKeys stores the keys of the test vectors in PEM.
+type vectorKeys struct {
+	rsaPriv, rsaPub     []byte // RFC 7515 A.2.
+	es256Priv, es256Pub []byte // RFC 7515 A.3.
+	es512Priv, es512Pub []byte // RFC 7515 A.4.
+	es512Cookbook       []byte // RFC 7520 section 3.2, public only.
+	edPriv, edPub       []byte // RFC 8037 A.1.
+}
+
+func newVectorKeys(t *testing.T) *vectorKeys {
+	k := &vectorKeys{}
+
+	rsaKey := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{
+			N: bigInt(t, "ofgWCuLjybRlzo0tZWJjNiuSfb4p4fAkd_wWJcyQoTbji9k0l8W26mPddxHmfHQp-Vaw-4qPCJrcS2mJPMEzP1Pt0Bm4d4QlL-yRT-SFd2lZS-pCgNMsD1W_YpRPEwOWvG6b32690r2jZ47soMZo9wGzjb_7OMg0LOL-bSf63kpaSHSXndS5z5rexMdbBYUsLA9e-KXBdQOS-UTo7WTBEMa2R2CapHg665xsmtdVMTBQY4uDZlxvb3qCo5ZwKh9kG4LT6_I5IhlJH7aGhyxXFvUK-DWNmoudF8NAco9_h9iaGNj8q2ethFkMLs91kzk2PAcDTW9gb54h4FRWyuXpoQ"),
+			E: 65537,
+		},
+		D: bigInt(t, "Eq5xpGnNCivDflJsRQBXHx1hdR1k6Ulwe2JZD50LpXyWPEAeP88vLNO97IjlA7_GQ5sLKMgvfTeXZx9SE-7YwVol2NXOoAJe46sui395IW_GO-pWJ1O0BkTGoVEn2bKVRUCgu-GjBVaYLU6f3l9kJfFNS3E0QbVdxzubSu3Mkqzjkn439X0M_V51gfpRLI9JYanrC4D4qAdGcopV_0ZHHzQlBjudU2QvXt4ehNYTCBr6XCLQUShb1juUO1ZdiYoFaFQT5Tw8bGUl_x_jTj3ccPDVZFD9pIuhLhBOneufuBiB4cS98l2SR_RQyGWSeWjnczT0QU91p1DhOVRuOopznQ"),
+		Primes: []*big.Int{
+			bigInt(t, "4BzEEOtIpmVdVEZNCqS7baC4crd0pqnRH_5IB3jw3bcxGn6QLvnEtfdUdiYrqBdss1l58BQ3KhooKeQTa9AB0Hw_Py5PJdTJNPY8cQn7ouZ2KKDcmnPGBY5t7yLc1QlQ5xHdwW1VhvKn-nXqhJTBgIPgtldC-KDV5z-y2XDwGUc"),
+			bigInt(t, "uQPEfgmVtjL0Uyyx88GZFF1fOunH3-7cepKmtH4pxhtCoHqpWmT8YAmZxaewHgHAjLYsp1ZSe7zFYHj7C6ul7TjeLQeZD_YwD66t62wDmpe_HlB-TnBA-njbglfIsRLtXlnDzQkv5dTltRJ11BKBBypeeF6689rjcJIDEz9RWdc"),
+		},
+	}
+	rsaKey.Precompute()
+	k.rsaPriv, k.rsaPub = keyPEMs(t, rsaKey)
+
+	es256Key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     bigInt(t, "f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU"),
+			Y:     bigInt(t, "x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0"),
+		},
+		D: bigInt(t, "jpsQnnGQmL-YBIffH1136cspYG6-0iY7X1fCE9-E9LI"),
+	}
+	k.es256Priv, k.es256Pub = keyPEMs(t, es256Key)
+
+	es512Key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P521(),
+			X:     bigInt(t, "AekpBQ8ST8a8VcfVOTNl353vSrDCLLJXmPk06wTjxrrjcBpXp5EOnYG_NjFZ6OvLFV1jSfS9tsz4qUxcWceqwQGk"),
+			Y:     bigInt(t, "ADSmRA43Z1DSNx_RvcLI87cdL07l6jQyyBXMoxVg_l2Th-x3S1WDhjDly79ajL4Kkd0AZMaZmh9ubmf63e3kyMj2"),
+		},
+		D: bigInt(t, "AY5pb7A0UFiB3RELSD64fTLOSV_jazdF7fLYyuTw8lOfRhWg6Y6rUrPAxerEzgdRhajnu0ferB0d53vM9mE15j2C"),
+	}
+	k.es512Priv, k.es512Pub = keyPEMs(t, es512Key)
+
+	der, err := x509.MarshalPKIXPublicKey(&ecdsa.PublicKey{
+		Curve: elliptic.P521(),
+		X:     bigInt(t, "AHKZLLOsCOzz5cY97ewNUajB957y-C-U88c3v13nmGZx6sYl_oJXu9A5RkTKqjqvjyekWF-7ytDyRXYgCF5cj0Kt"),
+		Y:     bigInt(t, "AdymlHvOiLxXkEhayXQnNCvDX4h9htZaCJN34kfmC6pV5OhQHiraVySsUdaQkAgDPrwQrJmbnX9cwlGfP-HqHZR1"),
+	})
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() error: %v", err)
+	}
+	k.es512Cookbook = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	edKey := ed25519.NewKeyFromSeed(mustDecode(t, "nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A"))
+	k.edPriv, k.edPub = keyPEMs(t, edKey)
+
+	return k
+}
+
+// Payload of RFC 7515 appendix A.1 - A.3 and RFC 7519 section 3.1.
+const rfc7515Payload = "eyJpc3MiOiJqb2UiLA0KICJleHAiOjEzMDA4MTkzODAsDQogImh0dHA6Ly9leGFtcGxlLmNvbS9pc19yb290Ijp0cnVlfQ"
+
+// Payload of RFC 7520 section 4.
+const rfc7520Payload = "SXTigJlzIGEgZGFuZ2Vyb3VzIGJ1c2luZXNzLCBGcm9kbywgZ29pbmcgb3V0IHlvdXIgZG9vci4gWW91IHN0ZXAgb250byB0aGUgcm9hZCwgYW5kIGlmIHlvdSBkb24ndCBrZWVwIHlvdXIgZmVldCwgdGhlcmXigJlzIG5vIGtub3dpbmcgd2hlcmUgeW91IG1pZ2h0IGJlIHN3ZXB0IG9mZiB0by4"
+
+func TestConformanceVectors(t *testing.T) {
+	k := newVectorKeys(t)
+
+	tests := []struct {
+		name    string
+		alg     string
+		header  string
+		payload string
+		sig     string
+		// signKey is nil if the private key is not published.
+		signKey   []byte
+		verifyKey []byte
+		// exact is true if SignDetached() must reproduce the JWS:
+		// the alg is deterministic and header is {"alg":alg}.
+		exact bool
+		// parseErr is the error of Parse() after the signature is verified:
+		// claims of RFC 7515 are expired and other payloads are not JSON.
+		parseErr error
+	}{
+		{
+			name:      "RFC 7515 A.1, RFC 7519 3.1",
+			alg:       "HS256",
+			header:    "eyJ0eXAiOiJKV1QiLA0KICJhbGciOiJIUzI1NiJ9",
+			payload:   rfc7515Payload,
+			sig:       "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk",
+			signKey:   mustDecode(t, hmacKeyRFC7515),
+			verifyKey: mustDecode(t, hmacKeyRFC7515),
+			parseErr:  jwthelper.ErrTokenExpired,
+		},
+		{
+			name:      "RFC 7515 A.2",
+			alg:       "RS256",
+			header:    "eyJhbGciOiJSUzI1NiJ9",
+			payload:   rfc7515Payload,
+			sig:       "cC4hiUPoj9Eetdgtv3hF80EGrhuB__dzERat0XF9g2VtQgr9PJbu3XOiZj5RZmh7AAuHIm4Bh-0Qc_lF5YKt_O8W2Fp5jujGbds9uJdbF9CUAr7t1dnZcAcQjbKBYNX4BAynRFdiuB--f_nZLgrnbyTyWzO75vRK5h6xBArLIARNPvkSjtQBMHlb1L07Qe7K0GarZRmB_eSN9383LcOLn6_dO--xi12jzDwusC-eOkHWEsqtFZESc6BfI7noOPqvhJ1phCnvWh6IeYI2w9QOYEUipUTI8np6LbgGY9Fs98rqVt5AXLIhWkWywlVmtVrBp0igcN_IoypGlUPQGe77Rw",
+			signKey:   k.rsaPriv,
+			verifyKey: k.rsaPub,
+			exact:     true,
+			parseErr:  jwthelper.ErrTokenExpired,
+		},
+		{
+			name:      "RFC 7515 A.3",
+			alg:       "ES256",
+			header:    "eyJhbGciOiJFUzI1NiJ9",
+			payload:   rfc7515Payload,
+			sig:       "DtEhU3ljbEg8L38VWAfUAqOyKAM6-Xx-F4GawxaepmXFCgfTjDxw5djxLa8ISlSApmWQxfKTUJqPP3-Kg6NU1Q",
+			signKey:   k.es256Priv,
+			verifyKey: k.es256Pub,
+			parseErr:  jwthelper.ErrTokenExpired,
+		},
+		{
+			name:      "RFC 7520 4.3",
+			alg:       "ES512",
+			header:    "eyJhbGciOiJFUzUxMiIsImtpZCI6ImJpbGJvLmJhZ2dpbnNAaG9iYml0b24uZXhhbXBsZSJ9",
+			payload:   rfc7520Payload,
+			sig:       "AE_R_YZCChjn4791jSQCrdPZCNYqHXCTZH0-JZGYNlaAjP2kqaluUIIUnC9qvbu9Plon7KRTzoNEuT4Va2cmL1eJAQy3mtPBu_u_sDDyYjnAMDxXPn7XrT0lw-kvAD890jl8e2puQens_IEKBpHABlsbEPX6sFY8OcGDqoRuBomu9xQ2",
+			verifyKey: k.es512Cookbook,
+			parseErr:  jwthelper.ErrMalformed,
+		},
+		{
+			name:      "RFC 7520 4.4",
+			alg:       "HS256",
+			header:    "eyJhbGciOiJIUzI1NiIsImtpZCI6IjAxOGMwYWU1LTRkOWItNDcxYi1iZmQ2LWVlZjMxNGJjNzAzNyJ9",
+			payload:   rfc7520Payload,
+			sig:       "s0h6KThzkfBBBkLspW1h84VsJZFTsPPqMDA7g1Md7p0",
+			signKey:   mustDecode(t, "hJtXIZ2uSN5kbQfbtTNWbpdmhkV8FJG-Onbc6mxCcYg"),
+			verifyKey: mustDecode(t, "hJtXIZ2uSN5kbQfbtTNWbpdmhkV8FJG-Onbc6mxCcYg"),
+			parseErr:  jwthelper.ErrMalformed,
+		},
+		{
+			name:      "RFC 8037 A.4",
+			alg:       "EdDSA",
+			header:    "eyJhbGciOiJFZERTQSJ9",
+			payload:   "RXhhbXBsZSBvZiBFZDI1NTE5IHNpZ25pbmc",
+			sig:       "hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg",
+			signKey:   k.edPriv,
+			verifyKey: k.edPub,
+			exact:     true,
+			parseErr:  jwthelper.ErrMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := jwthelper.NewParser(tt.alg, tt.verifyKey)
+			if err != nil {
+				t.Fatalf("NewParser() error: %v", err)
+			}
+			payload := string(mustDecode(t, tt.payload))
+			detached := tt.header + ".." + tt.sig
+
+			if err = p.VerifyDetached(detached, strings.NewReader(payload)); err != nil {
+				t.Errorf("VerifyDetached() error: %v", err)
+			}
+			if err = p.VerifyDetached(detached, strings.NewReader(payload+" ")); !errors.Is(err, jwthelper.ErrSignatureInvalid) {
+				t.Errorf("VerifyDetached() of modified payload: %v, want %v", err, jwthelper.ErrSignatureInvalid)
+			}
+
+			_, err = p.Parse(tt.header + "." + tt.payload + "." + tt.sig)
+			if !errors.Is(err, tt.parseErr) || errors.Is(err, jwthelper.ErrSignatureInvalid) {
+				t.Errorf("Parse() error: %v, want %v", err, tt.parseErr)
+			}
+
+			if tt.signKey == nil {
+				return
+			}
+			s, err := jwthelper.NewSigner(tt.alg, tt.signKey)
+			if err != nil {
+				t.Fatalf("NewSigner() error: %v", err)
+			}
+			str, err := s.SignDetached(strings.NewReader(payload))
+			if err != nil {
+				t.Fatalf("SignDetached() error: %v", err)
+			}
+			if tt.exact && str != detached {
+				t.Errorf("SignDetached() = %v, want %v", str, detached)
+			}
+			if err = p.VerifyDetached(str, strings.NewReader(payload)); err != nil {
+				t.Errorf("VerifyDetached() of SignDetached() error: %v", err)
+			}
+		})
+	}
+}
+
+func TestConformanceRoundTrip(t *testing.T) {
+	k := newVectorKeys(t)
+	hmacKey := mustDecode(t, hmacKeyRFC7515)
+
+	es384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+	es384Priv, es384Pub := keyPEMs(t, es384Key)
+
+	tests := []struct {
+		alg       string
+		signKey   []byte
+		verifyKey []byte
+	}{
+		{"HS256", hmacKey, hmacKey},
+		{"HS384", hmacKey, hmacKey},
+		{"HS512", hmacKey, hmacKey},
+		{"RS256", k.rsaPriv, k.rsaPub},
+		{"RS384", k.rsaPriv, k.rsaPub},
+		{"RS512", k.rsaPriv, k.rsaPub},
+		{"PS256", k.rsaPriv, k.rsaPub},
+		{"PS384", k.rsaPriv, k.rsaPub},
+		{"PS512", k.rsaPriv, k.rsaPub},
+		{"ES256", k.es256Priv, k.es256Pub},
+		{"ES384", es384Priv, es384Pub},
+		{"ES512", k.es512Priv, k.es512Pub},
+		{"EdDSA", k.edPriv, k.edPub},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			s, err := jwthelper.NewSigner(tt.alg, tt.signKey)
+			if err != nil {
+				t.Fatalf("NewSigner() error: %v", err)
+			}
+			p, err := jwthelper.NewParser(tt.alg, tt.verifyKey)
+			if err != nil {
+				t.Fatalf("NewParser() error: %v", err)
+			}
+
+			str, err := s.SignedString(
+				jwthelper.NewClaim("sub", "frank"),
+				jwthelper.NewClaim("count", 100),
+			)
+			if err != nil {
+				t.Fatalf("SignedString() error: %v", err)
+			}
+
+			header, err := jwthelper.ParseHeader(str)
+			if err != nil {
+				t.Fatalf("ParseHeader() error: %v", err)
+			}
+			if header["alg"] != tt.alg || header["typ"] != "JWT" {
+				t.Errorf("header = %v", header)
+			}
+
+			claims, err := p.Parse(str)
+			if err != nil {
+				t.Fatalf("Parse() error: %v", err)
+			}
+			if claims["sub"] != "frank" || claims["count"] != json.Number("100") {
+				t.Errorf("claims = %v", claims)
+			}
+		})
+	}
+}
+
+// hs256Token returns the compact serialization signed with HS256.
+// It's used to craft tokens which Signer never produces.
+func hs256Token(key []byte, header, claims string) string {
+	input := b64.EncodeToString([]byte(header)) + "." + b64.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(input))
+	return input + "." + b64.EncodeToString(mac.Sum(nil))
+}
+
+func TestConformanceNegative(t *testing.T) {
+	k := newVectorKeys(t)
+	hmacKey := mustDecode(t, hmacKeyRFC7515)
+
+	sign := func(alg string, key []byte) string {
+		s, err := jwthelper.NewSigner(alg, key)
+		if err != nil {
+			t.Fatalf("NewSigner(%v) error: %v", alg, err)
+		}
+		str, err := s.SignedString(jwthelper.NewClaim("sub", "frank"))
+		if err != nil {
+			t.Fatalf("SignedString() error: %v", err)
+		}
+		return str
+	}
+	// truncate removes the last byte of the raw signature.
+	truncate := func(str string) string {
+		i := strings.LastIndex(str, ".")
+		sig := mustDecode(t, str[i+1:])
+		return str[:i+1] + b64.EncodeToString(sig[:len(sig)-1])
+	}
+	// replaceSig replaces the encoded signature.
+	replaceSig := func(str, sig string) string {
+		return str[:strings.LastIndex(str, ".")+1] + sig
+	}
+
+	hs256 := sign("HS256", hmacKey)
+	rs256 := sign("RS256", k.rsaPriv)
+	es256 := sign("ES256", k.es256Priv)
+	eddsa := sign("EdDSA", k.edPriv)
+	claims := strings.Split(hs256, ".")[1]
+
+	tests := []struct {
+		name  string
+		alg   string
+		key   []byte
+		token string
+		err   error
+	}{
+		// alg=none(RFC 7519 section 6) is never accepted.
+		{"none", "HS256", hmacKey, "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0." + claims + ".", jwthelper.ErrAlgNotAllowed},
+		{"none with signature", "HS256", hmacKey, "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0." + claims + "." + strings.Split(hs256, ".")[2], jwthelper.ErrAlgNotAllowed},
+		{"None", "RS256", k.rsaPub, "eyJhbGciOiJOb25lIn0." + claims + ".", jwthelper.ErrAlgNotAllowed},
+		{"missing alg", "HS256", hmacKey, hs256Token(hmacKey, `{"typ":"JWT"}`, `{"sub":"frank"}`), jwthelper.ErrAlgNotAllowed},
+
+		// Public key used as HMAC secret.
+		{"RS256 to HS256", "RS256", k.rsaPub, hs256Token(k.rsaPub, `{"alg":"HS256","typ":"JWT"}`, `{"sub":"frank"}`), jwthelper.ErrAlgNotAllowed},
+		{"ES256 to HS256", "ES256", k.es256Pub, hs256Token(k.es256Pub, `{"alg":"HS256","typ":"JWT"}`, `{"sub":"frank"}`), jwthelper.ErrAlgNotAllowed},
+		{"EdDSA to HS256", "EdDSA", k.edPub, hs256Token(k.edPub, `{"alg":"HS256","typ":"JWT"}`, `{"sub":"frank"}`), jwthelper.ErrAlgNotAllowed},
+		{"RS256 to PS256", "PS256", k.rsaPub, rs256, jwthelper.ErrAlgNotAllowed},
+
+		// Truncated signatures.
+		{"truncated HS256", "HS256", hmacKey, truncate(hs256), jwthelper.ErrSignatureInvalid},
+		{"truncated RS256", "RS256", k.rsaPub, truncate(rs256), jwthelper.ErrSignatureInvalid},
+		{"truncated ES256", "ES256", k.es256Pub, truncate(es256), jwthelper.ErrSignatureInvalid},
+		{"truncated EdDSA", "EdDSA", k.edPub, truncate(eddsa), jwthelper.ErrSignatureInvalid},
+		{"empty signature", "HS256", hmacKey, replaceSig(hs256, ""), jwthelper.ErrSignatureInvalid},
+
+		// Only unpadded base64url(RFC 7515 section 2) is accepted.
+		{"padded signature", "HS256", hmacKey, hs256 + "=", jwthelper.ErrMalformed},
+		{"padded header", "HS256", hmacKey, strings.Replace(hs256, ".", "=.", 1), jwthelper.ErrMalformed},
+		{"standard alphabet", "HS256", hmacKey, replaceSig(hs256, base64.RawStdEncoding.EncodeToString([]byte{0xfb, 0xff})), jwthelper.ErrMalformed},
+		{"non-canonical", "HS256", hmacKey, replaceSig(hs256, "AB"), jwthelper.ErrMalformed},
+		{"invalid length", "HS256", hmacKey, replaceSig(hs256, "A"), jwthelper.ErrMalformed},
+
+		// Duplicate member names(RFC 7515 section 5.2, RFC 7519 section 4).
+		{"duplicate header", "HS256", hmacKey, hs256Token(hmacKey, `{"alg":"HS256","alg":"none"}`, `{"sub":"frank"}`), jwthelper.ErrMalformed},
+		{"duplicate claim", "HS256", hmacKey, hs256Token(hmacKey, `{"alg":"HS256"}`, `{"sub":"frank","sub":"admin"}`), jwthelper.ErrMalformed},
+		{"nested duplicate claim", "HS256", hmacKey, hs256Token(hmacKey, `{"alg":"HS256"}`, `{"sub":"frank","cnf":{"jkt":"a","jkt":"b"}}`), jwthelper.ErrMalformed},
+
+		// Other malformed tokens.
+		{"two parts", "HS256", hmacKey, hs256[:strings.LastIndex(hs256, ".")], jwthelper.ErrMalformed},
+		{"four parts", "HS256", hmacKey, hs256 + ".", jwthelper.ErrMalformed},
+		{"claims array", "HS256", hmacKey, hs256Token(hmacKey, `{"alg":"HS256"}`, `["frank"]`), jwthelper.ErrMalformed},
+		{"trailing data", "HS256", hmacKey, hs256Token(hmacKey, `{"alg":"HS256"}`, `{"sub":"frank"}{}`), jwthelper.ErrMalformed},
+		{"unknown crit", "HS256", hmacKey, hs256Token(hmacKey, `{"alg":"HS256","crit":["exp"],"exp":1}`, `{"sub":"frank"}`), jwthelper.ErrMalformed},
+		{"exp string", "HS256", hmacKey, hs256Token(hmacKey, `{"alg":"HS256"}`, `{"exp":"4102444800"}`), jwthelper.ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := jwthelper.NewParser(tt.alg, tt.key)
+			if err != nil {
+				t.Fatalf("NewParser() error: %v", err)
+			}
+			claims, err := p.Parse(tt.token)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Parse() error: %v, want %v", err, tt.err)
+			}
+			if len(claims) != 0 {
+				t.Errorf("Parse() returns claims: %v", claims)
+			}
+		})
+	}
+
+	for _, alg := range []string{"none", "None", ""} {
+		if _, err := jwthelper.NewSigner(alg, hmacKey); !errors.Is(err, jwthelper.ErrInvalidAlg) {
+			t.Errorf("NewSigner(%q) error: %v, want %v", alg, err, jwthelper.ErrInvalidAlg)
+		}
+		if _, err := jwthelper.NewParser(alg, hmacKey); !errors.Is(err, jwthelper.ErrInvalidAlg) {
+			t.Errorf("NewParser(%q) error: %v, want %v", alg, err, jwthelper.ErrInvalidAlg)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package jwthelper
+
+import (
+	"context"
+)
+
+// contextKey is the type of context keys defined in this package.
+type contextKey int
+
+const (
+	// claimsKey is the context key for verified claims.
+	claimsKey contextKey = iota
+)
+
+// NewContext returns a new context that carries verified claims.
+func NewContext(ctx context.Context, claims map[string]interface{}) context.Context {
+	return context.WithValue(ctx, claimsKey, claims)
+}
+
+// ClaimsFromContext returns the verified claims stored in the context by the middlewares.
+func ClaimsFromContext(ctx context.Context) (map[string]interface{}, bool) {
+	claims, ok := ctx.Value(claimsKey).(map[string]interface{})
+	return claims, ok
+}
@@ -2,6 +2,7 @@ package jwthelper
 
 import (
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -60,6 +61,49 @@ func CookieHttpOnly(httpOnly bool) CookieOption {
 	}}
 }
 
+// CookieSameSite returns the option for cookie SameSite attribute.
+// Secure is enforced for http.SameSiteNoneMode.
+func CookieSameSite(sameSite http.SameSite) CookieOption {
+	return CookieOption{func(c *http.Cookie) {
+		c.SameSite = sameSite
+	}}
+}
+
+// CookiePartitioned returns the option for partitioned cookie(CHIPS).
+// Secure is enforced for partitioned cookies.
+// See https://developer.mozilla.org/en-US/docs/Web/Privacy/Privacy_sandbox/Partitioned_cookies
+func CookiePartitioned(partitioned bool) CookieOption {
+	return CookieOption{func(c *http.Cookie) {
+		c.Partitioned = partitioned
+	}}
+}
+
+// Cookie name prefixes.
+// See https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Set-Cookie#cookie_prefixes
+const (
+	// CookieHostPrefix requires Secure, Path=/ and no Domain.
+	CookieHostPrefix = "__Host-"
+	// CookieSecurePrefix requires Secure.
+	CookieSecurePrefix = "__Secure-"
+)
+
+// enforceCookieRules enforces the attributes required by cookie prefixes,
+// SameSite=None and Partitioned.
+func enforceCookieRules(c *http.Cookie) {
+	switch {
+	case strings.HasPrefix(c.Name, CookieHostPrefix):
+		c.Secure = true
+		c.Path = "/"
+		c.Domain = ""
+	case strings.HasPrefix(c.Name, CookieSecurePrefix):
+		c.Secure = true
+	}
+
+	if c.SameSite == http.SameSiteNoneMode || c.Partitioned {
+		c.Secure = true
+	}
+}
+
 // NewCookie news a cookie contains JWT token.
 //
 //     Params:
@@ -68,13 +112,17 @@ func CookieHttpOnly(httpOnly bool) CookieOption {
 //                  Use helper functions to get options: CookieName(), CookieDomain()...
 //     Comments:
 //         It'll set cookie name to "jwt" if no name option specified.
+//         Secure and HttpOnly are true by default so that the token is not sent over plain HTTP
+//         or read by JavaScript. Use CookieSecure(false) and CookieHttpOnly(false) to disable them.
+//         Attributes required by "__Host-" and "__Secure-" prefixes are enforced.
+//         NewSecureCookie() also sets SameSite=Lax, Path=/ and "__Host-" prefix.
 func NewCookie(tokenString string, options ...CookieOption) *http.Cookie {
 	cookie := http.Cookie{
 		// Use "jwt" as cookie name by default.
 		Name:     "jwt",
 		Value:    tokenString,
-		Secure:   false,
-		HttpOnly: false,
+		Secure:   true,
+		HttpOnly: true,
 	}
 
 	// Override default cookie with customized options.
@@ -82,5 +130,22 @@ func NewCookie(tokenString string, options ...CookieOption) *http.Cookie {
 		op.f(&cookie)
 	}
 
+	enforceCookieRules(&cookie)
 	return &cookie
 }
+
+// NewSecureCookie news a cookie contains JWT token with secure defaults.
+//
+//     Params:
+//         tokenString: JWT token string. It'll be set as cookie value.
+//         options: Cookie options(optional) to override the defaults.
+//     Comments:
+//         Defaults: name is "__Host-jwt", Secure, HttpOnly, SameSite=Lax and Path=/.
+func NewSecureCookie(tokenString string, options ...CookieOption) *http.Cookie {
+	defaults := []CookieOption{
+		CookieName(CookieHostPrefix + "jwt"),
+		CookiePath("/"),
+		CookieSameSite(http.SameSiteLaxMode),
+	}
+	return NewCookie(tokenString, append(defaults, options...)...)
+}
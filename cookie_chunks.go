@@ -0,0 +1,204 @@
+package jwthelper
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// MaxCookieSize is the max size of a cookie(name, value and attributes) accepted by browsers.
+	MaxCookieSize = 4096
+	// MaxCookieChunks is the max number of chunk cookies created by NewCookies().
+	// Browsers limit the number of cookies per domain and servers limit the size of "Cookie" header.
+	MaxCookieChunks = 10
+	// cookieSizeWarning is the size above which a cookie is considered close to the limit.
+	cookieSizeWarning = MaxCookieSize * 9 / 10
+	// cookiesSizeWarning is the total size above which chunk cookies are considered close to the limit.
+	cookiesSizeWarning = MaxCookieChunks * MaxCookieSize * 9 / 10
+)
+
+var (
+	// ErrCookieTooLarge represents the error of cookie exceeding MaxCookieSize,
+	// or token which needs more than MaxCookieChunks chunk cookies.
+	// Browsers drop such cookies silently.
+	ErrCookieTooLarge = fmt.Errorf("cookie is too large")
+	// ErrCookieNearLimit represents the warning of cookie close to MaxCookieSize.
+	ErrCookieNearLimit = fmt.Errorf("cookie is close to the size limit")
+	// ErrInvalidCookieOptions represents the error of cookie options leaving no room for value.
+	ErrInvalidCookieOptions = fmt.Errorf("no room for cookie value")
+)
+
+// CheckCookieSize checks the size of the cookie.
+// It returns ErrCookieTooLarge if it exceeds MaxCookieSize,
+// or ErrCookieNearLimit if it's over 90% of MaxCookieSize.
+// Use CheckCookiesSize() for chunk cookies created by NewCookies().
+func CheckCookieSize(c *http.Cookie) error {
+	n := len(c.String())
+	switch {
+	case n > MaxCookieSize:
+		return ErrCookieTooLarge
+	case n > cookieSizeWarning:
+		return ErrCookieNearLimit
+	default:
+		return nil
+	}
+}
+
+// CheckCookiesSize checks the total size of the chunk cookies created by NewCookies().
+// It returns ErrCookieTooLarge if there're more than MaxCookieChunks chunks or a chunk exceeds MaxCookieSize,
+// or ErrCookieNearLimit if the total size is over 90% of MaxCookieChunks * MaxCookieSize.
+// Full chunks are expected and don't cause the warning.
+func CheckCookiesSize(cookies []*http.Cookie) error {
+	if len(cookies) > MaxCookieChunks {
+		return ErrCookieTooLarge
+	}
+
+	n := 0
+	for _, c := range cookies {
+		if err := CheckCookieSize(c); err == ErrCookieTooLarge {
+			return err
+		}
+		n += len(c.String())
+	}
+	if n > cookiesSizeWarning {
+		return ErrCookieNearLimit
+	}
+	return nil
+}
+
+// chunkName returns the name of the i-th chunk cookie.
+func chunkName(name string, i int) string {
+	return name + "." + strconv.Itoa(i)
+}
+
+// NewCookies splits the JWT token into numbered chunk cookies(e.g. "jwt.0", "jwt.1"...).
+// Each chunk cookie fits in MaxCookieSize.
+// It returns ErrCookieTooLarge if the token needs more than MaxCookieChunks chunks.
+//
+//     Params:
+//         tokenString: JWT token string.
+//         options: Cookie options(optional) shared by all chunks.
+//                  CookieName() sets the prefix of chunk names.
+//     Comments:
+//         Use ReadCookies() to put the chunks back together.
+//         Use SetCookies() to replace chunks of a larger token sent by the client.
+func NewCookies(tokenString string, options ...CookieOption) ([]*http.Cookie, error) {
+	base := NewCookie("", options...)
+
+	// Reserve room for the name suffix of the last chunk.
+	c := *base
+	c.Name = chunkName(base.Name, MaxCookieChunks-1)
+	size := MaxCookieSize - len(c.String())
+	if size <= 0 {
+		return nil, ErrInvalidCookieOptions
+	}
+	if len(tokenString) > size*MaxCookieChunks {
+		return nil, ErrCookieTooLarge
+	}
+
+	cookies := []*http.Cookie{}
+	for i := 0; i == 0 || len(tokenString) > 0; i++ {
+		n := size
+		if n > len(tokenString) {
+			n = len(tokenString)
+		}
+
+		c := *base
+		c.Name = chunkName(base.Name, i)
+		c.Value = tokenString[:n]
+		cookies = append(cookies, &c)
+		tokenString = tokenString[n:]
+	}
+	return cookies, nil
+}
+
+// ReadCookies reads the chunk cookies created by NewCookies() and puts them back together.
+//
+//     Params:
+//         r: HTTP request.
+//         options: Cookie options(optional) passed to NewCookies(). Only the name is used.
+//     Comments:
+//         It falls back to the cookie without chunk number created by NewCookie().
+func ReadCookies(r *http.Request, options ...CookieOption) (string, error) {
+	name := NewCookie("", options...).Name
+
+	tokenString := ""
+	for i := 0; i < MaxCookieChunks; i++ {
+		c, err := r.Cookie(chunkName(name, i))
+		if err != nil {
+			break
+		}
+		tokenString += c.Value
+	}
+
+	if tokenString != "" {
+		return tokenString, nil
+	}
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return c.Value, nil
+}
+
+// clearCookie returns a cookie which removes the cookie with given name.
+func clearCookie(name string, options ...CookieOption) *http.Cookie {
+	c := NewCookie("", options...)
+	c.Name = name
+	c.Expires = time.Unix(0, 0)
+	c.MaxAge = -1
+	return c
+}
+
+// ClearCookies removes all chunk cookies sent by the client
+// and the cookie without chunk number.
+//
+//     Params:
+//         w: HTTP response writer.
+//         r: HTTP request which carries the chunk cookies.
+//         options: Cookie options(optional) passed to NewCookies().
+func ClearCookies(w http.ResponseWriter, r *http.Request, options ...CookieOption) {
+	name := NewCookie("", options...).Name
+
+	for i := 0; i < MaxCookieChunks; i++ {
+		if _, err := r.Cookie(chunkName(name, i)); err != nil {
+			break
+		}
+		http.SetCookie(w, clearCookie(chunkName(name, i), options...))
+	}
+
+	if _, err := r.Cookie(name); err == nil {
+		http.SetCookie(w, clearCookie(name, options...))
+	}
+}
+
+// SetCookies sets the chunk cookies of the JWT token.
+// Stale chunks sent by the client which are not overwritten are removed.
+//
+//     Params:
+//         w: HTTP response writer.
+//         r: HTTP request which may carry chunk cookies of the previous token.
+//         tokenString: JWT token string.
+//         options: Cookie options(optional).
+func SetCookies(w http.ResponseWriter, r *http.Request, tokenString string, options ...CookieOption) error {
+	cookies, err := NewCookies(tokenString, options...)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range cookies {
+		http.SetCookie(w, c)
+	}
+
+	name := NewCookie("", options...).Name
+	for i := len(cookies); i < MaxCookieChunks; i++ {
+		if _, err := r.Cookie(chunkName(name, i)); err != nil {
+			break
+		}
+		http.SetCookie(w, clearCookie(chunkName(name, i), options...))
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package jwthelper_test
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleNewCookies() {
+	// A token larger than the per-cookie limit.
+	tokenString := strings.Repeat("x", 10000)
+
+	cookies, err := jwthelper.NewCookies(tokenString, jwthelper.CookiePath("/"))
+	if err != nil {
+		log.Printf("NewCookies() error: %v", err)
+		return
+	}
+
+	// Full chunks are expected. Only the total size is checked.
+	fmt.Println(jwthelper.CheckCookiesSize(cookies))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, c := range cookies {
+		fmt.Println(c.Name)
+		r.AddCookie(c)
+	}
+
+	// Put the chunks back together.
+	s, err := jwthelper.ReadCookies(r)
+	if err != nil {
+		log.Printf("ReadCookies() error: %v", err)
+		return
+	}
+	fmt.Println(s == tokenString)
+
+	// Output:
+	// <nil>
+	// jwt.0
+	// jwt.1
+	// jwt.2
+	// true
+}
+
+func TestNewCookies(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		chunks int
+		err    error
+		check  error
+	}{
+		{"empty", 0, 1, nil, nil},
+		{"small", 100, 1, nil, nil},
+		{"three chunks", 10000, 3, nil, nil},
+		{"near limit", 37000, 10, nil, jwthelper.ErrCookieNearLimit},
+		{"too many chunks", 50000, 0, jwthelper.ErrCookieTooLarge, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenString := strings.Repeat("x", tt.size)
+			cookies, err := jwthelper.NewCookies(tokenString)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("NewCookies() error: %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if len(cookies) != tt.chunks {
+				t.Errorf("NewCookies() returns %v chunks, want %v", len(cookies), tt.chunks)
+			}
+			if err = jwthelper.CheckCookiesSize(cookies); err != tt.check {
+				t.Errorf("CheckCookiesSize() error: %v, want %v", err, tt.check)
+			}
+
+			r := httptest.NewRequest("GET", "/", nil)
+			for _, c := range cookies {
+				if err = jwthelper.CheckCookieSize(c); err == jwthelper.ErrCookieTooLarge {
+					t.Errorf("CheckCookieSize(%v) error: %v", c.Name, err)
+				}
+				r.AddCookie(c)
+			}
+			if s, err := jwthelper.ReadCookies(r); tt.size > 0 && (err != nil || s != tokenString) {
+				t.Errorf("ReadCookies() = %v bytes, %v, want %v bytes", len(s), err, tt.size)
+			}
+		})
+	}
+
+	// Too many chunk cookies.
+	cookies := make([]*http.Cookie, jwthelper.MaxCookieChunks+1)
+	for i := range cookies {
+		cookies[i] = &http.Cookie{Name: fmt.Sprintf("jwt.%d", i), Value: "x"}
+	}
+	if err := jwthelper.CheckCookiesSize(cookies); err != jwthelper.ErrCookieTooLarge {
+		t.Errorf("CheckCookiesSize() error: %v, want %v", err, jwthelper.ErrCookieTooLarge)
+	}
+}
+
+// setCookies returns the Set-Cookie cookies by name.
+func setCookies(w *httptest.ResponseRecorder) map[string]*http.Cookie {
+	m := map[string]*http.Cookie{}
+	for _, c := range w.Result().Cookies() {
+		m[c.Name] = c
+	}
+	return m
+}
+
+func TestSetCookies(t *testing.T) {
+	// The client sends chunks of a larger token.
+	old, err := jwthelper.NewCookies(strings.Repeat("x", 10000))
+	if err != nil {
+		t.Fatalf("NewCookies() error: %v", err)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, c := range old {
+		r.AddCookie(c)
+	}
+
+	tests := []struct {
+		name    string
+		size    int
+		set     []string
+		cleared []string
+	}{
+		{"shrink to one chunk", 100, []string{"jwt.0"}, []string{"jwt.1", "jwt.2"}},
+		{"shrink to two chunks", 5000, []string{"jwt.0", "jwt.1"}, []string{"jwt.2"}},
+		{"same chunks", 10000, []string{"jwt.0", "jwt.1", "jwt.2"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if err := jwthelper.SetCookies(w, r, strings.Repeat("y", tt.size)); err != nil {
+				t.Fatalf("SetCookies() error: %v", err)
+			}
+
+			cookies := setCookies(w)
+			if len(cookies) != len(tt.set)+len(tt.cleared) {
+				t.Errorf("SetCookies() sets %v cookies, want %v", len(cookies), len(tt.set)+len(tt.cleared))
+			}
+			for _, name := range tt.set {
+				if c, ok := cookies[name]; !ok || c.MaxAge < 0 || !strings.HasPrefix(c.Value, "y") {
+					t.Errorf("cookie %v = %v, want new chunk", name, c)
+				}
+			}
+			for _, name := range tt.cleared {
+				if c, ok := cookies[name]; !ok || c.MaxAge >= 0 || c.Value != "" {
+					t.Errorf("cookie %v = %v, want cleared", name, c)
+				}
+			}
+		})
+	}
+}
+
+func TestClearCookies(t *testing.T) {
+	chunks, err := jwthelper.NewCookies(strings.Repeat("x", 10000), jwthelper.CookieName("session"))
+	if err != nil {
+		t.Fatalf("NewCookies() error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		cookies []*http.Cookie
+		cleared []string
+	}{
+		{"chunks", chunks, []string{"session.0", "session.1", "session.2"}},
+		{"cookie without chunk number", []*http.Cookie{jwthelper.NewCookie("x", jwthelper.CookieName("session"))}, []string{"session"}},
+		{"other cookies", []*http.Cookie{jwthelper.NewCookie("x")}, nil},
+		{"no cookies", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			for _, c := range tt.cookies {
+				r.AddCookie(c)
+			}
+			w := httptest.NewRecorder()
+			jwthelper.ClearCookies(w, r, jwthelper.CookieName("session"))
+
+			cookies := setCookies(w)
+			if len(cookies) != len(tt.cleared) {
+				t.Errorf("ClearCookies() sets %v cookies, want %v", len(cookies), len(tt.cleared))
+			}
+			for _, name := range tt.cleared {
+				if c, ok := cookies[name]; !ok || c.MaxAge >= 0 || c.Value != "" {
+					t.Errorf("cookie %v = %v, want cleared", name, c)
+				}
+			}
+		})
+	}
+}
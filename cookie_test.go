@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"testing"
 	"time"
 
 	"github.com/northbright/jwthelper"
@@ -169,3 +170,43 @@ func ExampleNewCookie() {
 
 	// Output:
 }
+
+func ExampleNewSecureCookie() {
+	cookie := jwthelper.NewSecureCookie("token")
+	fmt.Println(cookie)
+
+	// Attributes required by "__Host-" prefix are enforced.
+	cookie = jwthelper.NewCookie(
+		"token",
+		jwthelper.CookieName("__Host-jwt"),
+		jwthelper.CookieDomain("example.com"),
+		jwthelper.CookiePath("/api"),
+	)
+	fmt.Println(cookie)
+
+	// Output:
+	// __Host-jwt=token; Path=/; HttpOnly; Secure; SameSite=Lax
+	// __Host-jwt=token; Path=/; HttpOnly; Secure
+}
+
+func TestNewCookie(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []jwthelper.CookieOption
+		want    string
+	}{
+		{"defaults", nil, "jwt=token; HttpOnly; Secure"},
+		{"insecure", []jwthelper.CookieOption{jwthelper.CookieSecure(false), jwthelper.CookieHttpOnly(false)}, "jwt=token"},
+		{"__Secure- prefix", []jwthelper.CookieOption{jwthelper.CookieName("__Secure-jwt"), jwthelper.CookieSecure(false)}, "__Secure-jwt=token; HttpOnly; Secure"},
+		{"SameSite=None", []jwthelper.CookieOption{jwthelper.CookieSecure(false), jwthelper.CookieSameSite(http.SameSiteNoneMode)}, "jwt=token; HttpOnly; Secure; SameSite=None"},
+		{"partitioned", []jwthelper.CookieOption{jwthelper.CookieSecure(false), jwthelper.CookiePartitioned(true)}, "jwt=token; HttpOnly; Secure; Partitioned"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jwthelper.NewCookie("token", tt.options...).String(); got != tt.want {
+				t.Errorf("NewCookie() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package jwthelper
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+const (
+	// CSRFClaimName is the name of the claim which stores the CSRF token.
+	CSRFClaimName = "csrf"
+	// CSRFHeaderName is the name of the header which carries the CSRF token.
+	CSRFHeaderName = "X-CSRF-Token"
+	// CSRFCookieName is the default name of the companion cookie readable by scripts.
+	CSRFCookieName = "csrf_token"
+)
+
+// SignedStringWithCSRF returns the signed string of the JWT token with a random CSRF token embedded.
+//
+// claims: variadic Claim returned by claim helper functions.
+// Return:
+// signed string of JWT token and the CSRF token.
+// Comments:
+// The CSRF token is stored in "csrf" claim.
+// Use NewCSRFCookie() to issue the companion cookie.
+// SessionManager does both on login with SessionCSRF() option.
+// Scripts read the cookie and send the CSRF token in "X-CSRF-Token" header.
+func (s *Signer) SignedStringWithCSRF(claims ...Claim) (string, string, error) {
+	csrfToken, err := newJTI()
+	if err != nil {
+		return "", "", err
+	}
+
+	c := make([]Claim, 0, len(claims)+1)
+	c = append(c, claims...)
+	c = append(c, NewClaim(CSRFClaimName, csrfToken))
+	tokenString, err := s.SignedString(c...)
+	if err != nil {
+		return "", "", err
+	}
+	return tokenString, csrfToken, nil
+}
+
+// NewCSRFCookie news the companion cookie contains CSRF token.
+//
+//     Params:
+//         csrfToken: CSRF token returned by Signer.SignedStringWithCSRF().
+//         options: Cookie options(optional).
+//     Comments:
+//         It'll set cookie name to "csrf_token" if no name option specified.
+//         It's not HTTP only so that scripts can read it.
+func NewCSRFCookie(csrfToken string, options ...CookieOption) *http.Cookie {
+	options = append([]CookieOption{CookieName(CSRFCookieName)}, options...)
+	c := NewCookie(csrfToken, options...)
+	c.HttpOnly = false
+	return c
+}
+
+// safeMethod returns true if the HTTP method is safe(RFC 7231) and does not need CSRF protection.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// CSRFMiddleware returns a handler which checks CSRF token on unsafe methods before calling next.
+// It compares "X-CSRF-Token" header against "csrf" claim in constant time
+// and responds 403 on mismatch.
+// Comments:
+// The verified claims must be stored in the context by an authentication middleware.
+// e.g. sessionManager.Middleware(jwthelper.CSRFMiddleware(handler))
+// with the session manager created with SessionCSRF() option.
+func CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !safeMethod(r.Method) {
+			claims, _ := ClaimsFromContext(r.Context())
+			want, _ := claims[CSRFClaimName].(string)
+			got := r.Header.Get(CSRFHeaderName)
+			if want == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,194 @@
+package jwthelper_test
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleCSRFMiddleware() {
+	log.Printf("\n\nExample of CSRF protection")
+
+	s, err := jwthelper.NewSigner("RS256", []byte(rsaPrivPEM))
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+
+	p, err := jwthelper.NewParser("RS256", []byte(rsaPubPEM))
+	if err != nil {
+		log.Printf("NewParser() error: %v", err)
+		return
+	}
+
+	// Embed the CSRF token in the session and issue a companion cookie readable by scripts on login.
+	m := jwthelper.NewSessionManager(s, p, jwthelper.SessionCSRF())
+	w := httptest.NewRecorder()
+	if err = m.Login(w, jwthelper.NewClaim("username", "admin")); err != nil {
+		log.Printf("Login() error: %v", err)
+		return
+	}
+	cookies := w.Result().Cookies()
+
+	h := m.Middleware(jwthelper.CSRFMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "OK")
+	})))
+
+	// Scripts read the companion cookie and send the CSRF token in the header.
+	csrfToken := ""
+	for _, c := range cookies {
+		if c.Name == jwthelper.CSRFCookieName {
+			csrfToken = c.Value
+		}
+	}
+
+	for _, header := range []string{"", csrfToken} {
+		r := httptest.NewRequest("POST", "/", nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		r.Header.Set(jwthelper.CSRFHeaderName, header)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		fmt.Println(w.Code)
+	}
+
+	// Output:
+	// 403
+	// 200
+}
+
+// loginCookies logs in with the session manager and returns the session cookie and the CSRF cookie.
+func loginCookies(t *testing.T, m *jwthelper.SessionManager) (*http.Cookie, *http.Cookie) {
+	w := httptest.NewRecorder()
+	if err := m.Login(w, jwthelper.NewClaim("username", "admin")); err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+
+	var session, csrf *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		switch c.Name {
+		case jwthelper.CSRFCookieName:
+			csrf = c
+		default:
+			session = c
+		}
+	}
+	return session, csrf
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	s, err := jwthelper.NewSigner("RS256", []byte(rsaPrivPEM))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	p, err := jwthelper.NewParser("RS256", []byte(rsaPubPEM))
+	if err != nil {
+		t.Fatalf("NewParser() error: %v", err)
+	}
+
+	m := jwthelper.NewSessionManager(s, p, jwthelper.SessionCSRF())
+	session, csrf := loginCookies(t, m)
+	if session == nil || csrf == nil {
+		t.Fatalf("Login() sets session cookie %v and CSRF cookie %v, want both", session, csrf)
+	}
+	// Session without "csrf" claim.
+	plain, _ := loginCookies(t, jwthelper.NewSessionManager(s, p))
+
+	h := m.Middleware(jwthelper.CSRFMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	tests := []struct {
+		name    string
+		method  string
+		session *http.Cookie
+		header  string
+		status  int
+	}{
+		{"matched header", "POST", session, csrf.Value, http.StatusOK},
+		{"mismatched header", "POST", session, csrf.Value + "x", http.StatusForbidden},
+		{"missing header", "POST", session, "", http.StatusForbidden},
+		{"missing session cookie", "POST", nil, csrf.Value, http.StatusUnauthorized},
+		{"session without csrf claim", "POST", plain, "", http.StatusForbidden},
+		{"PUT without header", "PUT", session, "", http.StatusForbidden},
+		{"PATCH without header", "PATCH", session, "", http.StatusForbidden},
+		{"DELETE without header", "DELETE", session, "", http.StatusForbidden},
+		{"GET without header", "GET", session, "", http.StatusOK},
+		{"HEAD without header", "HEAD", session, "", http.StatusOK},
+		{"OPTIONS without header", "OPTIONS", session, "", http.StatusOK},
+		{"TRACE without header", "TRACE", session, "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			if tt.session != nil {
+				r.AddCookie(tt.session)
+			}
+			if tt.header != "" {
+				r.Header.Set(jwthelper.CSRFHeaderName, tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("%v status = %v, want %v", tt.method, w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestSessionCSRF(t *testing.T) {
+	s, err := jwthelper.NewSigner("RS256", []byte(rsaPrivPEM))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	p, err := jwthelper.NewParser("RS256", []byte(rsaPubPEM))
+	if err != nil {
+		t.Fatalf("NewParser() error: %v", err)
+	}
+	// Sessions of m are close to expiry for the renewing manager.
+	m := jwthelper.NewSessionManager(s, p, jwthelper.SessionCSRF(), jwthelper.SessionTTL(time.Minute))
+	renewing := jwthelper.NewSessionManager(s, p, jwthelper.SessionCSRF())
+
+	// Companion cookie is readable by scripts and matches the claim.
+	session, csrf := loginCookies(t, m)
+	claims, err := p.Parse(session.Value)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if claims[jwthelper.CSRFClaimName] != csrf.Value || csrf.HttpOnly || !csrf.Secure || csrf.Path != "/" || csrf.MaxAge != session.MaxAge {
+		t.Errorf("CSRF cookie = %v, want readable cookie of claim %v with session lifetime", csrf, claims[jwthelper.CSRFClaimName])
+	}
+
+	// Renewal keeps the CSRF token.
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(session)
+	w := httptest.NewRecorder()
+	if _, err = renewing.Get(w, r); err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	renewed := setCookies(w)
+	if c := renewed[jwthelper.CSRFCookieName]; c == nil || c.Value != csrf.Value {
+		t.Errorf("renewed CSRF cookie = %v, want value %v", c, csrf.Value)
+	}
+	if c := renewed[session.Name]; c == nil {
+		t.Errorf("session cookie is not renewed")
+	} else if claims, err = p.Parse(c.Value); err != nil || claims[jwthelper.CSRFClaimName] != csrf.Value {
+		t.Errorf("renewed claims = %v, %v, want csrf %v", claims, err, csrf.Value)
+	}
+
+	// Logout clears both cookies.
+	w = httptest.NewRecorder()
+	m.Logout(w)
+	cleared := setCookies(w)
+	for _, name := range []string{session.Name, jwthelper.CSRFCookieName} {
+		if c := cleared[name]; c == nil || c.MaxAge >= 0 {
+			t.Errorf("cookie %v = %v, want cleared", name, c)
+		}
+	}
+}
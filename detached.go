@@ -0,0 +1,180 @@
+package jwthelper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/northbright/jwthelper/internal/jose"
+)
+
+// DetachedOption represents the option for signing detached content.
+// Use option helper functions to set options:
+// e.g. DetachedUnencoded()
+type DetachedOption struct {
+	f func(o *detachedOptions)
+}
+
+// detachedOptions stores the options for signing detached content.
+type detachedOptions struct {
+	unencoded bool
+}
+
+var (
+	// ErrNotDetached represents the error of JWS which payload is not detached.
+	ErrNotDetached = fmt.Errorf("payload of JWS is not detached")
+	// ErrInvalidHeader represents the error of invalid JOSE header.
+	ErrInvalidHeader = fmt.Errorf("invalid JOSE header")
+	// ErrUnsupportedCrit represents the error of unsupported critical header parameter.
+	ErrUnsupportedCrit = fmt.Errorf("unsupported critical header parameter")
+)
+
+// DetachedUnencoded returns the option for unencoded payload.
+// It sets "b64" header parameter to false and adds "b64" to "crit".
+// The payload is used as is in the signing input instead of being base64url-encoded.
+// See https://tools.ietf.org/html/rfc7797
+func DetachedUnencoded(flag bool) DetachedOption {
+	return DetachedOption{func(o *detachedOptions) {
+		o.unencoded = flag
+	}}
+}
+
+// signingInput returns the JWS signing input of encoded header and payload.
+// payload is base64url-encoded unless unencoded is true(RFC 7797).
+func signingInput(header string, payload []byte, unencoded bool) string {
+	if unencoded {
+		return header + "." + string(payload)
+	}
+	return header + "." + encodeSegment(payload)
+}
+
+// SignDetached signs the payload and returns the JWS with detached content.
+//
+// payload: content to be signed. It's not included in the returned JWS.
+// options: variadic options returned by option helper functions.
+// e.g. DetachedUnencoded(true)
+// Return:
+// JWS in "header..signature" form.
+// See https://tools.ietf.org/html/rfc7515#appendix-F
+func (s *Signer) SignDetached(payload io.Reader, options ...DetachedOption) (string, error) {
+	if !s.Valid() {
+		return "", ErrInvalidSigner
+	}
+
+	o := detachedOptions{}
+	for _, op := range options {
+		op.f(&o)
+	}
+
+	header := map[string]interface{}{}
+	s.setKeyHeader(header)
+	if o.unencoded {
+		header["b64"] = false
+		header["crit"] = []string{"b64"}
+	}
+
+	buf, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	h := encodeSegment(buf)
+
+	content, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := s.key.method.Sign(signingInput(h, content, o.unencoded), s.key.key)
+	if err != nil {
+		return "", err
+	}
+
+	return h + ".." + encodeSegment(sig), nil
+}
+
+// unencodedPayload checks "b64" and "crit" header parameters and returns true if payload is unencoded.
+func unencodedPayload(header map[string]interface{}) (bool, error) {
+	b64 := true
+	if v, ok := header["b64"]; ok {
+		if b64, ok = v.(bool); !ok {
+			return false, ErrInvalidHeader
+		}
+	}
+
+	critB64 := false
+	if v, ok := header["crit"]; ok {
+		crit, ok := v.([]interface{})
+		if !ok || len(crit) == 0 {
+			return false, ErrInvalidHeader
+		}
+		for _, c := range crit {
+			name, ok := c.(string)
+			if !ok {
+				return false, ErrInvalidHeader
+			}
+			// "b64" is the only critical header parameter understood.
+			if name != "b64" {
+				return false, ErrUnsupportedCrit
+			}
+			critB64 = true
+		}
+	}
+
+	// "b64" must be listed in "crit" when it's false.
+	// See https://tools.ietf.org/html/rfc7797#section-6
+	if !b64 && !critB64 {
+		return false, ErrInvalidHeader
+	}
+	return !b64, nil
+}
+
+// VerifyDetached verifies the JWS with detached content.
+//
+// tokenString: JWS in "header..signature" form.
+// payload: detached content which is transferred separately.
+// comments:
+// "b64" header parameter with "crit"(RFC 7797) is supported.
+func (p *Parser) VerifyDetached(tokenString string, payload io.Reader) error {
+	if !p.Valid() {
+		return ErrInvalidParser
+	}
+
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return wrapError(ErrMalformed, ErrInvalidPartNum)
+	}
+	if parts[1] != "" {
+		return ErrNotDetached
+	}
+
+	header, err := decodeSegment(parts[0], false)
+	if err != nil {
+		return err
+	}
+
+	if err = p.checkKey(header); err != nil {
+		return err
+	}
+
+	unencoded, err := unencodedPayload(header)
+	if err != nil {
+		return wrapError(ErrMalformed, err)
+	}
+
+	content, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return err
+	}
+
+	sig, err := jose.DecodeSegment(parts[2])
+	if err != nil {
+		return wrapError(ErrMalformed, err)
+	}
+
+	if err = p.key.method.Verify(signingInput(parts[0], content, unencoded), sig, p.key.verifyingKey()); err != nil {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package jwthelper_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleSigner_SignDetached() {
+	log.Printf("\n\nExample of sign / verify JWS with detached unencoded payload")
+
+	// HMAC key and payload from RFC 7797 section 4.
+	key, err := base64.RawURLEncoding.DecodeString(hmacKeyRFC7515)
+	if err != nil {
+		log.Printf("DecodeString() error: %v", err)
+		return
+	}
+	payload := "$.02"
+
+	s, err := jwthelper.NewSigner("HS256", key)
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+
+	str, err := s.SignDetached(strings.NewReader(payload), jwthelper.DetachedUnencoded(true))
+	if err != nil {
+		log.Printf("SignDetached() error: %v", err)
+		return
+	}
+	fmt.Println(str)
+
+	p, err := jwthelper.NewParser("HS256", key)
+	if err != nil {
+		log.Printf("NewParser() error: %v", err)
+		return
+	}
+
+	// Payload is transferred separately.
+	fmt.Println(p.VerifyDetached(str, strings.NewReader(payload)))
+	fmt.Println(p.VerifyDetached(str, strings.NewReader("$.03")) != nil)
+
+	// Output:
+	// eyJhbGciOiJIUzI1NiIsImI2NCI6ZmFsc2UsImNyaXQiOlsiYjY0Il19..A5dxf2s96_n5FLueVuW1Z_vh161FwXZC4YLPff6dmDY
+	// <nil>
+	// true
+}
+
+// HMAC key from RFC 7515 appendix A.1.
+var hmacKeyRFC7515 = "AyM1SysPpbyDfgZld3umj1qzKObwVMkoqQ-EstJQLr_T-1qS0gZH75aKtMN3Yj0iPS4hcgUuTwjAzZr1Z9CAow"
+
+func TestVerifyDetached(t *testing.T) {
+	key, err := base64.RawURLEncoding.DecodeString(hmacKeyRFC7515)
+	if err != nil {
+		t.Fatalf("DecodeString() error: %v", err)
+	}
+	s, err := jwthelper.NewSigner("HS256", key)
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	p, err := jwthelper.NewParser("HS256", key)
+	if err != nil {
+		t.Fatalf("NewParser() error: %v", err)
+	}
+
+	payload := "$.02"
+	sign := func(options ...jwthelper.DetachedOption) string {
+		str, err := s.SignDetached(strings.NewReader(payload), options...)
+		if err != nil {
+			t.Fatalf("SignDetached() error: %v", err)
+		}
+		return str
+	}
+	// signHeader signs the unencoded payload with the raw JOSE header.
+	signHeader := func(header string) string {
+		h := base64.RawURLEncoding.EncodeToString([]byte(header))
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(h + "." + payload))
+		return h + ".." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		payload string
+		err     error
+	}{
+		{"encoded", sign(), payload, nil},
+		{"unencoded", sign(jwthelper.DetachedUnencoded(true)), payload, nil},
+		{"tampered payload", sign(), "$.03", jwthelper.ErrSignatureInvalid},
+		{"tampered unencoded payload", sign(jwthelper.DetachedUnencoded(true)), "$.03", jwthelper.ErrSignatureInvalid},
+		{"b64 false without crit", signHeader(`{"alg":"HS256","b64":false}`), payload, jwthelper.ErrInvalidHeader},
+		{"unknown crit", signHeader(`{"alg":"HS256","b64":false,"crit":["b64","exp"]}`), payload, jwthelper.ErrUnsupportedCrit},
+		{"empty crit", signHeader(`{"alg":"HS256","b64":false,"crit":[]}`), payload, jwthelper.ErrInvalidHeader},
+		{"b64 not boolean", signHeader(`{"alg":"HS256","b64":"false","crit":["b64"]}`), payload, jwthelper.ErrInvalidHeader},
+		{"not detached", "eyJhbGciOiJIUzI1NiJ9.JC4wMg.sig", payload, jwthelper.ErrNotDetached},
+		{"other alg", signHeader(`{"alg":"HS384","b64":false,"crit":["b64"]}`), payload, jwthelper.ErrAlgNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.VerifyDetached(tt.token, strings.NewReader(tt.payload))
+			if !errors.Is(err, tt.err) {
+				t.Errorf("VerifyDetached() error: %v, want %v", err, tt.err)
+			}
+			if errors.Is(tt.err, jwthelper.ErrInvalidHeader) || errors.Is(tt.err, jwthelper.ErrUnsupportedCrit) {
+				if !errors.Is(err, jwthelper.ErrMalformed) {
+					t.Errorf("VerifyDetached() error: %v, want %v", err, jwthelper.ErrMalformed)
+				}
+			}
+		})
+	}
+}
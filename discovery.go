@@ -0,0 +1,155 @@
+package jwthelper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DiscoveryPath is the path of OpenID Provider configuration document.
+// See https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfig
+const DiscoveryPath = "/.well-known/openid-configuration"
+
+const (
+	// fetchTimeout is the timeout of fetching jwks_uri when parsing tokens.
+	fetchTimeout = 30 * time.Second
+	// maxFetchSize is the max size of fetched documents.
+	maxFetchSize = 1 << 20
+)
+
+// ProviderMetadata is the OpenID Provider metadata.
+// See https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type ProviderMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                     string   `json:"token_endpoint,omitempty"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint,omitempty"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported                   []string `json:"claims_supported,omitempty"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+}
+
+var (
+	// ErrHTTPStatus represents the error of unexpected HTTP status code.
+	ErrHTTPStatus = fmt.Errorf("unexpected HTTP status")
+	// ErrInvalidMetadata represents the error of invalid OpenID Provider metadata.
+	ErrInvalidMetadata = fmt.Errorf("invalid provider metadata")
+	// ErrIssuerMismatch represents the error of "issuer" in the metadata which is not the issuer URL.
+	// It's wrapped with ErrInvalidMetadata.
+	ErrIssuerMismatch = fmt.Errorf("issuer mismatch")
+)
+
+// fetch gets the document of the URL.
+// client: HTTP client. http.DefaultClient is used if it's nil.
+func fetch(ctx context.Context, client *http.Client, u string) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %v %v", ErrHTTPStatus, resp.Status, u)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxFetchSize))
+}
+
+// checkHTTPS returns ErrInvalidMetadata if the URL is not an https URL without query or fragment.
+func checkHTTPS(name, u string) error {
+	v, err := url.Parse(u)
+	if err != nil || v.Scheme != "https" || v.Host == "" || v.RawQuery != "" || v.Fragment != "" {
+		return fmt.Errorf("%w: %v %q is not an https URL", ErrInvalidMetadata, name, u)
+	}
+	return nil
+}
+
+// Discover fetches the OpenID Provider metadata of the issuer.
+//
+// ctx: context for fetching the metadata.
+// issuerURL: https URL of the issuer. e.g. "https://accounts.example.com".
+// client: HTTP client. http.DefaultClient is used if it's nil.
+// comments:
+// "issuer" in the metadata must be identical to issuerURL.
+// "jwks_uri" must be an https URL.
+func Discover(ctx context.Context, issuerURL string, client *http.Client) (*ProviderMetadata, error) {
+	if err := checkHTTPS("issuer", issuerURL); err != nil {
+		return nil, err
+	}
+
+	buf, err := fetch(ctx, client, strings.TrimSuffix(issuerURL, "/")+DiscoveryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &ProviderMetadata{}
+	if err = json.Unmarshal(buf, m); err != nil {
+		return nil, wrapError(ErrInvalidMetadata, err)
+	}
+
+	// See https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfigurationValidation
+	if m.Issuer != issuerURL {
+		return nil, wrapError(ErrInvalidMetadata, fmt.Errorf("%w: %q", ErrIssuerMismatch, m.Issuer))
+	}
+	if err = checkHTTPS("jwks_uri", m.JWKSURI); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// NewParserFromDiscovery creates a parser for the tokens issued by the OpenID Provider.
+//
+// ctx: context for fetching the metadata and JWK Set.
+// issuerURL: https URL of the issuer. e.g. "https://accounts.example.com".
+// client: HTTP client. http.DefaultClient is used if it's nil.
+// options: See NewJWKSParser().
+// comments:
+// It fetches the metadata by Discover() and the JWK Set of "jwks_uri".
+// Tokens are rejected if "iss" claim is not the issuer,
+// or "alg" is not one of "id_token_signing_alg_values_supported"("RS256" if absent).
+// Use NewIDTokenVerifier() with the parser to verify ID Tokens.
+func NewParserFromDiscovery(ctx context.Context, issuerURL string, client *http.Client, options ...ParserOption) (*JWKSParser, error) {
+	m, err := Discover(ctx, issuerURL, client)
+	if err != nil {
+		return nil, err
+	}
+
+	// "none" is never allowed.
+	algs := []string{}
+	for _, alg := range m.IDTokenSigningAlgValuesSupported {
+		if alg != "none" {
+			algs = append(algs, alg)
+		}
+	}
+	if len(m.IDTokenSigningAlgValuesSupported) == 0 {
+		algs = append(algs, "RS256")
+	}
+	if len(algs) == 0 {
+		return nil, fmt.Errorf("%w: no id_token_signing_alg_values_supported", ErrInvalidMetadata)
+	}
+
+	options = append([]ParserOption{
+		ParserAllowedAlgs(algs...),
+		ParserIssuer(m.Issuer),
+	}, options...)
+	return NewRemoteJWKSParser(ctx, m.JWKSURI, client, options...)
+}
@@ -0,0 +1,258 @@
+package jwthelper_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/northbright/jwthelper"
+)
+
+// testOP is an OpenID Provider serving the discovery metadata and JWK Set.
+type testOP struct {
+	*httptest.Server
+	m        sync.Mutex
+	metadata map[string]interface{}
+	jwks     string
+	// fetches is the number of JWK Set requests.
+	fetches int
+}
+
+// newTestOP starts an OpenID Provider with testJWKS.
+// algs: "id_token_signing_alg_values_supported".
+func newTestOP(algs ...string) *testOP {
+	op := &testOP{jwks: testJWKS}
+	mux := http.NewServeMux()
+	mux.HandleFunc(jwthelper.DiscoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		op.m.Lock()
+		defer op.m.Unlock()
+		json.NewEncoder(w).Encode(op.metadata)
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		op.m.Lock()
+		defer op.m.Unlock()
+		op.fetches++
+		w.Write([]byte(op.jwks))
+	})
+	op.Server = httptest.NewTLSServer(mux)
+	op.metadata = map[string]interface{}{
+		"issuer":                                op.URL,
+		"jwks_uri":                              op.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": algs,
+	}
+	return op
+}
+
+// set sets the metadata parameter.
+func (op *testOP) set(name string, v interface{}) {
+	op.m.Lock()
+	defer op.m.Unlock()
+	op.metadata[name] = v
+}
+
+// setJWKS replaces the JWK Set.
+func (op *testOP) setJWKS(jwks string) {
+	op.m.Lock()
+	defer op.m.Unlock()
+	op.jwks = jwks
+}
+
+// fetchCount returns the number of JWK Set requests.
+func (op *testOP) fetchCount() int {
+	op.m.Lock()
+	defer op.m.Unlock()
+	return op.fetches
+}
+
+func ExampleNewParserFromDiscovery() {
+	op := newTestOP("ES256", "RS256")
+	defer op.Close()
+
+	// Use http.DefaultClient or nil for a real OpenID Provider.
+	p, err := jwthelper.NewParserFromDiscovery(context.Background(), op.URL, op.Client())
+	if err != nil {
+		log.Printf("NewParserFromDiscovery() error: %v", err)
+		return
+	}
+
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-1"))
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+
+	str, err := s.SignedString(
+		jwthelper.NewClaim("iss", op.URL),
+		jwthelper.NewClaim("sub", "frank"),
+	)
+	if err != nil {
+		log.Printf("SignedString() error: %v", err)
+		return
+	}
+
+	claims, err := p.Parse(str)
+	fmt.Println(claims["sub"], err)
+
+	// Output:
+	// frank <nil>
+}
+
+func TestDiscover(t *testing.T) {
+	op := newTestOP("ES256", "none")
+	defer op.Close()
+	ctx := context.Background()
+
+	m, err := jwthelper.Discover(ctx, op.URL, op.Client())
+	if err != nil {
+		t.Fatalf("Discover() error: %v", err)
+	}
+	if m.Issuer != op.URL || m.JWKSURI != op.URL+"/jwks" || len(m.IDTokenSigningAlgValuesSupported) != 2 {
+		t.Errorf("Discover() = %+v", m)
+	}
+
+	// Issuer URL must be https.
+	if _, err = jwthelper.Discover(ctx, strings.Replace(op.URL, "https", "http", 1), op.Client()); !errors.Is(err, jwthelper.ErrInvalidMetadata) {
+		t.Errorf("Discover(http) error: %v, want %v", err, jwthelper.ErrInvalidMetadata)
+	}
+
+	// Issuer with trailing slash is not identical to the issuer in the metadata.
+	if _, err = jwthelper.Discover(ctx, op.URL+"/", op.Client()); !errors.Is(err, jwthelper.ErrIssuerMismatch) {
+		t.Errorf("Discover(trailing slash) error: %v, want %v", err, jwthelper.ErrIssuerMismatch)
+	}
+
+	op.set("issuer", "https://evil.example.com")
+	if _, err = jwthelper.Discover(ctx, op.URL, op.Client()); !errors.Is(err, jwthelper.ErrIssuerMismatch) || !errors.Is(err, jwthelper.ErrInvalidMetadata) {
+		t.Errorf("Discover(issuer mismatch) error: %v, want %v", err, jwthelper.ErrIssuerMismatch)
+	}
+	op.set("issuer", op.URL)
+
+	op.set("jwks_uri", "http://"+strings.TrimPrefix(op.URL, "https://")+"/jwks")
+	if _, err = jwthelper.Discover(ctx, op.URL, op.Client()); !errors.Is(err, jwthelper.ErrInvalidMetadata) {
+		t.Errorf("Discover(http jwks_uri) error: %v, want %v", err, jwthelper.ErrInvalidMetadata)
+	}
+	op.set("jwks_uri", op.URL+"/not-found")
+	if _, err = jwthelper.NewParserFromDiscovery(ctx, op.URL, op.Client()); !errors.Is(err, jwthelper.ErrHTTPStatus) {
+		t.Errorf("NewParserFromDiscovery(not found) error: %v, want %v", err, jwthelper.ErrHTTPStatus)
+	}
+	op.set("jwks_uri", op.URL+"/jwks")
+
+	// Only "none" is supported.
+	op.set("id_token_signing_alg_values_supported", []string{"none"})
+	if _, err = jwthelper.NewParserFromDiscovery(ctx, op.URL, op.Client()); !errors.Is(err, jwthelper.ErrInvalidMetadata) {
+		t.Errorf("NewParserFromDiscovery(none) error: %v, want %v", err, jwthelper.ErrInvalidMetadata)
+	}
+}
+
+func TestNewParserFromDiscovery(t *testing.T) {
+	op := newTestOP("RS256", "EdDSA")
+	defer op.Close()
+
+	p, err := jwthelper.NewParserFromDiscovery(context.Background(), op.URL, op.Client())
+	if err != nil {
+		t.Fatalf("NewParserFromDiscovery() error: %v", err)
+	}
+
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-1"))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	str, err := s.SignedString(jwthelper.NewClaim("iss", op.URL))
+	if err != nil {
+		t.Fatalf("SignedString() error: %v", err)
+	}
+
+	// "ec-1" is bound to ES256 but it's not supported by the provider.
+	if _, err = p.Parse(str); !errors.Is(err, jwthelper.ErrAlgNotAllowed) {
+		t.Errorf("Parse(ES256) error: %v, want %v", err, jwthelper.ErrAlgNotAllowed)
+	}
+
+	op.set("id_token_signing_alg_values_supported", []string{"ES256"})
+	if p, err = jwthelper.NewParserFromDiscovery(context.Background(), op.URL, op.Client()); err != nil {
+		t.Fatalf("NewParserFromDiscovery() error: %v", err)
+	}
+	if _, err = p.Parse(str); err != nil {
+		t.Errorf("Parse() error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		claims []jwthelper.Claim
+	}{
+		{"other issuer", []jwthelper.Claim{jwthelper.NewClaim("iss", "https://evil.example.com")}},
+		{"no issuer", []jwthelper.Claim{jwthelper.NewClaim("sub", "frank")}},
+		{"issuer not string", []jwthelper.Claim{jwthelper.NewClaim("iss", 1)}},
+	}
+	for _, tt := range tests {
+		str, err := s.SignedString(tt.claims...)
+		if err != nil {
+			t.Fatalf("SignedString() error: %v", err)
+		}
+		if _, err = p.Parse(str); !errors.Is(err, jwthelper.ErrInvalidIssuer) {
+			t.Errorf("%v: Parse() error: %v, want %v", tt.name, err, jwthelper.ErrInvalidIssuer)
+		}
+	}
+}
+
+func TestRemoteJWKSParserRotation(t *testing.T) {
+	op := newTestOP("ES256")
+	defer op.Close()
+
+	p, err := jwthelper.NewRemoteJWKSParser(context.Background(), op.URL+"/jwks", op.Client())
+	if err != nil {
+		t.Fatalf("NewRemoteJWKSParser() error: %v", err)
+	}
+
+	// The provider rotates "ec-1" to "ec-2".
+	op.setJWKS(strings.Replace(testJWKS, `"kid":"ec-1"`, `"kid":"ec-2"`, 1))
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-2"))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	str, err := s.SignedString(jwthelper.NewClaim("sub", "frank"))
+	if err != nil {
+		t.Fatalf("SignedString() error: %v", err)
+	}
+
+	// The JWK Set is not fetched again within the refresh interval.
+	if _, err = p.Parse(str); !errors.Is(err, jwthelper.ErrUnknownKID) {
+		t.Errorf("Parse() error: %v, want %v", err, jwthelper.ErrUnknownKID)
+	}
+	if n := op.fetchCount(); n != 1 {
+		t.Errorf("fetches = %v, want 1", n)
+	}
+
+	// Unknown "kid" triggers fetching after the refresh interval.
+	p.SetRefreshInterval(0)
+	if _, err = p.Parse(str); err != nil {
+		t.Errorf("Parse() error: %v", err)
+	}
+	if n := op.fetchCount(); n != 2 {
+		t.Errorf("fetches = %v, want 2", n)
+	}
+
+	// Known "kid" never triggers fetching.
+	if _, err = p.Parse(str); err != nil {
+		t.Errorf("Parse() error: %v", err)
+	}
+	if n := op.fetchCount(); n != 2 {
+		t.Errorf("fetches = %v, want 2", n)
+	}
+
+	// Keys are kept if the JWK Set has no usable keys.
+	op.setJWKS(`{"keys":[]}`)
+	if err = p.Refresh(context.Background()); !errors.Is(err, jwthelper.ErrNoKeys) {
+		t.Errorf("Refresh() error: %v, want %v", err, jwthelper.ErrNoKeys)
+	}
+	if _, err = p.Parse(str); err != nil {
+		t.Errorf("Parse() error: %v", err)
+	}
+}
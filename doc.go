@@ -1,6 +1,7 @@
 /*
 
-Package jwthelper provides JWT(JSON Web Token) functions based on jwt-go.
+Package jwthelper provides JWT(JSON Web Token) functions.
+It has no third-party dependencies: the JOSE(JWS) core only uses the Go standard library.
 
 */
 package jwthelper
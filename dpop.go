@@ -0,0 +1,459 @@
+package jwthelper
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/northbright/jwthelper/internal/jose"
+)
+
+// DPoPProofType is the "typ" header parameter of DPoP proofs.
+// See https://www.rfc-editor.org/rfc/rfc9449#section-4.2
+const DPoPProofType = "dpop+jwt"
+
+// DPoPProver creates DPoP proofs(RFC 9449) with a private key for the client.
+// The access tokens issued for the client are bound to the public key.
+type DPoPProver struct {
+	signer *Signer
+	jwk    *jwk
+	jkt    string
+}
+
+// DPoPProof is the verified DPoP proof.
+type DPoPProof struct {
+	// Thumbprint is the JWK Thumbprint(RFC 7638) of the public key in "jwk" header parameter.
+	Thumbprint string
+	// ID is "jti" claim.
+	ID string
+	// Method is "htm" claim.
+	Method string
+	// URI is "htu" claim.
+	URI string
+	// IssuedAt is "iat" claim.
+	IssuedAt time.Time
+	// Claims stores all claims including the claims above. e.g. "nonce".
+	Claims Claims
+}
+
+// DPoPVerifier verifies DPoP proofs(RFC 9449) for the resource server or authorization server.
+// It's safe for concurrent use.
+type DPoPVerifier struct {
+	window     time.Duration
+	algs       []string
+	seen       SeenStore
+	requestURL func(r *http.Request) string
+}
+
+// DPoPOption represents the option for verifying DPoP proofs.
+// Use option helper functions to set options:
+// e.g. DPoPWindow(), DPoPAllowedAlgs()
+type DPoPOption struct {
+	f func(v *DPoPVerifier)
+}
+
+var (
+	// ErrInvalidDPoPProof represents the error of invalid DPoP proof.
+	// The error of the rule is wrapped with it.
+	// e.g. ErrInvalidTokenType, ErrAlgNotAllowed, ErrSignatureInvalid, ErrClaimNotFound, ErrTokenReplayed.
+	ErrInvalidDPoPProof = fmt.Errorf("invalid DPoP proof")
+	// ErrDPoPMismatch represents the error of "htm" or "htu" which does not match the request.
+	// It's wrapped with ErrInvalidDPoPProof.
+	ErrDPoPMismatch = fmt.Errorf("DPoP proof does not match request")
+	// ErrDPoPProofNotFresh represents the error of "iat" which is out of the window.
+	// It's wrapped with ErrInvalidDPoPProof.
+	ErrDPoPProofNotFresh = fmt.Errorf("DPoP proof is not fresh")
+	// ErrDPoPKeyMismatch represents the error of access token which is not bound to the key of the DPoP proof.
+	ErrDPoPKeyMismatch = fmt.Errorf("DPoP proof key does not match cnf.jkt")
+	// ErrNoDPoPProof represents the error of no DPoP proof or more than one proofs in the request.
+	ErrNoDPoPProof = fmt.Errorf("no single DPoP proof in request")
+)
+
+// NewDPoPProver creates a DPoP prover with given signing key.
+//
+// k: private key created by NewSigningKey(). HMAC keys are refused.
+func NewDPoPProver(k *Key) (*DPoPProver, error) {
+	s, err := NewSignerFromKey(k)
+	if err != nil {
+		return nil, err
+	}
+
+	j, err := newJWK(k, "")
+	if err != nil {
+		return nil, wrapError(ErrSymmetricKey, err)
+	}
+	j.Alg, j.Use = "", ""
+
+	jkt, err := k.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	return &DPoPProver{signer: s, jwk: j, jkt: jkt}, nil
+}
+
+// Thumbprint returns the JWK Thumbprint of the public key.
+// Authorization servers bind access tokens to it by "cnf" claim. See DPoPConfirmation().
+func (p *DPoPProver) Thumbprint() string {
+	return p.jkt
+}
+
+// htu returns the URI without query and fragment.
+// Scheme and host are case-insensitive(RFC 3986 section 6.2.2.1).
+func htu(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%q is not an absolute URI", uri)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.RawQuery, u.ForceQuery, u.Fragment, u.RawFragment = "", false, "", ""
+	return u.String(), nil
+}
+
+// ath returns the "ath" claim: base64url encoding of the SHA-256 hash of the access token.
+func ath(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return encodeSegment(sum[:])
+}
+
+// Proof returns the DPoP proof of the request.
+//
+// method: HTTP method of the request. e.g. "POST".
+// uri: URI of the request. Query and fragment are removed.
+// accessToken: access token sent with the proof. Use empty string for the token endpoint.
+// claims: extra claims. e.g. NewClaim("nonce", nonce) provided by the server.
+func (p *DPoPProver) Proof(method, uri, accessToken string, claims ...Claim) (string, error) {
+	u, err := htu(uri)
+	if err != nil {
+		return "", err
+	}
+	jti, err := newJTI()
+	if err != nil {
+		return "", err
+	}
+
+	c := newClaims()
+	for _, claim := range claims {
+		claim.f(&c)
+	}
+	c.claims["jti"] = jti
+	c.claims["htm"] = method
+	c.claims["htu"] = u
+	c.claims["iat"] = time.Now().Unix()
+	if accessToken != "" {
+		c.claims["ath"] = ath(accessToken)
+	}
+
+	header := map[string]interface{}{
+		"typ": DPoPProofType,
+		"alg": p.signer.key.Alg(),
+		"jwk": p.jwk,
+	}
+	return p.signer.sign(header, c.claims)
+}
+
+// DPoPConfirmation returns the "cnf" claim which binds the token to the DPoP key.
+//
+// jkt: JWK Thumbprint of the DPoP proof key. e.g. DPoPProof.Thumbprint.
+// See https://www.rfc-editor.org/rfc/rfc9449#section-6.1
+func DPoPConfirmation(jkt string) Claim {
+	return NewClaim("cnf", map[string]interface{}{"jkt": jkt})
+}
+
+// confirmationJKT returns "jkt" of "cnf" claim.
+func confirmationJKT(claims map[string]interface{}) (string, bool) {
+	cnf, ok := claims["cnf"].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	jkt, ok := cnf["jkt"].(string)
+	return jkt, ok
+}
+
+// DPoPWindow returns the option for the window of "iat".
+// Proofs issued earlier or later than the window from now are rejected.
+// "jti" is recorded until "iat" + window. It's 1 minute by default.
+func DPoPWindow(d time.Duration) DPoPOption {
+	return DPoPOption{func(v *DPoPVerifier) {
+		v.window = d
+	}}
+}
+
+// DPoPAllowedAlgs returns the option for allowed algs of proofs.
+// All asymmetric algs are allowed by default.
+func DPoPAllowedAlgs(algs ...string) DPoPOption {
+	return DPoPOption{func(v *DPoPVerifier) {
+		v.algs = algs
+	}}
+}
+
+// DPoPReplayStore returns the option for the seen store of "jti".
+// A MemorySeenStore is used by default. Use a shared store for multiple instances.
+func DPoPReplayStore(store SeenStore) DPoPOption {
+	return DPoPOption{func(v *DPoPVerifier) {
+		v.seen = store
+	}}
+}
+
+// DPoPRequestURL returns the option for the function which returns the URL of the request
+// used to check "htu" in DPoPMiddleware(). e.g. for servers behind a reverse proxy.
+// By default, it's built from the TLS state, Host header and the path of the request.
+func DPoPRequestURL(f func(r *http.Request) string) DPoPOption {
+	return DPoPOption{func(v *DPoPVerifier) {
+		v.requestURL = f
+	}}
+}
+
+// NewDPoPVerifier creates a DPoP proof verifier.
+//
+// options: variadic options returned by option helper functions.
+// e.g. DPoPWindow(30 * time.Second)
+func NewDPoPVerifier(options ...DPoPOption) *DPoPVerifier {
+	v := &DPoPVerifier{
+		window: time.Minute,
+		seen:   NewMemorySeenStore(),
+		requestURL: func(r *http.Request) string {
+			scheme := "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+			return scheme + "://" + r.Host + r.URL.EscapedPath()
+		},
+	}
+	for _, op := range options {
+		op.f(v)
+	}
+	return v
+}
+
+// invalidProof returns the error wrapped with ErrInvalidDPoPProof.
+func invalidProof(err error) error {
+	return wrapError(ErrInvalidDPoPProof, err)
+}
+
+// proofKey returns the public key in "jwk" header parameter bound to the "alg".
+func (v *DPoPVerifier) proofKey(header map[string]interface{}) (*Key, error) {
+	alg, _ := header["alg"].(string)
+	m, ok := jose.Lookup(alg)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrAlgNotAllowed, alg)
+	}
+	if _, ok = m.(*jose.HMAC); ok || (v.algs != nil && !contains(v.algs, alg)) {
+		return nil, fmt.Errorf("%w: %q", ErrAlgNotAllowed, alg)
+	}
+
+	j, ok := header["jwk"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: jwk", ErrInvalidHeader)
+	}
+	// The key must not be a private key(RFC 9449 section 4.3).
+	for _, name := range []string{"d", "p", "q", "dp", "dq", "qi", "k"} {
+		if _, ok := j[name]; ok {
+			return nil, fmt.Errorf("%w: jwk has private parameter %q", ErrInvalidHeader, name)
+		}
+	}
+
+	pub := map[string]interface{}{}
+	for name, value := range j {
+		pub[name] = value
+	}
+	pub["alg"] = alg
+	buf, err := json.Marshal(pub)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWK(buf)
+}
+
+// Verify verifies the DPoP proof of the request.
+//
+// proof: value of "DPoP" header.
+// method: HTTP method of the request.
+// uri: URI of the request. Query and fragment are ignored.
+// accessToken: access token sent with the proof. Use empty string for the token endpoint.
+// comments:
+// It follows the checks of https://www.rfc-editor.org/rfc/rfc9449#section-4.3
+// except "nonce", which can be checked with DPoPProof.Claims.
+// All errors are wrapped with ErrInvalidDPoPProof.
+// Use DPoPMiddleware() to verify the access token bound to the proof key.
+func (v *DPoPVerifier) Verify(proof, method, uri, accessToken string) (*DPoPProof, error) {
+	parts, err := jose.Split(proof)
+	if err != nil {
+		return nil, invalidProof(wrapError(ErrMalformed, ErrInvalidPartNum))
+	}
+	header, err := decodeSegment(parts[0], false)
+	if err != nil {
+		return nil, invalidProof(err)
+	}
+
+	if typ, _ := header["typ"].(string); typ != DPoPProofType {
+		return nil, invalidProof(fmt.Errorf("%w: %q", ErrInvalidTokenType, typ))
+	}
+	k, err := v.proofKey(header)
+	if err != nil {
+		return nil, invalidProof(err)
+	}
+
+	sig, err := jose.DecodeSegment(parts[2])
+	if err != nil {
+		return nil, invalidProof(wrapError(ErrMalformed, err))
+	}
+	if err = k.method.Verify(jose.SigningInput(parts[0], parts[1]), sig, k.verifyingKey()); err != nil {
+		return nil, invalidProof(ErrSignatureInvalid)
+	}
+
+	claims, err := decodeSegment(parts[1], true)
+	if err != nil {
+		return nil, invalidProof(err)
+	}
+
+	c := Claims(claims)
+	p := &DPoPProof{Claims: c}
+	for name, dst := range map[string]*string{
+		"jti": &p.ID,
+		"htm": &p.Method,
+		"htu": &p.URI,
+	} {
+		if *dst, err = c.String(name); err != nil {
+			return nil, invalidProof(err)
+		}
+	}
+	if p.IssuedAt, err = c.Time("iat"); err != nil {
+		return nil, invalidProof(err)
+	}
+
+	if p.Method != method {
+		return nil, invalidProof(fmt.Errorf("%w: htm %q", ErrDPoPMismatch, p.Method))
+	}
+	want, err := htu(uri)
+	if err != nil {
+		return nil, invalidProof(err)
+	}
+	if got, err := htu(p.URI); err != nil || got != want {
+		return nil, invalidProof(fmt.Errorf("%w: htu %q", ErrDPoPMismatch, p.URI))
+	}
+
+	if accessToken != "" {
+		got, err := c.String("ath")
+		if err != nil {
+			return nil, invalidProof(err)
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(ath(accessToken))) != 1 {
+			return nil, invalidProof(fmt.Errorf("%w: ath", ErrHashMismatch))
+		}
+	}
+
+	now := time.Now()
+	if p.IssuedAt.Before(now.Add(-v.window)) || p.IssuedAt.After(now.Add(v.window)) {
+		return nil, invalidProof(ErrDPoPProofNotFresh)
+	}
+
+	if p.Thumbprint, err = k.Thumbprint(); err != nil {
+		return nil, invalidProof(err)
+	}
+
+	// Record "jti" at last so that rejected proofs are not recorded.
+	// Proofs are accepted until iat + window.
+	seen, err := v.seen.Seen(p.Thumbprint+":"+p.ID, p.IssuedAt.Add(v.window))
+	if err != nil {
+		return nil, err
+	}
+	if seen {
+		return nil, invalidProof(ErrTokenReplayed)
+	}
+	return p, nil
+}
+
+// DPoPHeader returns the DPoP proof in "DPoP" header of the request.
+// It returns ErrNoDPoPProof if there's no proof or more than one proofs.
+func DPoPHeader(r *http.Request) (string, error) {
+	proofs := r.Header.Values("DPoP")
+	if len(proofs) != 1 || proofs[0] == "" {
+		return "", ErrNoDPoPProof
+	}
+	return proofs[0], nil
+}
+
+// CheckDPoPBinding checks that the access token is bound to the key of the verified DPoP proof.
+// It returns ErrDPoPKeyMismatch if "jkt" in "cnf" claim of the access token is absent
+// or not the thumbprint of the proof key.
+func CheckDPoPBinding(claims map[string]interface{}, proof *DPoPProof) error {
+	jkt, ok := confirmationJKT(claims)
+	if !ok || subtle.ConstantTimeCompare([]byte(proof.Thumbprint), []byte(jkt)) != 1 {
+		return ErrDPoPKeyMismatch
+	}
+	return nil
+}
+
+// dpopError responds the error with "WWW-Authenticate" header.
+// See https://www.rfc-editor.org/rfc/rfc9449#section-7.1
+func (v *DPoPVerifier) dpopError(w http.ResponseWriter, code string) {
+	challenge := "DPoP"
+	if code != "" {
+		challenge += fmt.Sprintf(` error="%s",`, code)
+	}
+	algs := v.algs
+	if algs == nil {
+		algs = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+	}
+	challenge += fmt.Sprintf(` algs="%s"`, strings.Join(algs, " "))
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// DPoPMiddleware returns the middleware which verifies the DPoP-bound access token and the DPoP proof
+// and stores the claims of the access token in the request context before calling next.
+// Use ClaimsFromContext() to get the claims.
+//
+// p: parser of the access tokens.
+// v: DPoP proof verifier.
+// comments:
+// The access token is sent with "DPoP" authentication scheme in "Authorization" header
+// and the proof is sent in "DPoP" header(RFC 9449 section 7.1).
+// "jkt" in "cnf" claim of the access token must be the thumbprint of the proof key.
+// It responds 401 with "WWW-Authenticate" header if the token or proof is missing or invalid.
+func DPoPMiddleware(p TokenParser, v *DPoPVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := authToken(r, "DPoP")
+			if !ok {
+				v.dpopError(w, "")
+				return
+			}
+			proof, err := DPoPHeader(r)
+			if err != nil {
+				v.dpopError(w, "invalid_dpop_proof")
+				return
+			}
+
+			claims, err := p.Parse(token)
+			if err != nil {
+				v.dpopError(w, "invalid_token")
+				return
+			}
+			if _, ok = confirmationJKT(claims); !ok {
+				v.dpopError(w, "invalid_token")
+				return
+			}
+
+			verified, err := v.Verify(proof, r.Method, v.requestURL(r), token)
+			if err != nil {
+				v.dpopError(w, "invalid_dpop_proof")
+				return
+			}
+			if err = CheckDPoPBinding(claims, verified); err != nil {
+				v.dpopError(w, "invalid_token")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package jwthelper_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleDPoPMiddleware() {
+	// Client.
+	k, err := jwthelper.NewSigningKey("ES256", es256PrivPEM)
+	if err != nil {
+		log.Printf("NewSigningKey() error: %v", err)
+		return
+	}
+	prover, err := jwthelper.NewDPoPProver(k)
+	if err != nil {
+		log.Printf("NewDPoPProver() error: %v", err)
+		return
+	}
+
+	// Authorization server binds the access token to the thumbprint of the DPoP key.
+	s, err := jwthelper.NewSigner("HS256", []byte(strings.Repeat("s", 32)))
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+	accessToken, err := s.SignedString(
+		jwthelper.NewClaim("sub", "frank"),
+		jwthelper.DPoPConfirmation(prover.Thumbprint()),
+	)
+	if err != nil {
+		log.Printf("SignedString() error: %v", err)
+		return
+	}
+
+	// Resource server.
+	p, err := jwthelper.NewParser("HS256", []byte(strings.Repeat("s", 32)))
+	if err != nil {
+		log.Printf("NewParser() error: %v", err)
+		return
+	}
+	h := jwthelper.DPoPMiddleware(p, jwthelper.NewDPoPVerifier())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := jwthelper.ClaimsFromContext(r.Context())
+		fmt.Fprint(w, claims["sub"])
+	}))
+
+	// Request with the DPoP-bound access token and the proof.
+	proof, err := prover.Proof("GET", "https://api.example.com/resource?id=1", accessToken)
+	if err != nil {
+		log.Printf("Proof() error: %v", err)
+		return
+	}
+	r := httptest.NewRequest("GET", "https://api.example.com/resource?id=1", nil)
+	r.Header.Set("Authorization", "DPoP "+accessToken)
+	r.Header.Set("DPoP", proof)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	fmt.Println(w.Code, w.Body.String())
+
+	// The proof can not be replayed.
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	fmt.Println(w.Code, w.Header().Get("WWW-Authenticate"))
+
+	// Output:
+	// 200 frank
+	// 401 DPoP error="invalid_dpop_proof", algs="RS256 RS384 RS512 PS256 PS384 PS512 ES256 ES384 ES512 EdDSA"
+}
+
+func TestThumbprint(t *testing.T) {
+	tests := []struct {
+		jwk string
+		jkt string
+	}{
+		// RFC 7638 section 3.1.
+		{`{"kty":"RSA","e":"AQAB","alg":"RS256","kid":"2011-04-29",
+		   "n":"0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"}`,
+			"NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"},
+		// RFC 9449 section 6.1.
+		{`{"kty":"EC","crv":"P-256",
+		   "x":"l8tFrhx-34tV3hRICRDY9zCkDlpBhF42UQUfWVAWBFs",
+		   "y":"9VE4jf_Ok_o64zbTTlcuNJajHmt6v9TDVrU0CdvGRDA"}`,
+			"0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I"},
+		// RFC 8037 appendix A.3.
+		{`{"kty":"OKP","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`,
+			"kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"},
+	}
+
+	for _, tt := range tests {
+		k, err := jwthelper.ParseJWK([]byte(tt.jwk))
+		if err != nil {
+			t.Fatalf("ParseJWK() error: %v", err)
+		}
+		jkt, err := k.Thumbprint()
+		if err != nil {
+			t.Fatalf("Thumbprint() error: %v", err)
+		}
+		if jkt != tt.jkt {
+			t.Errorf("Thumbprint() = %v, want %v", jkt, tt.jkt)
+		}
+	}
+}
+
+func TestDPoPVerifier(t *testing.T) {
+	const uri = "https://api.example.com/resource"
+
+	k, err := jwthelper.NewSigningKey("ES256", es256PrivPEM)
+	if err != nil {
+		t.Fatalf("NewSigningKey() error: %v", err)
+	}
+	prover, err := jwthelper.NewDPoPProver(k)
+	if err != nil {
+		t.Fatalf("NewDPoPProver() error: %v", err)
+	}
+	s, _ := jwthelper.NewSignerFromKey(k)
+	jwk, err := k.PublicJWK()
+	if err != nil {
+		t.Fatalf("PublicJWK() error: %v", err)
+	}
+
+	// sign signs a proof with the header and claims overridden.
+	// Claims with nil value are removed.
+	now := time.Now()
+	sign := func(header, claims map[string]interface{}) string {
+		h := map[string]interface{}{"typ": "dpop+jwt", "jwk": json.RawMessage(jwk)}
+		m := map[string]interface{}{
+			"jti": fmt.Sprintf("jti-%v", time.Now().UnixNano()),
+			"htm": "GET",
+			"htu": uri,
+			"iat": now.Unix(),
+			"ath": "",
+		}
+		for k, v := range header {
+			h[k] = v
+		}
+		for k, v := range claims {
+			m[k] = v
+		}
+
+		c := []jwthelper.Claim{}
+		for k, v := range h {
+			c = append(c, jwthelper.NewHeader(k, v))
+		}
+		for k, v := range m {
+			if v != nil {
+				c = append(c, jwthelper.NewClaim(k, v))
+			}
+		}
+		str, err := s.SignedString(c...)
+		if err != nil {
+			t.Fatalf("SignedString() error: %v", err)
+		}
+		return str
+	}
+
+	hs, _ := jwthelper.NewSigner("HS256", []byte(strings.Repeat("s", 32)))
+	hsProof, _ := hs.SignedString(jwthelper.NewHeader("typ", "dpop+jwt"), jwthelper.NewHeader("jwk", map[string]string{"kty": "oct", "k": "c2VjcmV0"}))
+	privJWK := strings.Replace(string(jwk), `"kty"`, `"d":"jpsQnnGQmL-YBIffH1136cspYG6-0iY7X1fCE9-E9LI","kty"`, 1)
+
+	v := jwthelper.NewDPoPVerifier()
+	valid, err := prover.Proof("GET", uri+"?q=1#f", "access-token")
+	if err != nil {
+		t.Fatalf("Proof() error: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		proof       string
+		method      string
+		uri         string
+		accessToken string
+		err         error
+	}{
+		{"valid", valid, "GET", uri, "access-token", nil},
+		{"replayed", valid, "GET", uri, "access-token", jwthelper.ErrTokenReplayed},
+		{"host is case-insensitive", sign(nil, map[string]interface{}{"htu": "https://API.example.com/resource"}), "GET", uri + "?q=2", "", nil},
+		{"other method", sign(nil, nil), "POST", uri, "", jwthelper.ErrDPoPMismatch},
+		{"other URI", sign(nil, nil), "GET", uri + "/1", "", jwthelper.ErrDPoPMismatch},
+		{"no ath", sign(nil, map[string]interface{}{"ath": nil}), "GET", uri, "access-token", jwthelper.ErrClaimNotFound},
+		{"wrong ath", sign(nil, nil), "GET", uri, "access-token", jwthelper.ErrHashMismatch},
+		{"no jti", sign(nil, map[string]interface{}{"jti": nil}), "GET", uri, "", jwthelper.ErrClaimNotFound},
+		{"no htm", sign(nil, map[string]interface{}{"htm": nil}), "GET", uri, "", jwthelper.ErrClaimNotFound},
+		{"no iat", sign(nil, map[string]interface{}{"iat": nil}), "GET", uri, "", jwthelper.ErrClaimNotFound},
+		{"stale", sign(nil, map[string]interface{}{"iat": now.Add(-2 * time.Minute).Unix()}), "GET", uri, "", jwthelper.ErrDPoPProofNotFresh},
+		{"future", sign(nil, map[string]interface{}{"iat": now.Add(2 * time.Minute).Unix()}), "GET", uri, "", jwthelper.ErrDPoPProofNotFresh},
+		{"typ JWT", sign(map[string]interface{}{"typ": "JWT"}, nil), "GET", uri, "", jwthelper.ErrInvalidTokenType},
+		{"no jwk", sign(map[string]interface{}{"jwk": nil}, nil), "GET", uri, "", jwthelper.ErrInvalidHeader},
+		{"private jwk", sign(map[string]interface{}{"jwk": json.RawMessage(privJWK)}, nil), "GET", uri, "", jwthelper.ErrInvalidHeader},
+		{"HS256", hsProof, "GET", uri, "", jwthelper.ErrAlgNotAllowed},
+		{"other key", sign(map[string]interface{}{"jwk": json.RawMessage(`{"kty":"OKP","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`)}, nil), "GET", uri, "", jwthelper.ErrKeyAlgMismatch},
+		{"tampered", valid[:len(valid)-4] + "AAAA", "GET", uri, "access-token", jwthelper.ErrSignatureInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := v.Verify(tt.proof, tt.method, tt.uri, tt.accessToken)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Verify() error: %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if !errors.Is(err, jwthelper.ErrInvalidDPoPProof) {
+					t.Errorf("Verify() error: %v, want %v", err, jwthelper.ErrInvalidDPoPProof)
+				}
+				return
+			}
+			if p.Thumbprint != prover.Thumbprint() || p.Method != "GET" {
+				t.Errorf("proof = %+v", p)
+			}
+		})
+	}
+
+	// The key of the proof must be allowed.
+	v = jwthelper.NewDPoPVerifier(jwthelper.DPoPAllowedAlgs("EdDSA"))
+	if _, err = v.Verify(sign(nil, nil), "GET", uri, ""); !errors.Is(err, jwthelper.ErrAlgNotAllowed) {
+		t.Errorf("Verify() error: %v, want %v", err, jwthelper.ErrAlgNotAllowed)
+	}
+
+	if _, err = jwthelper.NewDPoPProver(nil); err == nil {
+		t.Errorf("NewDPoPProver(nil) error: nil")
+	}
+	hk, _ := jwthelper.NewSigningKey("HS256", []byte(strings.Repeat("s", 32)))
+	if _, err = jwthelper.NewDPoPProver(hk); !errors.Is(err, jwthelper.ErrSymmetricKey) {
+		t.Errorf("NewDPoPProver(HS256) error: %v, want %v", err, jwthelper.ErrSymmetricKey)
+	}
+}
+
+func TestDPoPMiddleware(t *testing.T) {
+	vk := newVectorKeys(t)
+	k, _ := jwthelper.NewSigningKey("ES256", es256PrivPEM)
+	prover, _ := jwthelper.NewDPoPProver(k)
+	ek, _ := jwthelper.NewSigningKey("EdDSA", vk.edPriv)
+	other, _ := jwthelper.NewDPoPProver(ek)
+
+	secret := []byte(strings.Repeat("s", 32))
+	s, _ := jwthelper.NewSigner("HS256", secret)
+	p, _ := jwthelper.NewParser("HS256", secret)
+	bound, _ := s.SignedString(jwthelper.NewClaim("sub", "frank"), jwthelper.DPoPConfirmation(prover.Thumbprint()))
+	unbound, _ := s.SignedString(jwthelper.NewClaim("sub", "frank"))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := jwthelper.DPoPMiddleware(p, jwthelper.NewDPoPVerifier())(next)
+
+	const uri = "https://api.example.com/resource"
+	proof := func(prover *jwthelper.DPoPProver, method, token string) string {
+		str, err := prover.Proof(method, uri, token)
+		if err != nil {
+			t.Fatalf("Proof() error: %v", err)
+		}
+		return str
+	}
+
+	tests := []struct {
+		name    string
+		auth    string
+		proofs  []string
+		status  int
+		errCode string
+	}{
+		{"valid", "DPoP " + bound, []string{proof(prover, "GET", bound)}, http.StatusOK, ""},
+		{"no token", "", []string{proof(prover, "GET", bound)}, http.StatusUnauthorized, ""},
+		{"bearer scheme", "Bearer " + bound, []string{proof(prover, "GET", bound)}, http.StatusUnauthorized, ""},
+		{"no proof", "DPoP " + bound, nil, http.StatusUnauthorized, "invalid_dpop_proof"},
+		{"two proofs", "DPoP " + bound, []string{proof(prover, "GET", bound), proof(prover, "GET", bound)}, http.StatusUnauthorized, "invalid_dpop_proof"},
+		{"unbound token", "DPoP " + unbound, []string{proof(prover, "GET", unbound)}, http.StatusUnauthorized, "invalid_token"},
+		{"other key", "DPoP " + bound, []string{proof(other, "GET", bound)}, http.StatusUnauthorized, "invalid_token"},
+		{"other method", "DPoP " + bound, []string{proof(prover, "POST", bound)}, http.StatusUnauthorized, "invalid_dpop_proof"},
+		{"ath of other token", "DPoP " + bound, []string{proof(prover, "GET", unbound)}, http.StatusUnauthorized, "invalid_dpop_proof"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", uri, nil)
+		if tt.auth != "" {
+			r.Header.Set("Authorization", tt.auth)
+		}
+		for _, p := range tt.proofs {
+			r.Header.Add("DPoP", p)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%v: status = %v, want %v", tt.name, w.Code, tt.status)
+		}
+		if tt.status == http.StatusOK {
+			continue
+		}
+		challenge := w.Header().Get("WWW-Authenticate")
+		if !strings.HasPrefix(challenge, "DPoP") || !strings.Contains(challenge, fmt.Sprintf(`error="%s"`, tt.errCode)) != (tt.errCode == "") {
+			t.Errorf("%v: WWW-Authenticate = %v, want error %q", tt.name, challenge, tt.errCode)
+		}
+	}
+
+	// DPoP-bound tokens can not be used as bearer tokens.
+	r := httptest.NewRequest("GET", uri, nil)
+	r.Header.Set("Authorization", "Bearer "+bound)
+	w := httptest.NewRecorder()
+	jwthelper.BearerMiddleware(p)(next).ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("BearerMiddleware() status = %v, want %v", w.Code, http.StatusUnauthorized)
+	}
+}
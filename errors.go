@@ -0,0 +1,64 @@
+package jwthelper
+
+import (
+	"fmt"
+	"time"
+)
+
+// Validation errors returned by Parser and MultipleKeysParser.
+// Use errors.Is() to check them and errors.As() to get
+// *TokenExpiredError and *TokenNotYetValidError.
+var (
+	// ErrTokenExpired represents the error of expired token.
+	ErrTokenExpired = fmt.Errorf("token is expired")
+	// ErrTokenNotYetValid represents the error of token used before "nbf" or "iat".
+	ErrTokenNotYetValid = fmt.Errorf("token is not valid yet")
+	// ErrSignatureInvalid represents the error of invalid signature.
+	ErrSignatureInvalid = fmt.Errorf("signature is invalid")
+	// ErrMalformed represents the error of malformed token.
+	ErrMalformed = fmt.Errorf("token is malformed")
+	// ErrAlgNotAllowed represents the error of "alg" which is not allowed by the parser.
+	ErrAlgNotAllowed = fmt.Errorf("alg is not allowed")
+	// ErrUnknownKID represents the error of "kid" which no key is found by.
+	ErrUnknownKID = fmt.Errorf("unknown kid")
+)
+
+// TokenExpiredError represents the error of expired token.
+// errors.Is(err, ErrTokenExpired) returns true for it.
+type TokenExpiredError struct {
+	// Expiry is the time of "exp" claim.
+	Expiry time.Time
+}
+
+// Error implements error interface.
+func (e *TokenExpiredError) Error() string {
+	return fmt.Sprintf("%v at %v", ErrTokenExpired, e.Expiry.Format(time.RFC3339))
+}
+
+// Is returns true if target is ErrTokenExpired.
+func (e *TokenExpiredError) Is(target error) bool {
+	return target == ErrTokenExpired
+}
+
+// TokenNotYetValidError represents the error of token used before "nbf" or "iat".
+// errors.Is(err, ErrTokenNotYetValid) returns true for it.
+type TokenNotYetValidError struct {
+	// NotBefore is the time of "nbf" claim, or "iat" claim if it's in the future.
+	NotBefore time.Time
+}
+
+// Error implements error interface.
+func (e *TokenNotYetValidError) Error() string {
+	return fmt.Sprintf("%v until %v", ErrTokenNotYetValid, e.NotBefore.Format(time.RFC3339))
+}
+
+// Is returns true if target is ErrTokenNotYetValid.
+func (e *TokenNotYetValidError) Is(target error) bool {
+	return target == ErrTokenNotYetValid
+}
+
+// wrapError wraps the cause with one of the validation errors.
+// Both are matched by errors.Is().
+func wrapError(err, cause error) error {
+	return fmt.Errorf("%w: %w", err, cause)
+}
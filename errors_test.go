@@ -0,0 +1,170 @@
+package jwthelper_test
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleTokenExpiredError() {
+	log.Printf("\n\nExample of validation errors")
+
+	s, err := jwthelper.NewSigner("RS256", []byte(rsaPrivPEM))
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+
+	exp := time.Unix(1500000000, 0)
+	str, err := s.SignedString(jwthelper.TimeClaim("exp", exp))
+	if err != nil {
+		log.Printf("SignedString() error: %v", err)
+		return
+	}
+
+	p, err := jwthelper.NewParser("RS256", []byte(rsaPubPEM))
+	if err != nil {
+		log.Printf("NewParser() error: %v", err)
+		return
+	}
+
+	_, err = p.Parse(str)
+	fmt.Println(errors.Is(err, jwthelper.ErrTokenExpired))
+
+	e := &jwthelper.TokenExpiredError{}
+	if errors.As(err, &e) {
+		fmt.Println(e.Expiry.Equal(exp))
+	}
+
+	// Tamper the signature.
+	_, err = p.Parse(str[:len(str)-4] + "AAAA")
+	fmt.Println(errors.Is(err, jwthelper.ErrSignatureInvalid))
+
+	// Token signed with other alg.
+	_, err = p.Parse(tokenStrSignedByVendor)
+	fmt.Println(errors.Is(err, jwthelper.ErrAlgNotAllowed))
+
+	_, err = p.Parse("not a token")
+	fmt.Println(errors.Is(err, jwthelper.ErrMalformed))
+
+	// Output:
+	// true
+	// true
+	// true
+	// true
+	// true
+}
+
+func TestValidationErrors(t *testing.T) {
+	s, err := jwthelper.NewSignerFromFile("RS384", "keys/rsa-priv-api.pem")
+	if err != nil {
+		t.Fatalf("NewSignerFromFile() error: %v", err)
+	}
+	// Same key with other alg.
+	rs256, err := jwthelper.NewSignerFromFile("RS256", "keys/rsa-priv-api.pem")
+	if err != nil {
+		t.Fatalf("NewSignerFromFile() error: %v", err)
+	}
+	ms := jwthelper.NewMultipleKeysSigner()
+	ms.Set("kid-api", s)
+	ms.Set("kid-other", s)
+	msRS256 := jwthelper.NewMultipleKeysSigner()
+	msRS256.Set("kid-api", rs256)
+
+	p, err := jwthelper.NewParserFromFile("RS384", "keys/rsa-pub-api.pem")
+	if err != nil {
+		t.Fatalf("NewParserFromFile() error: %v", err)
+	}
+	mp := jwthelper.NewMultipleKeysParser()
+	mp.Set("kid-api", p)
+
+	sign := func(ms *jwthelper.MultipleKeysSigner, kid string, claims ...jwthelper.Claim) string {
+		str, err := ms.SignedString(kid, claims...)
+		if err != nil {
+			t.Fatalf("SignedString() error: %v", err)
+		}
+		return str
+	}
+
+	now := time.Unix(time.Now().Unix(), 0)
+	exp := now.Add(-time.Minute)
+	nbf := now.Add(time.Hour)
+	valid := sign(ms, "kid-api", jwthelper.TimeClaim("exp", now.Add(time.Hour)))
+
+	sentinels := []error{
+		jwthelper.ErrTokenExpired,
+		jwthelper.ErrTokenNotYetValid,
+		jwthelper.ErrSignatureInvalid,
+		jwthelper.ErrMalformed,
+		jwthelper.ErrAlgNotAllowed,
+		jwthelper.ErrUnknownKID,
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		// err and multiErr are the errors of Parser and MultipleKeysParser.
+		err       error
+		multiErr  error
+		expiry    time.Time
+		notBefore time.Time
+	}{
+		{"valid", valid, nil, nil, time.Time{}, time.Time{}},
+		{"expired", sign(ms, "kid-api", jwthelper.TimeClaim("exp", exp)), jwthelper.ErrTokenExpired, jwthelper.ErrTokenExpired, exp, time.Time{}},
+		{"nbf in the future", sign(ms, "kid-api", jwthelper.TimeClaim("nbf", nbf)), jwthelper.ErrTokenNotYetValid, jwthelper.ErrTokenNotYetValid, time.Time{}, nbf},
+		{"iat in the future", sign(ms, "kid-api", jwthelper.TimeClaim("iat", nbf)), jwthelper.ErrTokenNotYetValid, jwthelper.ErrTokenNotYetValid, time.Time{}, nbf},
+		{"tampered signature", valid[:len(valid)-4] + "AAAA", jwthelper.ErrSignatureInvalid, jwthelper.ErrSignatureInvalid, time.Time{}, time.Time{}},
+		{"malformed", "not a token", jwthelper.ErrMalformed, jwthelper.ErrMalformed, time.Time{}, time.Time{}},
+		{"other alg", sign(msRS256, "kid-api"), jwthelper.ErrAlgNotAllowed, jwthelper.ErrAlgNotAllowed, time.Time{}, time.Time{}},
+		{"unknown kid", sign(ms, "kid-other"), nil, jwthelper.ErrUnknownKID, time.Time{}, time.Time{}},
+	}
+
+	parsers := []struct {
+		name  string
+		p     jwthelper.TokenParser
+		multi bool
+	}{
+		{"Parser", p, false},
+		{"MultipleKeysParser", mp, true},
+	}
+
+	for _, parser := range parsers {
+		for _, tt := range tests {
+			t.Run(parser.name+"/"+tt.name, func(t *testing.T) {
+				want := tt.err
+				if parser.multi {
+					want = tt.multiErr
+				}
+
+				_, err := parser.p.Parse(tt.token)
+				if (err == nil) != (want == nil) {
+					t.Fatalf("Parse() error: %v, want %v", err, want)
+				}
+				// Each error matches its sentinel only.
+				for _, sentinel := range sentinels {
+					if errors.Is(err, sentinel) != (sentinel == want) {
+						t.Errorf("errors.Is(%v, %v) = %v, want %v", err, sentinel, !(sentinel == want), sentinel == want)
+					}
+				}
+
+				var expired *jwthelper.TokenExpiredError
+				if errors.As(err, &expired) != !tt.expiry.IsZero() {
+					t.Errorf("errors.As(%v, *TokenExpiredError) = %v", err, !tt.expiry.IsZero())
+				} else if expired != nil && !expired.Expiry.Equal(tt.expiry) {
+					t.Errorf("Expiry = %v, want %v", expired.Expiry, tt.expiry)
+				}
+
+				var notYetValid *jwthelper.TokenNotYetValidError
+				if errors.As(err, &notYetValid) != !tt.notBefore.IsZero() {
+					t.Errorf("errors.As(%v, *TokenNotYetValidError) = %v", err, !tt.notBefore.IsZero())
+				} else if notYetValid != nil && !notYetValid.NotBefore.Equal(tt.notBefore) {
+					t.Errorf("NotBefore = %v, want %v", notYetValid.NotBefore, tt.notBefore)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,460 @@
+package jwthelper
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Grant types and token types of token exchange(RFC 8693) and JWT bearer grant(RFC 7523).
+const (
+	TokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	JWTBearerGrantType     = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	TokenTypeJWT           = "urn:ietf:params:oauth:token-type:jwt"
+	TokenTypeAccessToken   = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// ExchangeRequest is the request of token exchange or JWT bearer grant.
+type ExchangeRequest struct {
+	// GrantType is TokenExchangeGrantType or JWTBearerGrantType.
+	// It's TokenExchangeGrantType if it's empty.
+	GrantType string
+	// ClientID is the authenticated client which requests the exchange.
+	// It's "client_id" claim of the issued token and it's required.
+	ClientID string
+	// SubjectToken is "subject_token" of token exchange or "assertion" of JWT bearer grant.
+	SubjectToken string
+	// ActorToken is "actor_token" of token exchange. It's optional.
+	ActorToken string
+	// Audience is "audience" and "resource" parameters: the target services of the issued token.
+	// If it's empty, the default audiences(ExchangeDefaultAudiences()) are used.
+	// Without default audiences, "aud" of the subject token is kept for token exchange
+	// and JWT bearer grant is refused.
+	Audience []string
+	// Scope is "scope" parameter. It must be a subset of the scopes of the subject token.
+	// Scopes of the subject token are kept if it's empty.
+	Scope []string
+}
+
+// ExchangeResponse is the successful response of token exchange(RFC 8693 section 2.2.1).
+// Write it as JSON in the token endpoint response.
+type ExchangeResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+// Exchanger exchanges a JWT for a new JWT access token with narrower audience and scope.
+// It's used for service-to-service delegation(RFC 8693) and JWT bearer grant(RFC 7523).
+type Exchanger struct {
+	subjectParser TokenParser
+	actorParser   TokenParser
+	signer        *Signer
+	issuer        string
+	ttl           time.Duration
+	maxActDepth   int
+	audiences     []string
+	subjectAud    []string
+	defaultAud    []string
+	rules         []func(req *ExchangeRequest, subject, actor Claims) error
+}
+
+// ExchangerOption represents the option for exchanging tokens.
+// Use option helper functions to set options:
+// e.g. ExchangeTTL(), ExchangeAllowedAudiences()
+type ExchangerOption struct {
+	f func(e *Exchanger)
+}
+
+var (
+	// ErrExchangeNotAllowed represents the error of exchange which is refused by the policy.
+	ErrExchangeNotAllowed = fmt.Errorf("token exchange is not allowed")
+	// ErrInvalidScope represents the error of requested scope which is not granted by the subject token.
+	ErrInvalidScope = fmt.Errorf("scope is not granted")
+	// ErrActorNotAllowed represents the error of actor which is not in "may_act" claim of the subject token.
+	// It's wrapped with ErrExchangeNotAllowed.
+	ErrActorNotAllowed = fmt.Errorf("actor is not allowed")
+	// ErrActChainTooDeep represents the error of "act" claim chain which is too deep.
+	// It's wrapped with ErrExchangeNotAllowed.
+	ErrActChainTooDeep = fmt.Errorf("act chain is too deep")
+	// ErrUnsupportedGrantType represents the error of unsupported "grant_type".
+	ErrUnsupportedGrantType = fmt.Errorf("unsupported grant type")
+	// ErrUnsupportedTokenType represents the error of unsupported "subject_token_type" or "actor_token_type".
+	ErrUnsupportedTokenType = fmt.Errorf("unsupported token type")
+)
+
+// ExchangeActorParser returns the option for the parser of actor tokens.
+// The parser of subject tokens is used by default.
+func ExchangeActorParser(p TokenParser) ExchangerOption {
+	return ExchangerOption{func(e *Exchanger) {
+		e.actorParser = p
+	}}
+}
+
+// ExchangeTTL returns the option for the lifetime of issued tokens.
+// It's 5 minutes by default.
+// Issued tokens never outlive the subject token.
+func ExchangeTTL(ttl time.Duration) ExchangerOption {
+	return ExchangerOption{func(e *Exchanger) {
+		e.ttl = ttl
+	}}
+}
+
+// ExchangeMaxActDepth returns the option for the max depth of nested "act" claims.
+// It's 5 by default.
+func ExchangeMaxActDepth(depth int) ExchangerOption {
+	return ExchangerOption{func(e *Exchanger) {
+		e.maxActDepth = depth
+	}}
+}
+
+// ExchangeAllowedAudiences returns the option for audiences which can be requested.
+// Any audience can be requested if it's not set.
+func ExchangeAllowedAudiences(audiences ...string) ExchangerOption {
+	return ExchangerOption{func(e *Exchanger) {
+		e.audiences = audiences
+	}}
+}
+
+// ExchangeSubjectAudiences returns the option for the accepted audiences of subject tokens.
+// "aud" claim of the subject token must contain one of them.
+// For JWT bearer grant, the assertion must be issued for the authorization server(RFC 7523 section 3):
+// the issuer of the exchanger is accepted by default. e.g. add the URL of the token endpoint.
+// Subject tokens of token exchange are not checked by default.
+func ExchangeSubjectAudiences(audiences ...string) ExchangerOption {
+	return ExchangerOption{func(e *Exchanger) {
+		e.subjectAud = audiences
+	}}
+}
+
+// ExchangeDefaultAudiences returns the option for the audiences of issued tokens
+// when no audience is requested.
+func ExchangeDefaultAudiences(audiences ...string) ExchangerOption {
+	return ExchangerOption{func(e *Exchanger) {
+		e.defaultAud = audiences
+	}}
+}
+
+// ExchangeSubjectPolicy returns the option for the policy of the subject token.
+// e.g. ExchangeSubjectPolicy(PolicyScopes("delegate")).
+func ExchangeSubjectPolicy(p Policy) ExchangerOption {
+	return ExchangeRule(func(req *ExchangeRequest, subject, actor Claims) error {
+		if !p.Allow(subject) {
+			return fmt.Errorf("%w: subject token is refused by the policy", ErrExchangeNotAllowed)
+		}
+		return nil
+	})
+}
+
+// ExchangeActorPolicy returns the option for the policy of the actor token.
+// Exchanges without actor tokens are refused if it's set.
+func ExchangeActorPolicy(p Policy) ExchangerOption {
+	return ExchangeRule(func(req *ExchangeRequest, subject, actor Claims) error {
+		if actor == nil || !p.Allow(actor) {
+			return fmt.Errorf("%w: actor token is refused by the policy", ErrExchangeNotAllowed)
+		}
+		return nil
+	})
+}
+
+// ExchangeRule returns the option for a custom rule.
+// The rule is called with the verified claims of the subject and actor token(nil if absent).
+// The exchange is refused if it returns an error.
+func ExchangeRule(rule func(req *ExchangeRequest, subject, actor Claims) error) ExchangerOption {
+	return ExchangerOption{func(e *Exchanger) {
+		e.rules = append(e.rules, rule)
+	}}
+}
+
+// NewExchanger creates an exchanger.
+//
+// subjectParser: parser of subject tokens. e.g. Parser, JWKSParser, AccessTokenValidator.
+// signer: signer of the issued tokens.
+// issuer: "iss" of the issued tokens.
+// options: variadic options returned by option helper functions.
+// e.g. ExchangeTTL(), ExchangeAllowedAudiences(), ExchangeSubjectPolicy()
+func NewExchanger(subjectParser TokenParser, signer *Signer, issuer string, options ...ExchangerOption) *Exchanger {
+	e := &Exchanger{
+		subjectParser: subjectParser,
+		actorParser:   subjectParser,
+		signer:        signer,
+		issuer:        issuer,
+		ttl:           5 * time.Minute,
+		maxActDepth:   5,
+	}
+	for _, op := range options {
+		op.f(e)
+	}
+	return e
+}
+
+// actor returns the "act" claim which identifies the actor by "sub" and "iss" of its claims.
+func actor(claims Claims) (map[string]interface{}, error) {
+	sub, err := claims.String("sub")
+	if err != nil {
+		return nil, err
+	}
+
+	act := map[string]interface{}{"sub": sub}
+	if iss, err := claims.String("iss"); err == nil {
+		act["iss"] = iss
+	}
+	return act, nil
+}
+
+// actDepth returns the depth of nested "act" claims.
+func actDepth(act interface{}) int {
+	depth := 0
+	for {
+		m, ok := act.(map[string]interface{})
+		if !ok {
+			return depth
+		}
+		depth++
+		act = m["act"]
+	}
+}
+
+// checkMayAct checks the actor against "may_act" claim of the subject token(RFC 8693 section 4.4).
+// Any actor is allowed if "may_act" is absent.
+func checkMayAct(subject Claims, act map[string]interface{}) error {
+	v, ok := subject["may_act"]
+	if !ok {
+		return nil
+	}
+	mayAct, ok := v.(map[string]interface{})
+	if !ok {
+		return claimError(ErrClaimType, "may_act")
+	}
+	for _, name := range []string{"sub", "iss"} {
+		if want, ok := mayAct[name]; ok && want != act[name] {
+			return wrapError(ErrExchangeNotAllowed, fmt.Errorf("%w: %v %q", ErrActorNotAllowed, name, act[name]))
+		}
+	}
+	return nil
+}
+
+// checkSubjectAudience checks "aud" of the subject token against the accepted audiences.
+func (e *Exchanger) checkSubjectAudience(req *ExchangeRequest, subject Claims) error {
+	accepted := e.subjectAud
+	if accepted == nil {
+		if req.GrantType != JWTBearerGrantType {
+			return nil
+		}
+		accepted = []string{e.issuer}
+	}
+
+	aud, err := subject.Audience()
+	if err != nil {
+		return wrapError(ErrExchangeNotAllowed, err)
+	}
+	for _, a := range accepted {
+		if contains(aud, a) {
+			return nil
+		}
+	}
+	return wrapError(ErrExchangeNotAllowed, fmt.Errorf("%w: subject token is for %q", ErrInvalidAudience, aud))
+}
+
+// Exchange verifies the subject token(and the actor token) and issues a new JWT access token(RFC 9068).
+//
+// comments:
+// The issued token has the "sub" of the subject token, the requested audience and scope.
+// Scopes can only be narrowed.
+// If the actor token is present, the actor becomes the "act" claim
+// and the "act" claim of the subject token is nested in it(RFC 8693 section 4.1).
+// Otherwise the "act" claim of the subject token is kept.
+// "may_act" claim of the subject token restricts the actor.
+// "aud" of the subject token is checked against the accepted audiences(see ExchangeSubjectAudiences()).
+// Refresh tokens, stream tickets and DPoP-bound tokens are rejected with ErrInvalidTokenType.
+// The assertion of JWT bearer grant must have "exp" and "iss" claims(RFC 7523 section 3).
+// Errors of the parsers are returned as is.
+func (e *Exchanger) Exchange(req *ExchangeRequest) (*ExchangeResponse, error) {
+	claims, err := e.subjectParser.Parse(req.SubjectToken)
+	if err != nil {
+		return nil, err
+	}
+	// Refresh tokens, stream tickets and DPoP-bound tokens must not be exchanged for bearer tokens.
+	if err = CheckBearerToken(req.SubjectToken, claims); err != nil {
+		return nil, err
+	}
+	subject := Claims(claims)
+
+	// "exp" and "iss" are required in the assertion(RFC 7523 section 3).
+	if req.GrantType == JWTBearerGrantType {
+		for _, name := range []string{"exp", "iss"} {
+			if _, ok := subject[name]; !ok {
+				return nil, claimError(ErrClaimNotFound, name)
+			}
+		}
+	}
+
+	sub, err := subject.String("sub")
+	if err != nil {
+		return nil, err
+	}
+	if err = e.checkSubjectAudience(req, subject); err != nil {
+		return nil, err
+	}
+
+	act, hasAct := subject["act"]
+	var actorClaims Claims
+	if req.ActorToken != "" {
+		claims, err := e.actorParser.Parse(req.ActorToken)
+		if err != nil {
+			return nil, err
+		}
+		if err = CheckBearerToken(req.ActorToken, claims); err != nil {
+			return nil, err
+		}
+		actorClaims = Claims(claims)
+
+		a, err := actor(actorClaims)
+		if err != nil {
+			return nil, err
+		}
+		if err = checkMayAct(subject, a); err != nil {
+			return nil, err
+		}
+		if hasAct {
+			a["act"] = act
+		}
+		act, hasAct = a, true
+	}
+	if hasAct && actDepth(act) > e.maxActDepth {
+		return nil, wrapError(ErrExchangeNotAllowed, ErrActChainTooDeep)
+	}
+
+	// Scopes can only be narrowed.
+	granted := Scopes(subject)
+	scope := req.Scope
+	if len(scope) == 0 {
+		scope = granted
+	}
+	for _, s := range scope {
+		if !contains(granted, s) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, s)
+		}
+	}
+
+	aud := req.Audience
+	if len(aud) == 0 {
+		aud = e.defaultAud
+	}
+	if len(aud) == 0 {
+		// "aud" of the assertion is the authorization server itself.
+		if req.GrantType == JWTBearerGrantType {
+			return nil, fmt.Errorf("%w: no audience is requested", ErrInvalidAudience)
+		}
+		if aud, err = subject.Audience(); err != nil {
+			return nil, err
+		}
+	}
+	if e.audiences != nil {
+		for _, a := range aud {
+			if !contains(e.audiences, a) {
+				return nil, wrapError(ErrExchangeNotAllowed, fmt.Errorf("%w: %q", ErrInvalidAudience, a))
+			}
+		}
+	}
+
+	for _, rule := range e.rules {
+		if err = rule(req, subject, actorClaims); err != nil {
+			return nil, err
+		}
+	}
+
+	// The issued token never outlives the subject token.
+	now := time.Now()
+	exp := now.Add(e.ttl)
+	if t, err := subject.Time("exp"); err == nil && t.Before(exp) {
+		exp = t
+	}
+
+	t := &AccessToken{
+		Issuer:   e.issuer,
+		Subject:  sub,
+		Audience: aud,
+		ClientID: req.ClientID,
+		Expiry:   exp,
+		IssuedAt: now,
+		Scope:    scope,
+		Claims:   Claims{},
+	}
+	if hasAct {
+		t.Claims["act"] = act
+	}
+
+	token, err := e.signer.SignedAccessToken(t)
+	if err != nil {
+		return nil, err
+	}
+	return &ExchangeResponse{
+		AccessToken:     token,
+		IssuedTokenType: TokenTypeAccessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(exp.Sub(now).Seconds()),
+		Scope:           strings.Join(scope, " "),
+	}, nil
+}
+
+// ParseExchangeRequest parses the form parameters of token exchange(RFC 8693 section 2.1)
+// or JWT bearer grant(RFC 7523 section 2.1) request.
+//
+// r: token request. The request body is parsed by r.ParseForm().
+// clientID: the client authenticated by the token endpoint. e.g. by ClientAssertionVerifier.
+// comments:
+// Only JWT tokens("urn:ietf:params:oauth:token-type:jwt" or
+// "urn:ietf:params:oauth:token-type:access_token") are supported.
+func ParseExchangeRequest(r *http.Request, clientID string) (*ExchangeRequest, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	form := r.PostForm
+
+	req := &ExchangeRequest{
+		GrantType: form.Get("grant_type"),
+		ClientID:  clientID,
+		Scope:     strings.Fields(form.Get("scope")),
+	}
+
+	switch req.GrantType {
+	case JWTBearerGrantType:
+		req.SubjectToken = form.Get("assertion")
+		if req.SubjectToken == "" {
+			return nil, fmt.Errorf("%w: assertion is missing", ErrInvalidToken)
+		}
+	case TokenExchangeGrantType:
+		req.SubjectToken = form.Get("subject_token")
+		if req.SubjectToken == "" {
+			return nil, fmt.Errorf("%w: subject_token is missing", ErrInvalidToken)
+		}
+		if err := checkTokenType(form.Get("subject_token_type")); err != nil {
+			return nil, err
+		}
+
+		req.ActorToken = form.Get("actor_token")
+		if req.ActorToken != "" {
+			if err := checkTokenType(form.Get("actor_token_type")); err != nil {
+				return nil, err
+			}
+		}
+
+		req.Audience = append(req.Audience, form["audience"]...)
+		req.Audience = append(req.Audience, form["resource"]...)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedGrantType, req.GrantType)
+	}
+	return req, nil
+}
+
+// checkTokenType returns ErrUnsupportedTokenType if the token type is not a JWT.
+func checkTokenType(typ string) error {
+	if typ != TokenTypeJWT && typ != TokenTypeAccessToken {
+		return fmt.Errorf("%w: %q", ErrUnsupportedTokenType, typ)
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+package jwthelper_test
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleExchanger_Exchange() {
+	const issuer = "https://as.example.com"
+
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-1"))
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+	p, err := jwthelper.NewJWKSParser([]byte(testJWKS))
+	if err != nil {
+		log.Printf("NewJWKSParser() error: %v", err)
+		return
+	}
+
+	// Access token of the user which is sent to the frontend service.
+	subjectToken, err := s.SignedAccessToken(&jwthelper.AccessToken{
+		Issuer:   issuer,
+		Subject:  "frank",
+		Audience: []string{"https://frontend.example.com"},
+		ClientID: "web",
+		Expiry:   time.Now().Add(time.Hour),
+		Scope:    []string{"orders:read", "orders:write", "profile"},
+	})
+	if err != nil {
+		log.Printf("SignedAccessToken() error: %v", err)
+		return
+	}
+
+	// Frontend service exchanges it for a token to call the orders service on behalf of the user.
+	e := jwthelper.NewExchanger(p, s, issuer, jwthelper.ExchangeAllowedAudiences("https://orders.example.com"))
+	resp, err := e.Exchange(&jwthelper.ExchangeRequest{
+		ClientID:     "frontend",
+		SubjectToken: subjectToken,
+		Audience:     []string{"https://orders.example.com"},
+		Scope:        []string{"orders:read"},
+	})
+	if err != nil {
+		log.Printf("Exchange() error: %v", err)
+		return
+	}
+
+	v := jwthelper.NewAccessTokenValidator(p, issuer, "https://orders.example.com")
+	t, err := v.Validate(resp.AccessToken)
+	if err != nil {
+		log.Printf("Validate() error: %v", err)
+		return
+	}
+	fmt.Println(t.Subject, t.ClientID, t.Scope, resp.Scope)
+
+	// Output:
+	// frank frontend [orders:read] orders:read
+}
+
+func TestExchanger(t *testing.T) {
+	const (
+		issuer   = "https://as.example.com"
+		audience = "https://api.example.com"
+	)
+
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-1"))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	p, err := jwthelper.NewJWKSParser([]byte(testJWKS))
+	if err != nil {
+		t.Fatalf("NewJWKSParser() error: %v", err)
+	}
+
+	exp := time.Now().Add(time.Hour)
+
+	// sign signs a token of sub with the claims overridden and the extra claims or headers.
+	sign := func(sub string, claims map[string]interface{}, extra ...jwthelper.Claim) string {
+		c := []jwthelper.Claim{
+			jwthelper.NewClaim("iss", issuer),
+			jwthelper.NewClaim("sub", sub),
+			jwthelper.NewClaim("aud", audience),
+			jwthelper.TimeClaim("exp", exp),
+			jwthelper.NewClaim("scope", "read write"),
+		}
+		for k, v := range claims {
+			c = append(c, jwthelper.NewClaim(k, v))
+		}
+		c = append(c, extra...)
+		str, err := s.SignedString(c...)
+		if err != nil {
+			t.Fatalf("SignedString() error: %v", err)
+		}
+		return str
+	}
+
+	user := sign("frank", nil)
+	svc := sign("svc-a", nil)
+	delegated := sign("frank", map[string]interface{}{
+		"act": map[string]interface{}{"sub": "svc-b", "iss": issuer},
+	})
+	mayAct := sign("frank", map[string]interface{}{
+		"may_act": map[string]interface{}{"sub": "svc-a"},
+	})
+	// tampered has the signature of svc.
+	tampered := user[:strings.LastIndex(user, ".")] + svc[strings.LastIndex(svc, "."):]
+	deep := sign("frank", map[string]interface{}{
+		"act": map[string]interface{}{"sub": "svc-b", "act": map[string]interface{}{"sub": "svc-c"}},
+	})
+	// Tokens which must not be exchanged for bearer tokens.
+	refresh := sign("frank", nil, jwthelper.NewHeader("typ", jwthelper.RefreshTokenType))
+	ticket := sign("frank", nil, jwthelper.NewHeader("typ", jwthelper.StreamTicketType))
+	bound := sign("frank", nil, jwthelper.DPoPConfirmation("jkt"))
+
+	e := jwthelper.NewExchanger(p, s, issuer,
+		jwthelper.ExchangeMaxActDepth(2),
+		jwthelper.ExchangeAllowedAudiences(audience, "https://orders.example.com"),
+		jwthelper.ExchangeRule(func(req *jwthelper.ExchangeRequest, subject, actor jwthelper.Claims) error {
+			if req.ClientID == "blocked" {
+				return jwthelper.ErrExchangeNotAllowed
+			}
+			return nil
+		}),
+	)
+
+	tests := []struct {
+		name  string
+		req   jwthelper.ExchangeRequest
+		aud   []string
+		scope []string
+		act   interface{}
+		err   error
+	}{
+		{"keep audience and scope", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: user}, []string{audience}, []string{"read", "write"}, nil, nil},
+		{"narrow", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: user, Audience: []string{"https://orders.example.com"}, Scope: []string{"read"}}, []string{"https://orders.example.com"}, []string{"read"}, nil, nil},
+		{"actor", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: user, ActorToken: svc}, []string{audience}, []string{"read", "write"},
+			map[string]interface{}{"sub": "svc-a", "iss": issuer}, nil},
+		{"keep act", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: delegated}, []string{audience}, []string{"read", "write"},
+			map[string]interface{}{"sub": "svc-b", "iss": issuer}, nil},
+		{"nest act", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: delegated, ActorToken: svc}, []string{audience}, []string{"read", "write"},
+			map[string]interface{}{"sub": "svc-a", "iss": issuer, "act": map[string]interface{}{"sub": "svc-b", "iss": issuer}}, nil},
+		{"may_act", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: mayAct, ActorToken: svc}, []string{audience}, []string{"read", "write"},
+			map[string]interface{}{"sub": "svc-a", "iss": issuer}, nil},
+		{"may_act mismatch", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: mayAct, ActorToken: sign("svc-b", nil)}, nil, nil, nil, jwthelper.ErrActorNotAllowed},
+		{"act chain too deep", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: deep, ActorToken: svc}, nil, nil, nil, jwthelper.ErrActChainTooDeep},
+		{"upscope", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: user, Scope: []string{"admin"}}, nil, nil, nil, jwthelper.ErrInvalidScope},
+		{"audience not allowed", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: user, Audience: []string{"https://other.example.com"}}, nil, nil, nil, jwthelper.ErrInvalidAudience},
+		{"rule", jwthelper.ExchangeRequest{ClientID: "blocked", SubjectToken: user}, nil, nil, nil, jwthelper.ErrExchangeNotAllowed},
+		{"invalid subject token", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: tampered}, nil, nil, nil, jwthelper.ErrSignatureInvalid},
+		{"invalid actor token", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: user, ActorToken: tampered}, nil, nil, nil, jwthelper.ErrSignatureInvalid},
+		{"refresh token as subject", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: refresh}, nil, nil, nil, jwthelper.ErrInvalidTokenType},
+		{"stream ticket as subject", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: ticket}, nil, nil, nil, jwthelper.ErrInvalidTokenType},
+		{"DPoP-bound subject", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: bound}, nil, nil, nil, jwthelper.ErrInvalidTokenType},
+		{"refresh token as actor", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: user, ActorToken: refresh}, nil, nil, nil, jwthelper.ErrInvalidTokenType},
+		{"stream ticket as actor", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: user, ActorToken: ticket}, nil, nil, nil, jwthelper.ErrInvalidTokenType},
+		{"DPoP-bound actor", jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: user, ActorToken: bound}, nil, nil, nil, jwthelper.ErrInvalidTokenType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := e.Exchange(&tt.req)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Exchange() error: %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			claims, err := p.Parse(resp.AccessToken)
+			if err != nil {
+				t.Fatalf("Parse() error: %v", err)
+			}
+			c := jwthelper.Claims(claims)
+			if aud, _ := c.Audience(); !reflect.DeepEqual(aud, tt.aud) {
+				t.Errorf("aud = %v, want %v", aud, tt.aud)
+			}
+			if scope := jwthelper.Scopes(claims); !reflect.DeepEqual(scope, tt.scope) {
+				t.Errorf("scope = %v, want %v", scope, tt.scope)
+			}
+			if !reflect.DeepEqual(claims["act"], tt.act) {
+				t.Errorf("act = %v, want %v", claims["act"], tt.act)
+			}
+			if clientID, _ := c.String("client_id"); clientID != "client-1" {
+				t.Errorf("client_id = %v, want client-1", clientID)
+			}
+			if sub, _ := c.String("sub"); sub != "frank" {
+				t.Errorf("sub = %v, want frank", sub)
+			}
+			// Issued token never outlives the subject token.
+			if e, _ := c.Time("exp"); e.After(exp) {
+				t.Errorf("exp = %v, after %v", e, exp)
+			}
+		})
+	}
+
+	// Policies of the subject and actor tokens.
+	e = jwthelper.NewExchanger(p, s, issuer,
+		jwthelper.ExchangeSubjectPolicy(jwthelper.PolicyScopes("write")),
+		jwthelper.ExchangeActorPolicy(jwthelper.PolicyClaimEquals("sub", "svc-a")),
+	)
+	if _, err = e.Exchange(&jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: user, ActorToken: svc}); err != nil {
+		t.Errorf("Exchange() error: %v", err)
+	}
+	if _, err = e.Exchange(&jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: user}); !errors.Is(err, jwthelper.ErrExchangeNotAllowed) {
+		t.Errorf("Exchange() without actor error: %v, want %v", err, jwthelper.ErrExchangeNotAllowed)
+	}
+	readOnly := sign("frank", map[string]interface{}{"scope": "read"})
+	if _, err = e.Exchange(&jwthelper.ExchangeRequest{ClientID: "client-1", SubjectToken: readOnly, ActorToken: svc}); !errors.Is(err, jwthelper.ErrExchangeNotAllowed) {
+		t.Errorf("Exchange() with read only token error: %v, want %v", err, jwthelper.ErrExchangeNotAllowed)
+	}
+}
+
+func TestParseExchangeRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		form url.Values
+		want *jwthelper.ExchangeRequest
+		err  error
+	}{
+		{"token exchange", url.Values{
+			"grant_type":         {jwthelper.TokenExchangeGrantType},
+			"subject_token":      {"subject"},
+			"subject_token_type": {jwthelper.TokenTypeAccessToken},
+			"actor_token":        {"actor"},
+			"actor_token_type":   {jwthelper.TokenTypeJWT},
+			"audience":           {"svc-a"},
+			"resource":           {"https://api.example.com"},
+			"scope":              {"read write"},
+		}, &jwthelper.ExchangeRequest{
+			GrantType:    jwthelper.TokenExchangeGrantType,
+			ClientID:     "client-1",
+			SubjectToken: "subject",
+			ActorToken:   "actor",
+			Audience:     []string{"svc-a", "https://api.example.com"},
+			Scope:        []string{"read", "write"},
+		}, nil},
+		{"jwt bearer", url.Values{
+			"grant_type": {jwthelper.JWTBearerGrantType},
+			"assertion":  {"subject"},
+			"scope":      {"read"},
+		}, &jwthelper.ExchangeRequest{
+			GrantType:    jwthelper.JWTBearerGrantType,
+			ClientID:     "client-1",
+			SubjectToken: "subject",
+			Scope:        []string{"read"},
+		}, nil},
+		{"unsupported grant type", url.Values{"grant_type": {"password"}}, nil, jwthelper.ErrUnsupportedGrantType},
+		{"no assertion", url.Values{"grant_type": {jwthelper.JWTBearerGrantType}}, nil, jwthelper.ErrInvalidToken},
+		{"no subject_token", url.Values{
+			"grant_type":         {jwthelper.TokenExchangeGrantType},
+			"subject_token_type": {jwthelper.TokenTypeJWT},
+		}, nil, jwthelper.ErrInvalidToken},
+		{"unsupported subject_token_type", url.Values{
+			"grant_type":         {jwthelper.TokenExchangeGrantType},
+			"subject_token":      {"subject"},
+			"subject_token_type": {"urn:ietf:params:oauth:token-type:saml2"},
+		}, nil, jwthelper.ErrUnsupportedTokenType},
+		{"no actor_token_type", url.Values{
+			"grant_type":         {jwthelper.TokenExchangeGrantType},
+			"subject_token":      {"subject"},
+			"subject_token_type": {jwthelper.TokenTypeJWT},
+			"actor_token":        {"actor"},
+		}, nil, jwthelper.ErrUnsupportedTokenType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "https://as.example.com/token", strings.NewReader(tt.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req, err := jwthelper.ParseExchangeRequest(r, "client-1")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ParseExchangeRequest() error: %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(req, tt.want) {
+				t.Errorf("ParseExchangeRequest() = %+v, want %+v", req, tt.want)
+			}
+		})
+	}
+}
+
+func TestExchangerJWTBearer(t *testing.T) {
+	const (
+		issuer        = "https://as.example.com"
+		tokenEndpoint = "https://as.example.com/token"
+		audience      = "https://api.example.com"
+	)
+
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-1"))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	p, err := jwthelper.NewJWKSParser([]byte(testJWKS))
+	if err != nil {
+		t.Fatalf("NewJWKSParser() error: %v", err)
+	}
+
+	// sign signs an assertion for aud without the omitted claims.
+	sign := func(aud string, omit ...string) string {
+		c := []jwthelper.Claim{}
+		for name, claim := range map[string]jwthelper.Claim{
+			"iss":   jwthelper.NewClaim("iss", "https://idp.example.com"),
+			"sub":   jwthelper.NewClaim("sub", "frank"),
+			"aud":   jwthelper.NewClaim("aud", aud),
+			"exp":   jwthelper.TimeClaim("exp", time.Now().Add(time.Hour)),
+			"scope": jwthelper.NewClaim("scope", "read write"),
+		} {
+			if !slices.Contains(omit, name) {
+				c = append(c, claim)
+			}
+		}
+		str, err := s.SignedString(c...)
+		if err != nil {
+			t.Fatalf("SignedString() error: %v", err)
+		}
+		return str
+	}
+
+	defaults := jwthelper.NewExchanger(p, s, issuer, jwthelper.ExchangeDefaultAudiences(audience))
+	accepted := jwthelper.NewExchanger(p, s, issuer, jwthelper.ExchangeDefaultAudiences(audience), jwthelper.ExchangeSubjectAudiences(tokenEndpoint))
+	noDefaults := jwthelper.NewExchanger(p, s, issuer)
+
+	tests := []struct {
+		name      string
+		e         *jwthelper.Exchanger
+		grantType string
+		assertion string
+		audience  []string
+		aud       []string
+		err       error
+	}{
+		{"issuer", defaults, jwthelper.JWTBearerGrantType, sign(issuer), nil, []string{audience}, nil},
+		{"requested audience", noDefaults, jwthelper.JWTBearerGrantType, sign(issuer), []string{"https://orders.example.com"}, []string{"https://orders.example.com"}, nil},
+		{"token for other server", defaults, jwthelper.JWTBearerGrantType, sign(audience), nil, nil, jwthelper.ErrInvalidAudience},
+		{"token endpoint", accepted, jwthelper.JWTBearerGrantType, sign(tokenEndpoint), nil, []string{audience}, nil},
+		{"issuer is not accepted", accepted, jwthelper.JWTBearerGrantType, sign(issuer), nil, nil, jwthelper.ErrExchangeNotAllowed},
+		{"no audience", noDefaults, jwthelper.JWTBearerGrantType, sign(issuer), nil, nil, jwthelper.ErrInvalidAudience},
+		{"token exchange with accepted audiences", accepted, jwthelper.TokenExchangeGrantType, sign(audience), nil, nil, jwthelper.ErrInvalidAudience},
+		{"token exchange keeps audience", noDefaults, "", sign(audience), nil, []string{audience}, nil},
+		{"assertion without exp", defaults, jwthelper.JWTBearerGrantType, sign(issuer, "exp"), nil, nil, jwthelper.ErrClaimNotFound},
+		{"assertion without iss", defaults, jwthelper.JWTBearerGrantType, sign(issuer, "iss"), nil, nil, jwthelper.ErrClaimNotFound},
+		{"token exchange without exp", defaults, jwthelper.TokenExchangeGrantType, sign(issuer, "exp"), nil, []string{audience}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.e.Exchange(&jwthelper.ExchangeRequest{
+				GrantType:    tt.grantType,
+				ClientID:     "client-1",
+				SubjectToken: tt.assertion,
+				Audience:     tt.audience,
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Exchange() error: %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			claims, err := p.Parse(resp.AccessToken)
+			if err != nil {
+				t.Fatalf("Parse() error: %v", err)
+			}
+			if aud, _ := jwthelper.Claims(claims).Audience(); !reflect.DeepEqual(aud, tt.aud) {
+				t.Errorf("aud = %v, want %v", aud, tt.aud)
+			}
+		})
+	}
+}
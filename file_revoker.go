@@ -0,0 +1,194 @@
+package jwthelper
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileRevoker is a file-backed Revoker.
+// Entries are appended to the file as JSON lines,
+// so several processes on one host can share a revocation list.
+// The file is reloaded when it's changed by other processes.
+// It's compacted when more than half of the lines are expired, duplicate or malformed.
+// It's safe for concurrent use.
+type FileRevoker struct {
+	m       sync.Mutex
+	file    string
+	list    revocationList
+	size    int64
+	modTime time.Time
+}
+
+// NewFileRevoker news a FileRevoker with given file.
+// The file will be created if it does not exist.
+func NewFileRevoker(file string) (*FileRevoker, error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	r := &FileRevoker{
+		file: file,
+		list: revocationList{},
+	}
+
+	if err = r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload reloads entries if the file is changed.
+// Expired entries and malformed lines are skipped.
+// The file is compacted if more than half of the lines are stale.
+func (r *FileRevoker) reload() error {
+	fi, err := os.Stat(r.file)
+	if err != nil {
+		return err
+	}
+
+	if fi.Size() == r.size && fi.ModTime().Equal(r.modTime) {
+		return nil
+	}
+
+	f, err := os.Open(r.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	now := time.Now()
+	list := revocationList{}
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines++
+		e := revocation{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if now.After(e.Expiry) {
+			continue
+		}
+		list.add(e)
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+
+	if stale := lines - len(list); stale > len(list) {
+		if compacted, err := r.compact(list, fi.Size()); err == nil && compacted != nil {
+			fi = compacted
+		}
+	}
+
+	r.list = list
+	r.size = fi.Size()
+	r.modTime = fi.ModTime()
+	return nil
+}
+
+// compact rewrites the file with the entries of the list.
+// It returns the file info of the new file,
+// or nil if the file was changed by other processes after it's loaded.
+// comments:
+// The new file is written to a temporary file and renamed to the file.
+// Lines appended by other processes between the size check and the rename are lost,
+// so the window is kept as small as possible.
+func (r *FileRevoker) compact(list revocationList, size int64) (os.FileInfo, error) {
+	f, err := os.CreateTemp(filepath.Dir(r.file), filepath.Base(r.file)+".*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range list {
+		if err = enc.Encode(e); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err = f.Close(); err != nil {
+		return nil, err
+	}
+
+	if fi, err := os.Stat(r.file); err != nil || fi.Size() != size {
+		return nil, err
+	}
+	if err = os.Rename(f.Name(), r.file); err != nil {
+		return nil, err
+	}
+	return os.Stat(r.file)
+}
+
+// add appends an entry to the file.
+func (r *FileRevoker) add(e revocation) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	buf = append(buf, '\n')
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	f, err := os.OpenFile(r.file, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Write the line in one call so that appends of other processes are not interleaved.
+	if _, err = f.Write(buf); err != nil {
+		return err
+	}
+
+	r.list.add(e)
+	return nil
+}
+
+// RevokeJTI revokes the token with given "jti".
+//
+// exp: expiration time of the token. The entry is ignored after it.
+func (r *FileRevoker) RevokeJTI(jti string, exp time.Time) error {
+	return r.add(revocation{Kind: revokeJTI, Value: jti, Expiry: exp})
+}
+
+// RevokeSubject revokes all tokens of the subject("sub") issued before given time.
+//
+// before: tokens with "iat" before the second of it are revoked.
+// Tokens issued in the same second are not revoked because "iat" has second precision.
+// Pass the next second to revoke all tokens issued until now. e.g. time.Now().Add(time.Second).
+// exp: the latest expiration time of the revoked tokens. The entry is ignored after it.
+func (r *FileRevoker) RevokeSubject(sub string, before, exp time.Time) error {
+	return r.add(revocation{Kind: revokeSub, Value: sub, Before: before, Expiry: exp})
+}
+
+// RevokeKID revokes all tokens with given "kid".
+//
+// exp: the latest expiration time of the tokens signed by the key. The entry is ignored after it.
+func (r *FileRevoker) RevokeKID(kid string, exp time.Time) error {
+	return r.add(revocation{Kind: revokeKID, Value: kid, Expiry: exp})
+}
+
+// Revoked implements Revoker interface.
+func (r *FileRevoker) Revoked(claims map[string]interface{}) (bool, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if err := r.reload(); err != nil {
+		return false, err
+	}
+	return r.list.revoked(claims, time.Now()), nil
+}
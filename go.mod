@@ -0,0 +1,3 @@
+module github.com/northbright/jwthelper
+
+go 1.23
@@ -0,0 +1,164 @@
+package grpcjwt
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/northbright/jwthelper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// PerRPCCredentials attaches the token of the token source to each call.
+// It implements credentials.PerRPCCredentials. Use it with grpc.WithPerRPCCredentials().
+type PerRPCCredentials struct {
+	src      jwthelper.TokenSource
+	insecure bool
+}
+
+// ClientOption represents the option for client credentials.
+// Use option helper functions to set options:
+// e.g. ClientInsecure()
+type ClientOption struct {
+	f func(c *PerRPCCredentials)
+}
+
+// invalidator is implemented by token sources which can drop a rejected token.
+// e.g. jwthelper.CachedTokenSource.
+type invalidator interface {
+	Invalidate(token string)
+}
+
+// ClientInsecure returns the option to send tokens over connections without transport security.
+// Use it only for local development. Transport security is required by default.
+func ClientInsecure() ClientOption {
+	return ClientOption{func(c *PerRPCCredentials) {
+		c.insecure = true
+	}}
+}
+
+// NewPerRPCCredentials creates per-RPC credentials with the token source.
+//
+// src: token source. e.g. jwthelper.CachedTokenSource.
+// options: variadic options returned by option helper functions.
+// e.g. ClientInsecure()
+func NewPerRPCCredentials(src jwthelper.TokenSource, options ...ClientOption) *PerRPCCredentials {
+	c := &PerRPCCredentials{src: src}
+	for _, op := range options {
+		op.f(c)
+	}
+	return c
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials interface.
+func (c *PerRPCCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, err := c.src.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return requestMetadata(ctx, token, c.insecure)
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials interface.
+func (c *PerRPCCredentials) RequireTransportSecurity() bool {
+	return !c.insecure
+}
+
+// requestMetadata returns "authorization" metadata of the token
+// after checking transport security of the connection unless insecure is set.
+func requestMetadata(ctx context.Context, token string, insecure bool) (map[string]string, error) {
+	if !insecure {
+		ri, _ := credentials.RequestInfoFromContext(ctx)
+		if err := credentials.CheckSecurityLevel(ri.AuthInfo, credentials.PrivacyAndIntegrity); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+// tokenCredentials attaches a fixed token to one call.
+// It's passed by the interceptors as a call option so that grpc checks transport security as PerRPCCredentials.
+type tokenCredentials struct {
+	token    string
+	insecure bool
+	// sent is set when the token is attached to the call.
+	sent atomic.Bool
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials interface.
+func (c *tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	md, err := requestMetadata(ctx, c.token, c.insecure)
+	if err == nil {
+		c.sent.Store(true)
+	}
+	return md, err
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials interface.
+func (c *tokenCredentials) RequireTransportSecurity() bool {
+	return !c.insecure
+}
+
+// withCredentials returns a copy of the call options with the credentials.
+func withCredentials(opts []grpc.CallOption, creds *tokenCredentials) []grpc.CallOption {
+	o := make([]grpc.CallOption, 0, len(opts)+1)
+	o = append(o, opts...)
+	return append(o, grpc.PerRPCCredentials(creds))
+}
+
+// UnaryClientInterceptor returns the unary client interceptor which attaches the token of the token source.
+// If the call fails with codes.Unauthenticated after the token is sent, the token is invalidated
+// and the call is made once more with a new token.
+// The call is not retried if the token source can't invalidate the token or it returns the same token.
+//
+// src: token source. e.g. jwthelper.CachedTokenSource.
+// options: variadic options returned by option helper functions.
+// e.g. ClientInsecure()
+// comments:
+// Transport security is required as PerRPCCredentials.
+// Calls on connections without transport security fail with codes.Unauthenticated unless ClientInsecure() is set.
+func UnaryClientInterceptor(src jwthelper.TokenSource, options ...ClientOption) grpc.UnaryClientInterceptor {
+	insecure := NewPerRPCCredentials(src, options...).insecure
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		token, err := src.Token(ctx)
+		if err != nil {
+			return err
+		}
+
+		creds := &tokenCredentials{token: token, insecure: insecure}
+		err = invoker(ctx, method, req, reply, cc, withCredentials(opts, creds)...)
+		if status.Code(err) != codes.Unauthenticated || !creds.sent.Load() {
+			return err
+		}
+
+		inv, ok := src.(invalidator)
+		if !ok {
+			return err
+		}
+		inv.Invalidate(token)
+
+		fresh, e := src.Token(ctx)
+		if e != nil || fresh == token {
+			return err
+		}
+		creds = &tokenCredentials{token: fresh, insecure: insecure}
+		return invoker(ctx, method, req, reply, cc, withCredentials(opts, creds)...)
+	}
+}
+
+// StreamClientInterceptor returns the stream client interceptor which attaches the token of the token source.
+// Streams are not retried.
+// See UnaryClientInterceptor() for the parameters and transport security.
+func StreamClientInterceptor(src jwthelper.TokenSource, options ...ClientOption) grpc.StreamClientInterceptor {
+	insecure := NewPerRPCCredentials(src, options...).insecure
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		token, err := src.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		creds := &tokenCredentials{token: token, insecure: insecure}
+		return streamer(ctx, desc, cc, method, withCredentials(opts, creds)...)
+	}
+}
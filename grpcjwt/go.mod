@@ -0,0 +1,20 @@
+module github.com/northbright/jwthelper/grpcjwt
+
+// grpc requires Go 1.25, which is higher than Go 1.23 of jwthelper.
+go 1.25.0
+
+require (
+	github.com/northbright/jwthelper v0.0.0
+	google.golang.org/grpc v1.82.1
+)
+
+require (
+	golang.org/x/net v0.53.0 // indirect
+	golang.org/x/sys v0.43.0 // indirect
+	golang.org/x/text v0.36.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260414002931-afd174a4e478 // indirect
+	google.golang.org/protobuf v1.36.11 // indirect
+)
+
+// jwthelper is built from the same commit.
+replace github.com/northbright/jwthelper => ../
@@ -0,0 +1,305 @@
+package grpcjwt_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/northbright/jwthelper"
+	"github.com/northbright/jwthelper/grpcjwt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	checkMethod = "/grpc.health.v1.Health/Check"
+	watchMethod = "/grpc.health.v1.Health/Watch"
+)
+
+// serve starts a health server with the server options on a bufconn listener
+// and returns a client connection with the dial options.
+func serve(t *testing.T, serverOpts []grpc.ServerOption, dialOpts ...grpc.DialOption) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(serverOpts...)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+
+	dialOpts = append(dialOpts,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	conn, err := grpc.NewClient("passthrough:///bufnet", dialOpts...)
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+		srv.Stop()
+	})
+	return conn
+}
+
+func ExampleUnaryServerInterceptor() {
+	p, err := jwthelper.NewParserFromFile("RS384", "../keys/rsa-pub-api.pem")
+	if err != nil {
+		log.Printf("NewParserFromFile() error: %v", err)
+		return
+	}
+	s, err := jwthelper.NewSignerFromFile("RS384", "../keys/rsa-priv-api.pem")
+	if err != nil {
+		log.Printf("NewSignerFromFile() error: %v", err)
+		return
+	}
+
+	// Server requires "health" scope.
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(grpcjwt.UnaryServerInterceptor(p, grpcjwt.ServerPolicy(jwthelper.PolicyScopes("health")))),
+	)
+	defer srv.Stop()
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+
+	// Client attaches self-signed tokens.
+	src := jwthelper.NewSignerTokenSource(s, 5*time.Minute, []jwthelper.Claim{
+		jwthelper.NewClaim("sub", "svc-a"),
+		jwthelper.NewClaim("scope", "health"),
+	})
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(grpcjwt.NewPerRPCCredentials(src, grpcjwt.ClientInsecure())),
+	)
+	if err != nil {
+		log.Printf("NewClient() error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		log.Printf("Check() error: %v", err)
+		return
+	}
+	fmt.Println(resp.GetStatus())
+
+	// Output:
+	// SERVING
+}
+
+func TestServerInterceptors(t *testing.T) {
+	p, err := jwthelper.NewParserFromFile("RS384", "../keys/rsa-pub-api.pem")
+	if err != nil {
+		t.Fatalf("NewParserFromFile() error: %v", err)
+	}
+	s, err := jwthelper.NewSignerFromFile("RS384", "../keys/rsa-priv-api.pem")
+	if err != nil {
+		t.Fatalf("NewSignerFromFile() error: %v", err)
+	}
+	vendor, err := jwthelper.NewSignerFromFile("RS384", "../keys/rsa-priv-vendor.pem")
+	if err != nil {
+		t.Fatalf("NewSignerFromFile() error: %v", err)
+	}
+
+	sign := func(s *jwthelper.Signer, claims ...jwthelper.Claim) string {
+		str, err := s.SignedString(claims...)
+		if err != nil {
+			t.Fatalf("SignedString() error: %v", err)
+		}
+		return str
+	}
+
+	// sub records "sub" claim in the context after authentication.
+	var sub atomic.Value
+	record := func(ctx context.Context) {
+		claims, _ := jwthelper.ClaimsFromContext(ctx)
+		sub.Store(fmt.Sprint(claims["sub"]))
+	}
+
+	options := []grpcjwt.ServerOption{
+		grpcjwt.ServerPolicy(jwthelper.PolicyScopes("health")),
+		grpcjwt.ServerMethodPolicy(watchMethod, jwthelper.PolicyScopes("watch")),
+	}
+	conn := serve(t, []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(grpcjwt.UnaryServerInterceptor(p, options...),
+			func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				record(ctx)
+				return handler(ctx, req)
+			}),
+		grpc.ChainStreamInterceptor(grpcjwt.StreamServerInterceptor(p, options...),
+			func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				record(ss.Context())
+				// Don't wait for health status changes.
+				return nil
+			}),
+	})
+	client := healthpb.NewHealthClient(conn)
+
+	tests := []struct {
+		name   string
+		auth   string
+		unary  codes.Code
+		stream codes.Code
+	}{
+		{"health and watch", "Bearer " + sign(s, jwthelper.NewClaim("sub", "frank"), jwthelper.NewClaim("scope", "health watch")), codes.OK, codes.OK},
+		{"lower case scheme", "bearer " + sign(s, jwthelper.NewClaim("sub", "frank"), jwthelper.NewClaim("scope", "health watch")), codes.OK, codes.OK},
+		{"health only", "Bearer " + sign(s, jwthelper.NewClaim("sub", "frank"), jwthelper.NewClaim("scope", "health")), codes.OK, codes.PermissionDenied},
+		{"no scope", "Bearer " + sign(s, jwthelper.NewClaim("sub", "frank")), codes.PermissionDenied, codes.PermissionDenied},
+		{"no token", "", codes.Unauthenticated, codes.Unauthenticated},
+		{"basic", "Basic Zm9vOmJhcg==", codes.Unauthenticated, codes.Unauthenticated},
+		{"other key", "Bearer " + sign(vendor, jwthelper.NewClaim("sub", "frank"), jwthelper.NewClaim("scope", "health watch")), codes.Unauthenticated, codes.Unauthenticated},
+		{"expired", "Bearer " + sign(s, jwthelper.NewClaim("sub", "frank"), jwthelper.NewClaim("scope", "health watch"), jwthelper.TimeClaim("exp", time.Now().Add(-time.Minute))), codes.Unauthenticated, codes.Unauthenticated},
+		{"refresh token", "Bearer " + sign(s, jwthelper.NewHeader("typ", jwthelper.RefreshTokenType), jwthelper.NewClaim("sub", "frank"), jwthelper.NewClaim("scope", "health watch")), codes.Unauthenticated, codes.Unauthenticated},
+		{"DPoP-bound", "Bearer " + sign(s, jwthelper.NewClaim("sub", "frank"), jwthelper.NewClaim("scope", "health watch"), jwthelper.DPoPConfirmation("jkt")), codes.Unauthenticated, codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.auth != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", tt.auth)
+			}
+
+			sub.Store("")
+			_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+			if code := status.Code(err); code != tt.unary {
+				t.Errorf("Check() error: %v, want %v", err, tt.unary)
+			}
+			// Errors of the parser are not sent to callers.
+			if msg := status.Convert(err).Message(); tt.unary == codes.Unauthenticated && msg != "missing bearer token" && msg != "invalid token" {
+				t.Errorf("Check() error message = %q", msg)
+			}
+			if want := map[bool]string{true: "frank", false: ""}[tt.unary == codes.OK]; sub.Load() != want {
+				t.Errorf("sub in unary context = %q, want %q", sub.Load(), want)
+			}
+
+			sub.Store("")
+			stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+			if err == nil {
+				// The stream ends without messages after authentication.
+				if _, err = stream.Recv(); err == io.EOF {
+					err = nil
+				}
+			}
+			if code := status.Code(err); code != tt.stream {
+				t.Errorf("Watch() error: %v, want %v", err, tt.stream)
+			}
+			if want := map[bool]string{true: "frank", false: ""}[tt.stream == codes.OK]; sub.Load() != want {
+				t.Errorf("sub in stream context = %q, want %q", sub.Load(), want)
+			}
+		})
+	}
+
+	// Skipped methods don't require tokens.
+	conn = serve(t, []grpc.ServerOption{
+		grpc.UnaryInterceptor(grpcjwt.UnaryServerInterceptor(p, grpcjwt.ServerSkipMethods(checkMethod))),
+	})
+	if _, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("Check() of skipped method error: %v", err)
+	}
+}
+
+func TestClientInterceptors(t *testing.T) {
+	// Server rejects "token-1".
+	var calls int32
+	var auth atomic.Value
+	reject := func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		md, _ := metadata.FromIncomingContext(ctx)
+		auth.Store(md.Get("authorization"))
+		token, err := grpcjwt.TokenFromMetadata(ctx)
+		if err != nil || token == "token-1" {
+			return status.Error(codes.Unauthenticated, "rejected")
+		}
+		return nil
+	}
+
+	var n int32
+	src := jwthelper.NewCachedTokenSource(func(ctx context.Context) (string, time.Time, error) {
+		return fmt.Sprintf("token-%d", atomic.AddInt32(&n, 1)), time.Now().Add(time.Hour), nil
+	})
+
+	conn := serve(t, []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := reject(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			return reject(ss.Context())
+		}),
+	},
+		grpc.WithUnaryInterceptor(grpcjwt.UnaryClientInterceptor(src, grpcjwt.ClientInsecure())),
+		grpc.WithStreamInterceptor(grpcjwt.StreamClientInterceptor(src, grpcjwt.ClientInsecure())),
+	)
+	client := healthpb.NewHealthClient(conn)
+
+	// Unary call is retried once with a new token.
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check() error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %v, want 2", calls)
+	}
+	if got := fmt.Sprint(auth.Load()); got != "[Bearer token-2]" {
+		t.Errorf("authorization = %v, want [Bearer token-2]", got)
+	}
+
+	// Stream uses the cached token.
+	calls = 0
+	stream, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) == codes.Unauthenticated || calls != 1 {
+		t.Errorf("Watch() error: %v, calls = %v", err, calls)
+	}
+	if got := fmt.Sprint(auth.Load()); got != "[Bearer token-2]" {
+		t.Errorf("authorization = %v, want [Bearer token-2]", got)
+	}
+
+	// Interceptors require transport security by default.
+	calls = 0
+	secure := healthpb.NewHealthClient(serve(t, nil,
+		grpc.WithUnaryInterceptor(grpcjwt.UnaryClientInterceptor(src)),
+		grpc.WithStreamInterceptor(grpcjwt.StreamClientInterceptor(src)),
+	))
+	if _, err = secure.Check(context.Background(), &healthpb.HealthCheckRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Check() on insecure connection error: %v, want %v", err, codes.Unauthenticated)
+	}
+	if stream, err = secure.Watch(context.Background(), &healthpb.HealthCheckRequest{}); err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Watch() on insecure connection error: %v, want %v", err, codes.Unauthenticated)
+	}
+	if n != 2 {
+		t.Errorf("fetched tokens = %v, want 2", n)
+	}
+
+	// PerRPCCredentials require transport security by default.
+	creds := grpcjwt.NewPerRPCCredentials(src)
+	if !creds.RequireTransportSecurity() {
+		t.Errorf("RequireTransportSecurity() = false, want true")
+	}
+	if md, err := grpcjwt.NewPerRPCCredentials(src, grpcjwt.ClientInsecure()).GetRequestMetadata(context.Background()); err != nil || md["authorization"] != "Bearer token-2" {
+		t.Errorf("GetRequestMetadata() = %v, %v, want Bearer token-2", md, err)
+	}
+}
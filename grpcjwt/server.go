@@ -0,0 +1,169 @@
+// Package grpcjwt provides gRPC interceptors and credentials for JWT bearer tokens.
+// It's a separate module so that jwthelper has no third-party dependencies.
+// It requires Go 1.25 or later because of grpc.
+// jwthelper is replaced by the parent directory in go.mod,
+// so it's built and tested with jwthelper of the same commit.
+package grpcjwt
+
+import (
+	"context"
+	"strings"
+
+	"github.com/northbright/jwthelper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ServerOption represents the option for server interceptors.
+// Use option helper functions to set options:
+// e.g. ServerPolicy(), ServerSkipMethods()
+type ServerOption struct {
+	f func(o *serverOptions)
+}
+
+// serverOptions stores the options for server interceptors.
+type serverOptions struct {
+	policy  *jwthelper.Policy
+	methods map[string]jwthelper.Policy
+	skip    map[string]bool
+}
+
+// ServerPolicy returns the option for the policy of all methods.
+// Calls which claims don't satisfy the policy are rejected with codes.PermissionDenied.
+// No policy is checked by default.
+func ServerPolicy(p jwthelper.Policy) ServerOption {
+	return ServerOption{func(o *serverOptions) {
+		o.policy = &p
+	}}
+}
+
+// ServerMethodPolicy returns the option for the policy of the method.
+// It's checked in addition to the policy set by ServerPolicy().
+//
+// fullMethod: full method name. e.g. "/package.Service/Method".
+func ServerMethodPolicy(fullMethod string, p jwthelper.Policy) ServerOption {
+	return ServerOption{func(o *serverOptions) {
+		o.methods[fullMethod] = p
+	}}
+}
+
+// ServerSkipMethods returns the option for methods which don't require tokens.
+// e.g. "/grpc.health.v1.Health/Check".
+func ServerSkipMethods(fullMethods ...string) ServerOption {
+	return ServerOption{func(o *serverOptions) {
+		for _, m := range fullMethods {
+			o.skip[m] = true
+		}
+	}}
+}
+
+// newServerOptions returns the options with default values.
+func newServerOptions(options []ServerOption) *serverOptions {
+	o := &serverOptions{
+		methods: map[string]jwthelper.Policy{},
+		skip:    map[string]bool{},
+	}
+	for _, op := range options {
+		op.f(o)
+	}
+	return o
+}
+
+// TokenFromMetadata returns the bearer token in "authorization" metadata of the incoming context.
+// The scheme is case-insensitive.
+// It returns jwthelper.ErrNoBearerToken if there's no bearer token.
+func TokenFromMetadata(ctx context.Context) (string, error) {
+	const prefix = "bearer "
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", jwthelper.ErrNoBearerToken
+	}
+	for _, auth := range md.Get("authorization") {
+		if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+			continue
+		}
+		if token := strings.TrimSpace(auth[len(prefix):]); token != "" {
+			return token, nil
+		}
+	}
+	return "", jwthelper.ErrNoBearerToken
+}
+
+// authenticate verifies the bearer token of the call and returns the context with the claims.
+func authenticate(ctx context.Context, p jwthelper.TokenParser, o *serverOptions, fullMethod string) (context.Context, error) {
+	if o.skip[fullMethod] {
+		return ctx, nil
+	}
+
+	// Errors of the parser are not sent to unauthenticated callers.
+	token, err := TokenFromMetadata(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	claims, err := p.Parse(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	// Refresh tokens, stream tickets and DPoP-bound tokens are not bearer tokens.
+	if err = jwthelper.CheckBearerToken(token, claims); err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	if o.policy != nil && !o.policy.Allow(claims) {
+		return nil, status.Error(codes.PermissionDenied, "permission denied")
+	}
+	if p, ok := o.methods[fullMethod]; ok && !p.Allow(claims) {
+		return nil, status.Error(codes.PermissionDenied, "permission denied")
+	}
+	return jwthelper.NewContext(ctx, claims), nil
+}
+
+// UnaryServerInterceptor returns the unary server interceptor which verifies the bearer token with the parser
+// and stores the claims in the context before calling the handler.
+// Use jwthelper.ClaimsFromContext() to get the claims.
+//
+// p: parser of the tokens. e.g. jwthelper.Parser, jwthelper.MultipleKeysParser, jwthelper.JWKSParser.
+// options: variadic options returned by option helper functions.
+// e.g. ServerPolicy(jwthelper.PolicyScopes("read"))
+// comments:
+// It returns codes.Unauthenticated if the token is missing or invalid,
+// or codes.PermissionDenied if the policy is not satisfied.
+// The messages are fixed and don't include the errors of the parser.
+func UnaryServerInterceptor(p jwthelper.TokenParser, options ...ServerOption) grpc.UnaryServerInterceptor {
+	o := newServerOptions(options)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, p, o, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// serverStream overrides the context of grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context with the claims.
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamServerInterceptor returns the stream server interceptor which verifies the bearer token with the parser
+// and stores the claims in the context of the stream.
+// See UnaryServerInterceptor() for the parameters.
+func StreamServerInterceptor(p jwthelper.TokenParser, options ...ServerOption) grpc.StreamServerInterceptor {
+	o := newServerOptions(options)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), p, o, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ss, ctx})
+	}
+}
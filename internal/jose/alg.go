@@ -0,0 +1,256 @@
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"math/big"
+)
+
+// Algorithm signs and verifies JWS signing input.
+type Algorithm interface {
+	// Alg returns "alg" header parameter value(RFC 7518 section 3.1, RFC 8037 section 3.1).
+	Alg() string
+	// Sign signs the signing input with the key and returns the raw signature.
+	Sign(input string, key interface{}) ([]byte, error)
+	// Verify verifies the raw signature of the signing input with the key.
+	Verify(input string, sig []byte, key interface{}) error
+}
+
+// HMAC implements "HS256", "HS384" and "HS512".
+// Key is []byte.
+type HMAC struct {
+	Name string
+	Hash crypto.Hash
+}
+
+// RSA implements "RS256", "RS384" and "RS512"(RSASSA-PKCS1-v1_5).
+// Keys are *rsa.PrivateKey and *rsa.PublicKey.
+type RSA struct {
+	Name string
+	Hash crypto.Hash
+}
+
+// RSAPSS implements "PS256", "PS384" and "PS512"(RSASSA-PSS).
+// Keys are *rsa.PrivateKey and *rsa.PublicKey.
+type RSAPSS struct {
+	Name string
+	Hash crypto.Hash
+}
+
+// ECDSA implements "ES256", "ES384" and "ES512".
+// Keys are *ecdsa.PrivateKey and *ecdsa.PublicKey.
+// Signature is the raw r||s(RFC 7518 section 3.4).
+type ECDSA struct {
+	Name  string
+	Hash  crypto.Hash
+	Curve elliptic.Curve
+}
+
+// EdDSA implements "EdDSA" with Ed25519(RFC 8037).
+// Keys are ed25519.PrivateKey and ed25519.PublicKey.
+type EdDSA struct{}
+
+var algorithms = map[string]Algorithm{
+	"HS256": &HMAC{"HS256", crypto.SHA256},
+	"HS384": &HMAC{"HS384", crypto.SHA384},
+	"HS512": &HMAC{"HS512", crypto.SHA512},
+	"RS256": &RSA{"RS256", crypto.SHA256},
+	"RS384": &RSA{"RS384", crypto.SHA384},
+	"RS512": &RSA{"RS512", crypto.SHA512},
+	"PS256": &RSAPSS{"PS256", crypto.SHA256},
+	"PS384": &RSAPSS{"PS384", crypto.SHA384},
+	"PS512": &RSAPSS{"PS512", crypto.SHA512},
+	"ES256": &ECDSA{"ES256", crypto.SHA256, elliptic.P256()},
+	"ES384": &ECDSA{"ES384", crypto.SHA384, elliptic.P384()},
+	"ES512": &ECDSA{"ES512", crypto.SHA512, elliptic.P521()},
+	"EdDSA": &EdDSA{},
+}
+
+// Lookup returns the algorithm by "alg".
+// "none" is not supported.
+func Lookup(alg string) (Algorithm, bool) {
+	a, ok := algorithms[alg]
+	return a, ok
+}
+
+// digest returns the hash of the signing input.
+func digest(h crypto.Hash, input string) []byte {
+	hasher := h.New()
+	hasher.Write([]byte(input))
+	return hasher.Sum(nil)
+}
+
+// Alg implements Algorithm interface.
+func (a *HMAC) Alg() string { return a.Name }
+
+// Sign implements Algorithm interface.
+func (a *HMAC) Sign(input string, key interface{}) ([]byte, error) {
+	k, ok := key.([]byte)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+	if len(k) == 0 {
+		return nil, ErrInvalidKey
+	}
+
+	mac := hmac.New(a.Hash.New, k)
+	mac.Write([]byte(input))
+	return mac.Sum(nil), nil
+}
+
+// Verify implements Algorithm interface.
+func (a *HMAC) Verify(input string, sig []byte, key interface{}) error {
+	want, err := a.Sign(input, key)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(sig, want) {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
+
+// Alg implements Algorithm interface.
+func (a *RSA) Alg() string { return a.Name }
+
+// Sign implements Algorithm interface.
+func (a *RSA) Sign(input string, key interface{}) ([]byte, error) {
+	k, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+	return rsa.SignPKCS1v15(rand.Reader, k, a.Hash, digest(a.Hash, input))
+}
+
+// Verify implements Algorithm interface.
+func (a *RSA) Verify(input string, sig []byte, key interface{}) error {
+	k, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return ErrInvalidKeyType
+	}
+	if err := rsa.VerifyPKCS1v15(k, a.Hash, digest(a.Hash, input), sig); err != nil {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
+
+// Alg implements Algorithm interface.
+func (a *RSAPSS) Alg() string { return a.Name }
+
+// Sign implements Algorithm interface.
+// Salt length equals to the hash size(RFC 7518 section 3.5).
+func (a *RSAPSS) Sign(input string, key interface{}) ([]byte, error) {
+	k, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+	return rsa.SignPSS(rand.Reader, k, a.Hash, digest(a.Hash, input), &rsa.PSSOptions{
+		SaltLength: rsa.PSSSaltLengthEqualsHash,
+	})
+}
+
+// Verify implements Algorithm interface.
+func (a *RSAPSS) Verify(input string, sig []byte, key interface{}) error {
+	k, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return ErrInvalidKeyType
+	}
+	err := rsa.VerifyPSS(k, a.Hash, digest(a.Hash, input), sig, &rsa.PSSOptions{
+		SaltLength: rsa.PSSSaltLengthAuto,
+	})
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
+
+// Alg implements Algorithm interface.
+func (a *ECDSA) Alg() string { return a.Name }
+
+// size returns the byte size of r and s.
+func (a *ECDSA) size() int {
+	return (a.Curve.Params().BitSize + 7) / 8
+}
+
+// Sign implements Algorithm interface.
+func (a *ECDSA) Sign(input string, key interface{}) ([]byte, error) {
+	k, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+	if k.Curve != a.Curve {
+		return nil, ErrInvalidKey
+	}
+
+	r, s, err := ecdsa.Sign(rand.Reader, k, digest(a.Hash, input))
+	if err != nil {
+		return nil, err
+	}
+
+	// Fixed-size big-endian r||s.
+	n := a.size()
+	sig := make([]byte, 2*n)
+	r.FillBytes(sig[:n])
+	s.FillBytes(sig[n:])
+	return sig, nil
+}
+
+// Verify implements Algorithm interface.
+func (a *ECDSA) Verify(input string, sig []byte, key interface{}) error {
+	k, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return ErrInvalidKeyType
+	}
+	if k.Curve != a.Curve {
+		return ErrInvalidKey
+	}
+
+	n := a.size()
+	if len(sig) != 2*n {
+		return ErrSignatureInvalid
+	}
+
+	r := new(big.Int).SetBytes(sig[:n])
+	s := new(big.Int).SetBytes(sig[n:])
+	if !ecdsa.Verify(k, digest(a.Hash, input), r, s) {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
+
+// Alg implements Algorithm interface.
+func (a *EdDSA) Alg() string { return "EdDSA" }
+
+// Sign implements Algorithm interface.
+func (a *EdDSA) Sign(input string, key interface{}) ([]byte, error) {
+	k, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+	if len(k) != ed25519.PrivateKeySize {
+		return nil, ErrInvalidKey
+	}
+	return ed25519.Sign(k, []byte(input)), nil
+}
+
+// Verify implements Algorithm interface.
+func (a *EdDSA) Verify(input string, sig []byte, key interface{}) error {
+	k, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return ErrInvalidKeyType
+	}
+	if len(k) != ed25519.PublicKeySize {
+		return ErrInvalidKey
+	}
+	if !ed25519.Verify(k, []byte(input), sig) {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
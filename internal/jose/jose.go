@@ -0,0 +1,49 @@
+// Package jose implements the JWS(RFC 7515) primitives used by jwthelper.
+// It only imports the standard library.
+package jose
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrSignatureInvalid represents the error of invalid signature.
+	ErrSignatureInvalid = fmt.Errorf("signature is invalid")
+	// ErrInvalidKeyType represents the error of key type which does not match the alg.
+	ErrInvalidKeyType = fmt.Errorf("key is of invalid type")
+	// ErrInvalidKey represents the error of invalid key.
+	ErrInvalidKey = fmt.Errorf("key is invalid")
+	// ErrInvalidPartNum represents the error of invalid number of compact serialization parts.
+	ErrInvalidPartNum = fmt.Errorf("invalid number of JWS part")
+	// ErrDuplicateKey represents the error of duplicate member names in JSON object.
+	ErrDuplicateKey = fmt.Errorf("duplicate key in JSON object")
+	// ErrNotObject represents the error of JSON value which is not an object.
+	ErrNotObject = fmt.Errorf("JSON value is not an object")
+)
+
+// EncodeSegment encodes the part with base64url encoding without padding.
+func EncodeSegment(buf []byte) string {
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// DecodeSegment decodes the base64url-encoded part.
+// Padding and non-canonical encodings are rejected.
+func DecodeSegment(seg string) ([]byte, error) {
+	return base64.RawURLEncoding.Strict().DecodeString(seg)
+}
+
+// Split splits the compact serialization into header, payload and signature parts.
+func Split(s string) ([]string, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidPartNum
+	}
+	return parts, nil
+}
+
+// SigningInput returns the signing input of encoded header and payload.
+func SigningInput(header, payload string) string {
+	return header + "." + payload
+}
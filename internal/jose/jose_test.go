@@ -0,0 +1,284 @@
+package jose
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// Payload of RFC 7515 appendix A.1 - A.3.
+const rfc7515Payload = "eyJpc3MiOiJqb2UiLA0KICJleHAiOjEzMDA4MTkzODAsDQogImh0dHA6Ly9leGFtcGxlLmNvbS9pc19yb290Ijp0cnVlfQ"
+
+// Payload of RFC 7520 section 4.
+const rfc7520Payload = "SXTigJlzIGEgZGFuZ2Vyb3VzIGJ1c2luZXNzLCBGcm9kbywgZ29pbmcgb3V0IHlvdXIgZG9vci4gWW91IHN0ZXAgb250byB0aGUgcm9hZCwgYW5kIGlmIHlvdSBkb24ndCBrZWVwIHlvdXIgZmVldCwgdGhlcmXigJlzIG5vIGtub3dpbmcgd2hlcmUgeW91IG1pZ2h0IGJlIHN3ZXB0IG9mZiB0by4"
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := DecodeSegment(s)
+	if err != nil {
+		t.Fatalf("DecodeSegment(%q) error: %v", s, err)
+	}
+	return b
+}
+
+func bigInt(t *testing.T, s string) *big.Int {
+	return new(big.Int).SetBytes(mustDecode(t, s))
+}
+
+// rfc7515RSAKey returns the RSA key of RFC 7515 appendix A.2.
+func rfc7515RSAKey(t *testing.T) *rsa.PrivateKey {
+	k := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{
+			N: bigInt(t, "ofgWCuLjybRlzo0tZWJjNiuSfb4p4fAkd_wWJcyQoTbji9k0l8W26mPddxHmfHQp-Vaw-4qPCJrcS2mJPMEzP1Pt0Bm4d4QlL-yRT-SFd2lZS-pCgNMsD1W_YpRPEwOWvG6b32690r2jZ47soMZo9wGzjb_7OMg0LOL-bSf63kpaSHSXndS5z5rexMdbBYUsLA9e-KXBdQOS-UTo7WTBEMa2R2CapHg665xsmtdVMTBQY4uDZlxvb3qCo5ZwKh9kG4LT6_I5IhlJH7aGhyxXFvUK-DWNmoudF8NAco9_h9iaGNj8q2ethFkMLs91kzk2PAcDTW9gb54h4FRWyuXpoQ"),
+			E: 65537,
+		},
+		D: bigInt(t, "Eq5xpGnNCivDflJsRQBXHx1hdR1k6Ulwe2JZD50LpXyWPEAeP88vLNO97IjlA7_GQ5sLKMgvfTeXZx9SE-7YwVol2NXOoAJe46sui395IW_GO-pWJ1O0BkTGoVEn2bKVRUCgu-GjBVaYLU6f3l9kJfFNS3E0QbVdxzubSu3Mkqzjkn439X0M_V51gfpRLI9JYanrC4D4qAdGcopV_0ZHHzQlBjudU2QvXt4ehNYTCBr6XCLQUShb1juUO1ZdiYoFaFQT5Tw8bGUl_x_jTj3ccPDVZFD9pIuhLhBOneufuBiB4cS98l2SR_RQyGWSeWjnczT0QU91p1DhOVRuOopznQ"),
+		Primes: []*big.Int{
+			bigInt(t, "4BzEEOtIpmVdVEZNCqS7baC4crd0pqnRH_5IB3jw3bcxGn6QLvnEtfdUdiYrqBdss1l58BQ3KhooKeQTa9AB0Hw_Py5PJdTJNPY8cQn7ouZ2KKDcmnPGBY5t7yLc1QlQ5xHdwW1VhvKn-nXqhJTBgIPgtldC-KDV5z-y2XDwGUc"),
+			bigInt(t, "uQPEfgmVtjL0Uyyx88GZFF1fOunH3-7cepKmtH4pxhtCoHqpWmT8YAmZxaewHgHAjLYsp1ZSe7zFYHj7C6ul7TjeLQeZD_YwD66t62wDmpe_HlB-TnBA-njbglfIsRLtXlnDzQkv5dTltRJ11BKBBypeeF6689rjcJIDEz9RWdc"),
+		},
+	}
+	k.Precompute()
+	if err := k.Validate(); err != nil {
+		t.Fatalf("RSA key Validate() error: %v", err)
+	}
+	return k
+}
+
+// ecKey returns the ECDSA key of the JWK "x", "y" and "d".
+func ecKey(t *testing.T, curve elliptic.Curve, x, y, d string) *ecdsa.PrivateKey {
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{Curve: curve, X: bigInt(t, x), Y: bigInt(t, y)},
+		D:         bigInt(t, d),
+	}
+}
+
+func TestVectors(t *testing.T) {
+	rsaKey := rfc7515RSAKey(t)
+	es256Key := ecKey(t, elliptic.P256(),
+		"f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU",
+		"x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0",
+		"jpsQnnGQmL-YBIffH1136cspYG6-0iY7X1fCE9-E9LI")
+	es512Pub := &ecdsa.PublicKey{
+		Curve: elliptic.P521(),
+		X:     bigInt(t, "AHKZLLOsCOzz5cY97ewNUajB957y-C-U88c3v13nmGZx6sYl_oJXu9A5RkTKqjqvjyekWF-7ytDyRXYgCF5cj0Kt"),
+		Y:     bigInt(t, "AdymlHvOiLxXkEhayXQnNCvDX4h9htZaCJN34kfmC6pV5OhQHiraVySsUdaQkAgDPrwQrJmbnX9cwlGfP-HqHZR1"),
+	}
+	edKey := ed25519.NewKeyFromSeed(mustDecode(t, "nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A"))
+
+	tests := []struct {
+		name    string
+		alg     string
+		input   string
+		sig     string
+		signKey interface{}
+		// Deterministic algorithms must reproduce sig.
+		deterministic bool
+		verifyKey     interface{}
+	}{
+		{
+			name:          "RFC 7515 A.1",
+			alg:           "HS256",
+			input:         SigningInput("eyJ0eXAiOiJKV1QiLA0KICJhbGciOiJIUzI1NiJ9", rfc7515Payload),
+			sig:           "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk",
+			signKey:       mustDecode(t, "AyM1SysPpbyDfgZld3umj1qzKObwVMkoqQ-EstJQLr_T-1qS0gZH75aKtMN3Yj0iPS4hcgUuTwjAzZr1Z9CAow"),
+			deterministic: true,
+		},
+		{
+			name:          "RFC 7515 A.2",
+			alg:           "RS256",
+			input:         SigningInput("eyJhbGciOiJSUzI1NiJ9", rfc7515Payload),
+			sig:           "cC4hiUPoj9Eetdgtv3hF80EGrhuB__dzERat0XF9g2VtQgr9PJbu3XOiZj5RZmh7AAuHIm4Bh-0Qc_lF5YKt_O8W2Fp5jujGbds9uJdbF9CUAr7t1dnZcAcQjbKBYNX4BAynRFdiuB--f_nZLgrnbyTyWzO75vRK5h6xBArLIARNPvkSjtQBMHlb1L07Qe7K0GarZRmB_eSN9383LcOLn6_dO--xi12jzDwusC-eOkHWEsqtFZESc6BfI7noOPqvhJ1phCnvWh6IeYI2w9QOYEUipUTI8np6LbgGY9Fs98rqVt5AXLIhWkWywlVmtVrBp0igcN_IoypGlUPQGe77Rw",
+			signKey:       rsaKey,
+			deterministic: true,
+			verifyKey:     &rsaKey.PublicKey,
+		},
+		{
+			name:      "RFC 7515 A.3",
+			alg:       "ES256",
+			input:     SigningInput("eyJhbGciOiJFUzI1NiJ9", rfc7515Payload),
+			sig:       "DtEhU3ljbEg8L38VWAfUAqOyKAM6-Xx-F4GawxaepmXFCgfTjDxw5djxLa8ISlSApmWQxfKTUJqPP3-Kg6NU1Q",
+			signKey:   es256Key,
+			verifyKey: &es256Key.PublicKey,
+		},
+		{
+			name:          "RFC 7520 4.4",
+			alg:           "HS256",
+			input:         SigningInput("eyJhbGciOiJIUzI1NiIsImtpZCI6IjAxOGMwYWU1LTRkOWItNDcxYi1iZmQ2LWVlZjMxNGJjNzAzNyJ9", rfc7520Payload),
+			sig:           "s0h6KThzkfBBBkLspW1h84VsJZFTsPPqMDA7g1Md7p0",
+			signKey:       mustDecode(t, "hJtXIZ2uSN5kbQfbtTNWbpdmhkV8FJG-Onbc6mxCcYg"),
+			deterministic: true,
+		},
+		{
+			name:      "RFC 7520 4.3",
+			alg:       "ES512",
+			input:     SigningInput("eyJhbGciOiJFUzUxMiIsImtpZCI6ImJpbGJvLmJhZ2dpbnNAaG9iYml0b24uZXhhbXBsZSJ9", rfc7520Payload),
+			sig:       "AE_R_YZCChjn4791jSQCrdPZCNYqHXCTZH0-JZGYNlaAjP2kqaluUIIUnC9qvbu9Plon7KRTzoNEuT4Va2cmL1eJAQy3mtPBu_u_sDDyYjnAMDxXPn7XrT0lw-kvAD890jl8e2puQens_IEKBpHABlsbEPX6sFY8OcGDqoRuBomu9xQ2",
+			verifyKey: es512Pub,
+		},
+		{
+			name:          "RFC 8037 A.4",
+			alg:           "EdDSA",
+			input:         SigningInput("eyJhbGciOiJFZERTQSJ9", "RXhhbXBsZSBvZiBFZDI1NTE5IHNpZ25pbmc"),
+			sig:           "hgyY0il_MGCjP0JzlnLWG1PPOt7-09PGcvMg3AIbQR6dWbhijcNR4ki4iylGjg5BhVsPt9g7sVvpAr_MuM0KAg",
+			signKey:       edKey,
+			deterministic: true,
+			verifyKey:     edKey.Public(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, ok := Lookup(tt.alg)
+			if !ok {
+				t.Fatalf("Lookup(%q) failed", tt.alg)
+			}
+			verifyKey := tt.verifyKey
+			if verifyKey == nil {
+				verifyKey = tt.signKey
+			}
+
+			// Published signature.
+			sig := mustDecode(t, tt.sig)
+			if err := a.Verify(tt.input, sig, verifyKey); err != nil {
+				t.Errorf("Verify() error: %v", err)
+			}
+
+			// Tampered input.
+			if err := a.Verify(tt.input+"x", sig, verifyKey); !errors.Is(err, ErrSignatureInvalid) {
+				t.Errorf("Verify() of tampered input: %v, want %v", err, ErrSignatureInvalid)
+			}
+
+			if tt.signKey == nil {
+				return
+			}
+
+			got, err := a.Sign(tt.input, tt.signKey)
+			if err != nil {
+				t.Fatalf("Sign() error: %v", err)
+			}
+			if tt.deterministic && EncodeSegment(got) != tt.sig {
+				t.Errorf("Sign() = %v, want %v", EncodeSegment(got), tt.sig)
+			}
+			if err := a.Verify(tt.input, got, verifyKey); err != nil {
+				t.Errorf("Verify() of new signature error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	rsaKey := rfc7515RSAKey(t)
+	es512Key := ecKey(t, elliptic.P521(),
+		"AekpBQ8ST8a8VcfVOTNl353vSrDCLLJXmPk06wTjxrrjcBpXp5EOnYG_NjFZ6OvLFV1jSfS9tsz4qUxcWceqwQGk",
+		"ADSmRA43Z1DSNx_RvcLI87cdL07l6jQyyBXMoxVg_l2Th-x3S1WDhjDly79ajL4Kkd0AZMaZmh9ubmf63e3kyMj2",
+		"AY5pb7A0UFiB3RELSD64fTLOSV_jazdF7fLYyuTw8lOfRhWg6Y6rUrPAxerEzgdRhajnu0ferB0d53vM9mE15j2C")
+	es384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+
+	tests := []struct {
+		alg       string
+		signKey   interface{}
+		verifyKey interface{}
+	}{
+		{"RS384", rsaKey, &rsaKey.PublicKey},
+		{"RS512", rsaKey, &rsaKey.PublicKey},
+		{"PS256", rsaKey, &rsaKey.PublicKey},
+		{"PS384", rsaKey, &rsaKey.PublicKey},
+		{"PS512", rsaKey, &rsaKey.PublicKey},
+		{"ES384", es384Key, &es384Key.PublicKey},
+		{"ES512", es512Key, &es512Key.PublicKey},
+	}
+
+	input := SigningInput("eyJ0eXAiOiJKV1QifQ", rfc7515Payload)
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			a, _ := Lookup(tt.alg)
+			sig, err := a.Sign(input, tt.signKey)
+			if err != nil {
+				t.Fatalf("Sign() error: %v", err)
+			}
+			if err = a.Verify(input, sig, tt.verifyKey); err != nil {
+				t.Errorf("Verify() error: %v", err)
+			}
+			if err = a.Verify(input, sig[:len(sig)-1], tt.verifyKey); !errors.Is(err, ErrSignatureInvalid) {
+				t.Errorf("Verify() of truncated signature: %v, want %v", err, ErrSignatureInvalid)
+			}
+		})
+	}
+}
+
+func TestKeyMismatch(t *testing.T) {
+	es256, _ := Lookup("ES256")
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+	if _, err = es256.Sign("input", p384Key); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("ES256 Sign() with P-384 key: %v, want %v", err, ErrInvalidKey)
+	}
+
+	hs256, _ := Lookup("HS256")
+	if _, err = hs256.Sign("input", "secret"); !errors.Is(err, ErrInvalidKeyType) {
+		t.Errorf("HS256 Sign() with string key: %v, want %v", err, ErrInvalidKeyType)
+	}
+
+	if _, ok := Lookup("none"); ok {
+		t.Errorf(`Lookup("none") succeeded`)
+	}
+}
+
+func TestDecodeSegment(t *testing.T) {
+	tests := []struct {
+		seg string
+		ok  bool
+	}{
+		{"eyJhbGciOiJIUzI1NiJ9", true},
+		{"eyJhbGciOiJIUzI1NiJ9==", false}, // Padding.
+		{"eyJhbGciOiJIUzI1NiJ9+/", false}, // Standard alphabet.
+		{"eyJhbGciOiJIUzI1NiJ9a", false},  // Invalid length.
+		{"eyJhbGciOiJIUzI1NiJ", false},    // Non-zero trailing bits.
+	}
+
+	for _, tt := range tests {
+		_, err := DecodeSegment(tt.seg)
+		if (err == nil) != tt.ok {
+			t.Errorf("DecodeSegment(%q) error: %v, want ok: %v", tt.seg, err, tt.ok)
+		}
+	}
+}
+
+func TestDecodeObject(t *testing.T) {
+	tests := []struct {
+		data string
+		err  error
+	}{
+		{`{"a":1,"b":{"c":[1,{"d":2}]}}`, nil},
+		{`{"alg":"HS256","alg":"none"}`, ErrDuplicateKey},
+		{`{"a":{"b":1,"b":2}}`, ErrDuplicateKey},
+		{`{"a":[{"b":1,"b":2}]}`, ErrDuplicateKey},
+		{`[1,2]`, ErrNotObject},
+		{`"alg"`, ErrNotObject},
+		{`{"a":1}{"b":2}`, ErrNotObject},
+	}
+
+	for _, tt := range tests {
+		_, err := DecodeObject([]byte(tt.data), true)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("DecodeObject(%s) error: %v, want %v", tt.data, err, tt.err)
+		}
+	}
+
+	for _, data := range []string{``, `{"a":`, `{"a":1`} {
+		if _, err := DecodeObject([]byte(data), true); err == nil {
+			t.Errorf("DecodeObject(%s) succeeded", data)
+		}
+	}
+}
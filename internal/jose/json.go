@@ -0,0 +1,87 @@
+package jose
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// DecodeObject decodes the JSON object.
+// Duplicate member names are rejected at any level(RFC 7515 section 5.2).
+//
+// useNumber: decode numbers as json.Number instead of float64.
+func DecodeObject(data []byte, useNumber bool) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if useNumber {
+		dec.UseNumber()
+	}
+
+	v, err := decodeValue(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, ErrNotObject
+	}
+
+	// No trailing data is allowed.
+	if _, err = dec.Token(); err != io.EOF {
+		return nil, ErrNotObject
+	}
+	return m, nil
+}
+
+// decodeValue decodes the next JSON value.
+func decodeValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	d, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+
+	switch d {
+	case '{':
+		m := map[string]interface{}{}
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			k := tok.(string)
+			if _, ok := m[k]; ok {
+				return nil, ErrDuplicateKey
+			}
+			if m[k], err = decodeValue(dec); err != nil {
+				return nil, err
+			}
+		}
+		// Consume '}'.
+		if _, err = dec.Token(); err != nil {
+			return nil, err
+		}
+		return m, nil
+	default:
+		a := []interface{}{}
+		for dec.More() {
+			v, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		// Consume ']'.
+		if _, err = dec.Token(); err != nil {
+			return nil, err
+		}
+		return a, nil
+	}
+}
@@ -0,0 +1,138 @@
+package jose
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+var (
+	// ErrNotPEM represents the error of key which is not PEM encoded.
+	ErrNotPEM = fmt.Errorf("key must be PEM encoded")
+)
+
+// pemBytes returns the DER bytes of the first PEM block.
+func pemBytes(key []byte) ([]byte, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, ErrNotPEM
+	}
+	return block.Bytes, nil
+}
+
+// parsePrivateKey parses PKCS #1, SEC 1 or PKCS #8 private key in PEM.
+func parsePrivateKey(key []byte) (interface{}, error) {
+	der, err := pemBytes(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if k, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParseECPrivateKey(der); err == nil {
+		return k, nil
+	}
+	return x509.ParsePKCS8PrivateKey(der)
+}
+
+// parsePublicKey parses PKIX or PKCS #1 public key, or certificate in PEM.
+func parsePublicKey(key []byte) (interface{}, error) {
+	der, err := pemBytes(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if k, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return k, nil
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return cert.PublicKey, nil
+}
+
+// ParseRSAPrivateKeyFromPEM parses RSA private key in PEM.
+func ParseRSAPrivateKeyFromPEM(key []byte) (*rsa.PrivateKey, error) {
+	k, err := parsePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+	return rsaKey, nil
+}
+
+// ParseRSAPublicKeyFromPEM parses RSA public key in PEM.
+func ParseRSAPublicKeyFromPEM(key []byte) (*rsa.PublicKey, error) {
+	k, err := parsePublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := k.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+	return rsaKey, nil
+}
+
+// ParseECPrivateKeyFromPEM parses ECDSA private key in PEM.
+func ParseECPrivateKeyFromPEM(key []byte) (*ecdsa.PrivateKey, error) {
+	k, err := parsePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := k.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+	return ecKey, nil
+}
+
+// ParseECPublicKeyFromPEM parses ECDSA public key in PEM.
+func ParseECPublicKeyFromPEM(key []byte) (*ecdsa.PublicKey, error) {
+	k, err := parsePublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := k.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+	return ecKey, nil
+}
+
+// ParseEdPrivateKeyFromPEM parses Ed25519 private key in PEM(PKCS #8).
+func ParseEdPrivateKeyFromPEM(key []byte) (ed25519.PrivateKey, error) {
+	k, err := parsePrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+	return edKey, nil
+}
+
+// ParseEdPublicKeyFromPEM parses Ed25519 public key in PEM(PKIX).
+func ParseEdPublicKeyFromPEM(key []byte) (ed25519.PublicKey, error) {
+	k, err := parsePublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := k.(ed25519.PublicKey)
+	if !ok {
+		return nil, ErrInvalidKeyType
+	}
+	return edKey, nil
+}
@@ -0,0 +1,307 @@
+package jwthelper
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/northbright/jwthelper/internal/jose"
+)
+
+// jwk is the JSON Web Key(RFC 7517) of a verifying key.
+// Private key parameters are ignored.
+type jwk struct {
+	Kty    string   `json:"kty"`
+	Kid    string   `json:"kid,omitempty"`
+	Alg    string   `json:"alg,omitempty"`
+	Use    string   `json:"use,omitempty"`
+	KeyOps []string `json:"key_ops,omitempty"`
+	// RSA.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC and OKP.
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	// oct.
+	K string `json:"k,omitempty"`
+}
+
+// jwks is the JWK Set(RFC 7517 section 5).
+type jwks struct {
+	Keys []json.RawMessage `json:"keys"`
+}
+
+var (
+	// ErrInvalidJWK represents the error of invalid JWK.
+	ErrInvalidJWK = fmt.Errorf("invalid JWK")
+	// ErrUnsupportedJWK represents the error of JWK which is not a signature verifying key
+	// or its "kty", "crv" or "alg" is not supported.
+	ErrUnsupportedJWK = fmt.Errorf("unsupported JWK")
+	// ErrNoKeys represents the error of JWK Set without any usable key.
+	ErrNoKeys = fmt.Errorf("no usable keys in JWK Set")
+	// ErrDuplicateKID represents the error of "kid" shared by several keys of a JWK Set.
+	// It's wrapped with ErrUnknownKID.
+	ErrDuplicateKID = fmt.Errorf("kid is shared by several keys")
+)
+
+// curves maps "crv" of EC keys to the curve and "alg".
+var curves = map[string]struct {
+	curve elliptic.Curve
+	ecdh  ecdh.Curve
+	alg   string
+}{
+	"P-256": {elliptic.P256(), ecdh.P256(), "ES256"},
+	"P-384": {elliptic.P384(), ecdh.P384(), "ES384"},
+	"P-521": {elliptic.P521(), ecdh.P521(), "ES512"},
+}
+
+// decodeBigInt decodes the base64url-encoded unsigned big-endian integer.
+func decodeBigInt(s string) (*big.Int, error) {
+	buf, err := jose.DecodeSegment(s)
+	if err != nil || len(buf) == 0 {
+		return nil, ErrInvalidJWK
+	}
+	return new(big.Int).SetBytes(buf), nil
+}
+
+// ParseJWK parses the JSON Web Key(RFC 7517) and returns the verifying key.
+//
+// data: JSON of the JWK.
+// options: variadic options returned by option helper functions.
+// e.g. KeyInsecure(true)
+// comments:
+// "kty" may be "RSA", "EC", "OKP"(Ed25519) or "oct".
+// The key is bound to "alg" of the JWK. If "alg" is absent, it's "RS256" for RSA keys,
+// "ES256", "ES384" or "ES512" for EC keys by "crv" and "EdDSA" for OKP keys.
+// "alg" is required for "oct" keys.
+// Keys which "use" is not "sig" or "key_ops" does not contain "verify" are refused.
+// "kid" of the JWK overrides KeyID option.
+func ParseJWK(data []byte, options ...KeyOption) (*Key, error) {
+	var j jwk
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, wrapError(ErrInvalidJWK, err)
+	}
+
+	if j.Use != "" && j.Use != "sig" {
+		return nil, fmt.Errorf("%w: use %q", ErrUnsupportedJWK, j.Use)
+	}
+	if j.KeyOps != nil && !contains(j.KeyOps, "verify") {
+		return nil, fmt.Errorf("%w: key_ops %q", ErrUnsupportedJWK, j.KeyOps)
+	}
+
+	var (
+		k   interface{}
+		alg string
+	)
+
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeBigInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(j.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 || e.Bit(0) == 0 {
+			return nil, ErrInvalidJWK
+		}
+		k = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		alg = "RS256"
+	case "EC":
+		c, ok := curves[j.Crv]
+		if !ok {
+			return nil, fmt.Errorf("%w: crv %q", ErrUnsupportedJWK, j.Crv)
+		}
+		x, err := jose.DecodeSegment(j.X)
+		if err != nil {
+			return nil, ErrInvalidJWK
+		}
+		y, err := jose.DecodeSegment(j.Y)
+		if err != nil {
+			return nil, ErrInvalidJWK
+		}
+
+		// Coordinates are full-size(RFC 7518 section 6.2.1.2).
+		// The point is validated by crypto/ecdh.
+		size := (c.curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, ErrInvalidJWK
+		}
+		point := append(append([]byte{4}, x...), y...)
+		if _, err = c.ecdh.NewPublicKey(point); err != nil {
+			return nil, ErrInvalidJWK
+		}
+
+		k = &ecdsa.PublicKey{
+			Curve: c.curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		alg = c.alg
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, fmt.Errorf("%w: crv %q", ErrUnsupportedJWK, j.Crv)
+		}
+		x, err := jose.DecodeSegment(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, ErrInvalidJWK
+		}
+		k = ed25519.PublicKey(x)
+		alg = "EdDSA"
+	case "oct":
+		secret, err := jose.DecodeSegment(j.K)
+		if err != nil {
+			return nil, ErrInvalidJWK
+		}
+		k = secret
+	default:
+		return nil, fmt.Errorf("%w: kty %q", ErrUnsupportedJWK, j.Kty)
+	}
+
+	if j.Alg != "" {
+		alg = j.Alg
+	}
+	m, ok := jose.Lookup(alg)
+	if !ok {
+		return nil, fmt.Errorf("%w: alg %q", ErrUnsupportedJWK, alg)
+	}
+
+	o := keyOptions{}
+	for _, op := range options {
+		op.f(&o)
+	}
+	if j.Kid != "" {
+		o.kid = j.Kid
+	}
+	return newKeyFromCrypto(m, k, false, o)
+}
+
+// ParseJWKS parses the JWK Set(RFC 7517 section 5) and returns the verifying keys.
+//
+// comments:
+// Keys which are not supported(e.g. encryption keys) are skipped(RFC 7517 section 5).
+// It returns ErrNoKeys if no keys are usable.
+// See ParseJWK() for options and keys.
+func ParseJWKS(data []byte, options ...KeyOption) ([]*Key, error) {
+	var set jwks
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, wrapError(ErrInvalidJWK, err)
+	}
+
+	keys := []*Key{}
+	for _, raw := range set.Keys {
+		k, err := ParseJWK(raw, options...)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, k)
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	return keys, nil
+}
+
+// newJWK returns the JWK of the public key with given "kid".
+// Symmetric keys are refused because they can not be published.
+func newJWK(k *Key, kid string) (*jwk, error) {
+	j := &jwk{Kid: kid, Alg: k.Alg(), Use: k.Use()}
+
+	switch key := k.verifyingKey().(type) {
+	case *rsa.PublicKey:
+		j.Kty = "RSA"
+		j.N = jose.EncodeSegment(key.N.Bytes())
+		j.E = jose.EncodeSegment(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		// Coordinates are full-size(RFC 7518 section 6.2.1.2).
+		size := (key.Curve.Params().BitSize + 7) / 8
+		j.Kty = "EC"
+		j.Crv = key.Curve.Params().Name
+		j.X = jose.EncodeSegment(key.X.FillBytes(make([]byte, size)))
+		j.Y = jose.EncodeSegment(key.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		j.Kty = "OKP"
+		j.Crv = "Ed25519"
+		j.X = jose.EncodeSegment(key)
+	default:
+		return nil, fmt.Errorf("%w: %v key can not be published", ErrUnsupportedJWK, k.Alg())
+	}
+	return j, nil
+}
+
+// PublicJWK returns the JSON Web Key(RFC 7517) of the public key.
+// Private key parameters are never included.
+// It returns ErrUnsupportedJWK for HMAC keys.
+func (k *Key) PublicJWK() ([]byte, error) {
+	j, err := newJWK(k, k.kid)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(j)
+}
+
+// MarshalJWKS returns the JWK Set(RFC 7517 section 5) of the public keys.
+// It returns ErrUnsupportedJWK if any key is an HMAC key.
+func MarshalJWKS(keys ...*Key) ([]byte, error) {
+	set := jwks{Keys: []json.RawMessage{}}
+	for _, k := range keys {
+		j, err := k.PublicJWK()
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, j)
+	}
+	return json.Marshal(set)
+}
+
+// Thumbprint returns the JWK Thumbprint(RFC 7638) of the public key:
+// base64url encoding of the SHA-256 hash of the required JWK members in lexicographic order.
+// It returns ErrUnsupportedJWK for HMAC keys.
+func (k *Key) Thumbprint() (string, error) {
+	j, err := newJWK(k, "")
+	if err != nil {
+		return "", err
+	}
+
+	// Struct fields are marshaled in order without whitespace.
+	// See https://www.rfc-editor.org/rfc/rfc7638#section-3.2
+	var v interface{}
+	switch j.Kty {
+	case "RSA":
+		v = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.Kty, j.N}
+	case "EC":
+		v = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{j.Crv, j.Kty, j.X, j.Y}
+	default:
+		v = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Crv, j.Kty, j.X}
+	}
+
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(buf)
+	return jose.EncodeSegment(sum[:]), nil
+}
@@ -0,0 +1,264 @@
+package jwthelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultJWKSRefreshInterval is the default minimum interval of fetching jwks_uri
+// when a token with unknown "kid" is parsed.
+const DefaultJWKSRefreshInterval = 5 * time.Minute
+
+// JWKSParser parses JWT token strings with the verifying keys of a JWK Set.
+// The key is selected by "kid" header parameter and it must be bound to the "alg" of the token.
+// It's safe for concurrent use and the keys can be replaced by Update() for key rotation.
+type JWKSParser struct {
+	m sync.RWMutex
+	// parsers stores parsers by "kid". It's nil for "kid" shared by several keys.
+	parsers map[string]*Parser
+	// unnamed stores parsers of keys without "kid".
+	unnamed []*Parser
+	options []ParserOption
+
+	// fetch fetches the JWK Set of jwks_uri. It's nil if the JWK Set is static.
+	fetch           func(ctx context.Context) ([]byte, error)
+	fetchM          sync.Mutex
+	lastFetch       time.Time
+	refreshInterval time.Duration
+}
+
+// NewJWKSParser creates a parser with given JWK Set(RFC 7517 section 5).
+//
+// jwks: JSON of the JWK Set.
+// options: variadic options returned by option helper functions.
+// They're used by the parser of each key. e.g. ParserUseJSONNumber(false).
+// ParserKeyOptions() is passed to ParseJWKS().
+func NewJWKSParser(jwks []byte, options ...ParserOption) (*JWKSParser, error) {
+	p := &JWKSParser{options: options}
+	if err := p.Update(jwks); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewJWKSParserFromKeys creates a parser with given verifying keys.
+func NewJWKSParserFromKeys(keys []*Key, options ...ParserOption) (*JWKSParser, error) {
+	p := &JWKSParser{options: options}
+	if err := p.SetKeys(keys); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewRemoteJWKSParser creates a parser with the JWK Set fetched from jwksURI.
+// The JWK Set is fetched again when a token with unknown "kid" is parsed
+// for key rotation, at most once per refresh interval.
+//
+// ctx: context for fetching the JWK Set for the first time.
+// jwksURI: URL of the JWK Set. e.g. "jwks_uri" in OIDC discovery metadata.
+// client: HTTP client. http.DefaultClient is used if it's nil.
+// options: See NewJWKSParser().
+func NewRemoteJWKSParser(ctx context.Context, jwksURI string, client *http.Client, options ...ParserOption) (*JWKSParser, error) {
+	p := &JWKSParser{
+		options: options,
+		fetch: func(ctx context.Context) ([]byte, error) {
+			return fetch(ctx, client, jwksURI)
+		},
+		refreshInterval: DefaultJWKSRefreshInterval,
+	}
+	if err := p.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetRefreshInterval sets the minimum interval of fetching jwks_uri for unknown "kid".
+// Default is DefaultJWKSRefreshInterval.
+func (p *JWKSParser) SetRefreshInterval(d time.Duration) {
+	p.fetchM.Lock()
+	defer p.fetchM.Unlock()
+	p.refreshInterval = d
+}
+
+// Refresh fetches the JWK Set from jwks_uri and replaces the keys.
+// It does nothing if the parser is not created by NewRemoteJWKSParser().
+func (p *JWKSParser) Refresh(ctx context.Context) error {
+	if p.fetch == nil {
+		return nil
+	}
+
+	p.fetchM.Lock()
+	defer p.fetchM.Unlock()
+	return p.refresh(ctx)
+}
+
+// refresh fetches the JWK Set. The caller must hold fetchM.
+func (p *JWKSParser) refresh(ctx context.Context) error {
+	p.lastFetch = time.Now()
+	jwks, err := p.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	return p.Update(jwks)
+}
+
+// refreshForKID fetches the JWK Set for unknown "kid" if the refresh interval has passed.
+// It returns true if the keys are refreshed.
+func (p *JWKSParser) refreshForKID() bool {
+	if p.fetch == nil {
+		return false
+	}
+
+	p.fetchM.Lock()
+	defer p.fetchM.Unlock()
+	if time.Since(p.lastFetch) < p.refreshInterval {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	return p.refresh(ctx) == nil
+}
+
+// Update replaces the keys with the keys of the JWK Set.
+// The keys are not changed if the JWK Set has no usable keys.
+func (p *JWKSParser) Update(jwks []byte) error {
+	// Get the key options.
+	tmp := &Parser{}
+	for _, op := range p.options {
+		op.f(tmp)
+	}
+
+	keys, err := ParseJWKS(jwks, tmp.keyOptions...)
+	if err != nil {
+		return err
+	}
+	return p.SetKeys(keys)
+}
+
+// SetKeys replaces the keys.
+// A "kid" shared by several keys is ambiguous and tokens with it are rejected with ErrDuplicateKID,
+// while the other keys are still used.
+func (p *JWKSParser) SetKeys(keys []*Key) error {
+	if len(keys) == 0 {
+		return ErrNoKeys
+	}
+
+	parsers := map[string]*Parser{}
+	unnamed := []*Parser{}
+	for _, k := range keys {
+		parser, err := NewParserFromKey(k, p.options...)
+		if err != nil {
+			return err
+		}
+		if k.kid == "" {
+			unnamed = append(unnamed, parser)
+			continue
+		}
+		if _, ok := parsers[k.kid]; ok {
+			parsers[k.kid] = nil
+			continue
+		}
+		parsers[k.kid] = parser
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.parsers = parsers
+	p.unnamed = unnamed
+	return nil
+}
+
+// Keys returns the verifying keys.
+func (p *JWKSParser) Keys() []*Key {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	keys := []*Key{}
+	for _, parser := range p.parsers {
+		if parser != nil {
+			keys = append(keys, parser.key)
+		}
+	}
+	for _, parser := range p.unnamed {
+		keys = append(keys, parser.key)
+	}
+	return keys
+}
+
+// candidates returns the parsers selected by the JOSE header.
+// The parser of "kid" is returned if "kid" header parameter is present.
+// Otherwise, parsers of keys without "kid" bound to the "alg" are returned.
+func (p *JWKSParser) candidates(header map[string]interface{}) ([]*Parser, error) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	if v, ok := header["kid"]; ok {
+		kid, ok := v.(string)
+		if !ok {
+			return nil, wrapError(ErrMalformed, ErrKIDType)
+		}
+		parser, ok := p.parsers[kid]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKID, kid)
+		}
+		if parser == nil {
+			return nil, fmt.Errorf("%w: %w: %q", ErrUnknownKID, ErrDuplicateKID, kid)
+		}
+		return []*Parser{parser}, nil
+	}
+
+	alg, _ := header["alg"].(string)
+	parsers := []*Parser{}
+	for _, parser := range p.unnamed {
+		if parser.key.Alg() == alg {
+			parsers = append(parsers, parser)
+		}
+	}
+	if len(parsers) == 0 {
+		return nil, wrapError(ErrUnknownKID, ErrKIDNotFound)
+	}
+	return parsers, nil
+}
+
+// Parse parses and verifies the token string with the key selected by "kid".
+func (p *JWKSParser) Parse(tokenString string) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+
+	_, claims, err := p.parse(tokenString)
+	if err != nil {
+		return m, err
+	}
+	return claims, nil
+}
+
+// parse parses the token string and returns the JOSE header and claims.
+func (p *JWKSParser) parse(tokenString string) (map[string]interface{}, map[string]interface{}, error) {
+	header, err := ParseHeader(tokenString)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parsers, err := p.candidates(header)
+	if errors.Is(err, ErrUnknownKID) && p.refreshForKID() {
+		// Keys may be rotated.
+		parsers, err = p.candidates(header)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Try each key without "kid" until the signature is verified.
+	for _, parser := range parsers {
+		h, claims, err := parser.parse(tokenString)
+		if errors.Is(err, ErrSignatureInvalid) {
+			continue
+		}
+		return h, claims, err
+	}
+	return nil, nil, ErrSignatureInvalid
+}
@@ -0,0 +1,249 @@
+package jwthelper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/northbright/jwthelper/internal/jose"
+)
+
+// MinRSAKeySize is the minimum size in bits of RSA keys.
+// See https://tools.ietf.org/html/rfc7518#section-3.3
+const MinRSAKeySize = 2048
+
+// Key is a signing or verifying key bound to exactly one "alg".
+// Its metadata uses JWK(RFC 7517) parameter names: "kid", "alg" and "use".
+// Signer and Parser never use the key with another alg.
+type Key struct {
+	kid     string
+	method  jose.Algorithm
+	key     interface{}
+	private bool
+}
+
+// KeyOption represents the option for creating a key.
+// Use option helper functions to set options:
+// e.g. KeyID(), KeyInsecure()
+type KeyOption struct {
+	f func(o *keyOptions)
+}
+
+// keyOptions stores the options for creating a key.
+type keyOptions struct {
+	kid      string
+	insecure bool
+}
+
+var (
+	// ErrInsecureKey represents the error of key which is too weak for the alg:
+	// HMAC secret shorter than the hash size, RSA key under MinRSAKeySize bits
+	// or HMAC secret which is a PEM key.
+	ErrInsecureKey = fmt.Errorf("key is insecure")
+	// ErrKeyAlgMismatch represents the error of key which can not be used with the alg.
+	ErrKeyAlgMismatch = fmt.Errorf("key does not match alg")
+	// ErrPublicKey represents the error of signing with a public key.
+	ErrPublicKey = fmt.Errorf("key is a public key")
+)
+
+// KeyID returns the option for "kid"(key ID).
+// Signer sets the "kid" header parameter and Parser rejects tokens with other "kid".
+func KeyID(kid string) KeyOption {
+	return KeyOption{func(o *keyOptions) {
+		o.kid = kid
+	}}
+}
+
+// KeyInsecure returns the option to accept keys refused by the default checks:
+// HMAC secrets shorter than the hash size, RSA keys under MinRSAKeySize bits
+// and HMAC secrets which are PEM keys.
+// Only use it for legacy keys.
+func KeyInsecure(flag bool) KeyOption {
+	return KeyOption{func(o *keyOptions) {
+		o.insecure = flag
+	}}
+}
+
+// newKey creates a key with given signing method and key.
+//
+// private: parse private PEM key if true, public PEM key if false.
+func newKey(m jose.Algorithm, key []byte, private bool, options ...KeyOption) (*Key, error) {
+	o := keyOptions{}
+	for _, op := range options {
+		op.f(&o)
+	}
+
+	var (
+		k   interface{}
+		err error
+	)
+
+	switch m.(type) {
+	case *jose.HMAC:
+		k = key
+	case *jose.RSA, *jose.RSAPSS:
+		if private {
+			k, err = jose.ParseRSAPrivateKeyFromPEM(key)
+		} else {
+			k, err = jose.ParseRSAPublicKeyFromPEM(key)
+		}
+	case *jose.ECDSA:
+		if private {
+			k, err = jose.ParseECPrivateKeyFromPEM(key)
+		} else {
+			k, err = jose.ParseECPublicKeyFromPEM(key)
+		}
+	case *jose.EdDSA:
+		if private {
+			k, err = jose.ParseEdPrivateKeyFromPEM(key)
+		} else {
+			k, err = jose.ParseEdPublicKeyFromPEM(key)
+		}
+	default:
+		return nil, ErrInvalidSigningMethod
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newKeyFromCrypto(m, k, private, o)
+}
+
+// newKeyFromCrypto binds the parsed key to the signing method after checking it.
+func newKeyFromCrypto(m jose.Algorithm, k interface{}, private bool, o keyOptions) (*Key, error) {
+	if err := checkKey(m, k, o.insecure); err != nil {
+		return nil, err
+	}
+	return &Key{kid: o.kid, method: m, key: k, private: private}, nil
+}
+
+// checkKey checks the key type and strength for the signing method.
+func checkKey(m jose.Algorithm, k interface{}, insecure bool) error {
+	switch a := m.(type) {
+	case *jose.HMAC:
+		secret, ok := k.([]byte)
+		if !ok {
+			return ErrKeyAlgMismatch
+		}
+		if len(secret) == 0 {
+			return ErrInsecureKey
+		}
+		if insecure {
+			return nil
+		}
+		// See https://tools.ietf.org/html/rfc7518#section-3.2
+		if len(secret) < a.Hash.Size() {
+			return fmt.Errorf("%w: %v secret is shorter than %v bytes", ErrInsecureKey, a.Alg(), a.Hash.Size())
+		}
+		// PEM keys are public: a token signed with them is the RS256 -> HS256 confusion attack.
+		if block, _ := pem.Decode(secret); block != nil {
+			return fmt.Errorf("%w: %v secret is a PEM key", ErrInsecureKey, a.Alg())
+		}
+	case *jose.RSA, *jose.RSAPSS:
+		var n int
+		switch key := k.(type) {
+		case *rsa.PrivateKey:
+			n = key.N.BitLen()
+		case *rsa.PublicKey:
+			n = key.N.BitLen()
+		default:
+			return ErrKeyAlgMismatch
+		}
+		if !insecure && n < MinRSAKeySize {
+			return fmt.Errorf("%w: RSA key size %v is less than %v", ErrInsecureKey, n, MinRSAKeySize)
+		}
+	case *jose.ECDSA:
+		var pub *ecdsa.PublicKey
+		switch key := k.(type) {
+		case *ecdsa.PrivateKey:
+			pub = &key.PublicKey
+		case *ecdsa.PublicKey:
+			pub = key
+		default:
+			return ErrKeyAlgMismatch
+		}
+		// ES256 uses P-256, ES384 uses P-384 and ES512 uses P-521 only.
+		if pub.Curve != a.Curve {
+			return fmt.Errorf("%w: %v requires %v", ErrKeyAlgMismatch, a.Alg(), a.Curve.Params().Name)
+		}
+	case *jose.EdDSA:
+		switch k.(type) {
+		case ed25519.PrivateKey, ed25519.PublicKey:
+		default:
+			return ErrKeyAlgMismatch
+		}
+	default:
+		return ErrInvalidSigningMethod
+	}
+	return nil
+}
+
+// NewSigningKey creates a signing key with given "alg"(RFC7518) and key.
+//
+// alg: See NewSigner().
+// key:
+// use random bytes as key for "HS256", "HS384", "HS512".
+// use private PEM string as key for other algs.
+// options: variadic options returned by option helper functions.
+// e.g. KeyID("key-1")
+func NewSigningKey(alg string, key []byte, options ...KeyOption) (*Key, error) {
+	m, ok := jose.Lookup(alg)
+	if !ok {
+		return nil, ErrInvalidAlg
+	}
+	return newKey(m, key, true, options...)
+}
+
+// NewVerifyingKey creates a verifying key with given "alg"(RFC7518) and key.
+//
+// alg: See NewParser().
+// key:
+// use random bytes as key for "HS256", "HS384", "HS512".
+// use public PEM string as key for other algs.
+// options: variadic options returned by option helper functions.
+// e.g. KeyID("key-1")
+func NewVerifyingKey(alg string, key []byte, options ...KeyOption) (*Key, error) {
+	m, ok := jose.Lookup(alg)
+	if !ok {
+		return nil, ErrInvalidAlg
+	}
+	return newKey(m, key, false, options...)
+}
+
+// KID returns the "kid" of the key.
+// It's empty if KeyID option is not set.
+func (k *Key) KID() string {
+	return k.kid
+}
+
+// Alg returns the only "alg" the key is used with.
+func (k *Key) Alg() string {
+	return k.method.Alg()
+}
+
+// Use returns the "use" of the key. It's always "sig".
+func (k *Key) Use() string {
+	return "sig"
+}
+
+// IsPrivate returns true if the key is created by NewSigningKey().
+func (k *Key) IsPrivate() bool {
+	return k.private
+}
+
+// verifyingKey returns the key used to verify signatures.
+func (k *Key) verifyingKey() interface{} {
+	if !k.private {
+		return k.key
+	}
+	switch key := k.key.(type) {
+	case crypto.Signer:
+		return key.Public()
+	default:
+		// HMAC secret.
+		return key
+	}
+}
@@ -0,0 +1,229 @@
+package jwthelper_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"log"
+	"testing"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleNewSigningKey() {
+	// Bind the key to "RS256" and "kid".
+	k, err := jwthelper.NewSigningKey("RS256", []byte(rsaPrivPEM), jwthelper.KeyID("key-1"))
+	if err != nil {
+		log.Printf("NewSigningKey() error: %v", err)
+		return
+	}
+
+	s, err := jwthelper.NewSignerFromKey(k)
+	if err != nil {
+		log.Printf("NewSignerFromKey() error: %v", err)
+		return
+	}
+
+	str, err := s.SignedString(jwthelper.NewClaim("uid", "1"))
+	if err != nil {
+		log.Printf("SignedString() error: %v", err)
+		return
+	}
+
+	header, _ := jwthelper.ParseHeader(str)
+	fmt.Println(header["alg"], header["kid"])
+
+	// Parser uses the public key of the signing key.
+	p, err := jwthelper.NewParserFromKey(k)
+	if err != nil {
+		log.Printf("NewParserFromKey() error: %v", err)
+		return
+	}
+	claims, err := p.Parse(str)
+	fmt.Println(claims["uid"], err)
+
+	// Short HMAC secrets are refused unless KeyInsecure(true) is passed.
+	_, err = jwthelper.NewSigner("HS256", []byte("secret"))
+	fmt.Println(errors.Is(err, jwthelper.ErrInsecureKey))
+
+	_, err = jwthelper.NewSigner("HS256", []byte("secret"), jwthelper.KeyInsecure(true))
+	fmt.Println(err)
+
+	// Output:
+	// RS256 key-1
+	// 1 <nil>
+	// true
+	// <nil>
+}
+
+func TestKeyBinding(t *testing.T) {
+	k := newVectorKeys(t)
+	hmacKey := mustDecode(t, hmacKeyRFC7515)
+
+	rsa1024, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+	rsa1024Priv, rsa1024Pub := keyPEMs(t, rsa1024)
+
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+	p384Priv, p384Pub := keyPEMs(t, p384)
+
+	tests := []struct {
+		name    string
+		alg     string
+		key     []byte
+		private bool
+		err     error
+		// insecureOK is true if KeyInsecure(true) accepts the key.
+		insecureOK bool
+	}{
+		{"HS256 31 bytes", "HS256", hmacKey[:31], true, jwthelper.ErrInsecureKey, true},
+		{"HS256 32 bytes", "HS256", hmacKey[:32], true, nil, true},
+		{"HS384 47 bytes", "HS384", hmacKey[:47], false, jwthelper.ErrInsecureKey, true},
+		{"HS512 63 bytes", "HS512", hmacKey[:63], false, jwthelper.ErrInsecureKey, true},
+		{"HS512 64 bytes", "HS512", hmacKey, false, nil, true},
+		{"HS256 empty", "HS256", []byte{}, true, jwthelper.ErrInsecureKey, false},
+		{"HS256 public PEM", "HS256", k.rsaPub, false, jwthelper.ErrInsecureKey, true},
+		{"RS256 1024 bits private", "RS256", rsa1024Priv, true, jwthelper.ErrInsecureKey, true},
+		{"PS256 1024 bits public", "PS256", rsa1024Pub, false, jwthelper.ErrInsecureKey, true},
+		{"RS256 2048 bits", "RS256", k.rsaPub, false, nil, true},
+		{"ES256 P-384 private", "ES256", p384Priv, true, jwthelper.ErrKeyAlgMismatch, false},
+		{"ES512 P-384 public", "ES512", p384Pub, false, jwthelper.ErrKeyAlgMismatch, false},
+		{"ES384 P-384", "ES384", p384Pub, false, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newKey := jwthelper.NewVerifyingKey
+			if tt.private {
+				newKey = jwthelper.NewSigningKey
+			}
+
+			_, err := newKey(tt.alg, tt.key)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("error: %v, want %v", err, tt.err)
+			}
+
+			_, err = newKey(tt.alg, tt.key, jwthelper.KeyInsecure(true))
+			if (err == nil) != tt.insecureOK {
+				t.Errorf("KeyInsecure(true) error: %v, want ok: %v", err, tt.insecureOK)
+			}
+		})
+	}
+}
+
+func TestKeyID(t *testing.T) {
+	k := newVectorKeys(t)
+
+	sign := func(kid string) string {
+		var options []jwthelper.KeyOption
+		if kid != "" {
+			options = append(options, jwthelper.KeyID(kid))
+		}
+		s, err := jwthelper.NewSigner("ES256", k.es256Priv, options...)
+		if err != nil {
+			t.Fatalf("NewSigner() error: %v", err)
+		}
+		// "kid" of the key can not be overridden.
+		str, err := s.SignedString(jwthelper.NewHeader("kid", "other"), jwthelper.NewClaim("sub", "frank"))
+		if err != nil {
+			t.Fatalf("SignedString() error: %v", err)
+		}
+		return str
+	}
+
+	p, err := jwthelper.NewParser("ES256", k.es256Pub, jwthelper.ParserKeyOptions(jwthelper.KeyID("key-1")))
+	if err != nil {
+		t.Fatalf("NewParser() error: %v", err)
+	}
+
+	tests := []struct {
+		kid string
+		err error
+	}{
+		{"key-1", nil},
+		{"key-2", jwthelper.ErrUnknownKID},
+	}
+
+	for _, tt := range tests {
+		_, err := p.Parse(sign(tt.kid))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Parse() of %q error: %v, want %v", tt.kid, err, tt.err)
+		}
+	}
+
+	// Public key can not sign.
+	pub, err := jwthelper.NewVerifyingKey("ES256", k.es256Pub)
+	if err != nil {
+		t.Fatalf("NewVerifyingKey() error: %v", err)
+	}
+	if _, err = jwthelper.NewSignerFromKey(pub); !errors.Is(err, jwthelper.ErrPublicKey) {
+		t.Errorf("NewSignerFromKey() error: %v, want %v", err, jwthelper.ErrPublicKey)
+	}
+}
+
+func TestMultipleKeysParserKID(t *testing.T) {
+	k := newVectorKeys(t)
+
+	rs, err := jwthelper.NewSigner("RS256", k.rsaPriv)
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	es, err := jwthelper.NewSigner("ES256", k.es256Priv)
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	rsParser, err := jwthelper.NewParser("RS256", k.rsaPub)
+	if err != nil {
+		t.Fatalf("NewParser() error: %v", err)
+	}
+	esParser, err := jwthelper.NewParser("ES256", k.es256Pub)
+	if err != nil {
+		t.Fatalf("NewParser() error: %v", err)
+	}
+
+	parser := jwthelper.NewMultipleKeysParser()
+	parser.Set("rsa", rsParser)
+	parser.Set("ec", esParser)
+
+	signed := func(s *jwthelper.Signer, claims ...jwthelper.Claim) string {
+		str, err := s.SignedString(claims...)
+		if err != nil {
+			t.Fatalf("SignedString() error: %v", err)
+		}
+		return str
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"header kid", signed(es, jwthelper.NewHeader("kid", "ec")), nil},
+		{"claim kid", signed(rs, jwthelper.NewClaim("kid", "rsa")), nil},
+		{"header kid of other alg", signed(rs, jwthelper.NewHeader("kid", "ec")), jwthelper.ErrAlgNotAllowed},
+		{"claim kid of other alg", signed(rs, jwthelper.NewClaim("kid", "ec")), jwthelper.ErrAlgNotAllowed},
+		{"header and claim kid mismatch", signed(es, jwthelper.NewHeader("kid", "ec"), jwthelper.NewClaim("kid", "rsa")), jwthelper.ErrUnknownKID},
+		{"unknown kid", signed(es, jwthelper.NewHeader("kid", "ed")), jwthelper.ErrUnknownKID},
+		{"no kid", signed(es), jwthelper.ErrUnknownKID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := parser.Parse(tt.token)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Parse() error: %v, want %v", err, tt.err)
+			}
+			if err != nil && len(claims) != 0 {
+				t.Errorf("Parse() returns claims: %v", claims)
+			}
+		})
+	}
+}
@@ -10,9 +10,13 @@ type MultipleKeysParser struct {
 
 var (
 	ErrInvalidMultipleKeysParser = fmt.Errorf("invalid multiple keys parser")
-	ErrKIDNotFound               = fmt.Errorf("kid not found in claims")
+	ErrKIDNotFound               = fmt.Errorf("kid not found in header or claims")
 	ErrKIDType                   = fmt.Errorf("invalid kid type(not string)")
-	ErrParserNotFound            = fmt.Errorf("parser not found by kid")
+	// ErrParserNotFound is wrapped with ErrUnknownKID.
+	ErrParserNotFound = fmt.Errorf("parser not found by kid")
+	// ErrKIDMismatch represents the error of "kid" header parameter and "kid" claim which are different.
+	// It's wrapped with ErrUnknownKID.
+	ErrKIDMismatch = fmt.Errorf("kid in header and claims mismatch")
 )
 
 func NewMultipleKeysParser() *MultipleKeysParser {
@@ -38,34 +42,55 @@ func (p *MultipleKeysParser) Valid() bool {
 	return true
 }
 
+// Parse selects the parser by "kid" and parses the token string.
+//
+// comments:
+// "kid" header parameter(RFC 7515 section 4.1.4) is used to select the parser.
+// The unverified "kid" claim is only used for tokens without "kid" header parameter,
+// and it must match the selected parser after the signature is verified.
+// The "alg" header parameter must be the alg bound to the key of the selected parser.
 func (p *MultipleKeysParser) Parse(tokenString string) (map[string]interface{}, error) {
 	if !p.Valid() {
 		return nil, ErrInvalidMultipleKeysParser
 	}
 
-	// Just parse claims but not verify the signature.
-	claims, err := ParseClaims(tokenString)
+	// Just parse header and claims but not verify the signature.
+	header, err := ParseHeader(tokenString)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get "kid".
-	v, ok := claims["kid"]
+	v, ok := header["kid"]
 	if !ok {
-		return nil, ErrKIDNotFound
+		claims, err := ParseClaims(tokenString)
+		if err != nil {
+			return nil, err
+		}
+		if v, ok = claims["kid"]; !ok {
+			return nil, wrapError(ErrUnknownKID, ErrKIDNotFound)
+		}
 	}
 
 	// Validate "kid" type == string.
 	kid, ok := v.(string)
 	if !ok {
-		return nil, ErrKIDType
+		return nil, wrapError(ErrMalformed, ErrKIDType)
 	}
 
 	// Get parser according to "kid".
 	parser, ok := p.parsers[kid]
 	if !ok {
-		return nil, ErrParserNotFound
+		return nil, wrapError(ErrUnknownKID, ErrParserNotFound)
 	}
 
-	return parser.Parse(tokenString)
+	claims, err := parser.Parse(tokenString)
+	if err != nil {
+		return claims, err
+	}
+
+	// "kid" claim is trusted after the signature is verified.
+	if v, ok := claims["kid"]; ok && v != kid {
+		return map[string]interface{}{}, wrapError(ErrUnknownKID, ErrKIDMismatch)
+	}
+	return claims, nil
 }
@@ -2,9 +2,14 @@ package jwthelper
 
 import (
 	"fmt"
+	"sort"
+	"sync"
 )
 
+// MultipleKeysSigner signs tokens with the signer selected by "kid".
+// It's safe for concurrent use and signers can be set while it's used(e.g. key rotation).
 type MultipleKeysSigner struct {
+	m       sync.RWMutex
 	signers map[string]*Signer
 }
 
@@ -20,16 +25,35 @@ func NewMultipleKeysSigner() *MultipleKeysSigner {
 }
 
 func (s *MultipleKeysSigner) Set(kid string, signer *Signer) {
+	s.m.Lock()
+	defer s.m.Unlock()
 	s.signers[kid] = signer
 }
 
 func (s *MultipleKeysSigner) Get(kid string) *Signer {
+	s.m.RLock()
+	defer s.m.RUnlock()
 	signer := s.signers[kid]
 
 	return signer
 }
 
+// KIDs returns the sorted "kid" of the signers.
+func (s *MultipleKeysSigner) KIDs() []string {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	kids := []string{}
+	for kid := range s.signers {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	return kids
+}
+
 func (s *MultipleKeysSigner) Valid() bool {
+	s.m.RLock()
+	defer s.m.RUnlock()
 	if s.signers == nil {
 		return false
 	}
@@ -46,6 +70,14 @@ func (s *MultipleKeysSigner) SignedString(kid string, claims ...Claim) (string,
 		return "", ErrSignerNotFound
 	}
 
-	claims = append(claims, NewClaim("kid", kid))
-	return signer.SignedString(claims...)
+	// The kid of the signing key takes precedence over the header parameter.
+	if k := signer.Key().KID(); k != "" && k != kid {
+		return "", wrapError(ErrUnknownKID, ErrKIDMismatch)
+	}
+
+	// Set both "kid" header parameter and "kid" claim for parsers of old versions.
+	c := make([]Claim, 0, len(claims)+2)
+	c = append(c, claims...)
+	c = append(c, NewClaim("kid", kid), NewHeader("kid", kid))
+	return signer.SignedString(c...)
 }
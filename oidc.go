@@ -0,0 +1,350 @@
+package jwthelper
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"fmt"
+	"time"
+
+	"github.com/northbright/jwthelper/internal/jose"
+)
+
+// IDToken is the verified OpenID Connect ID Token.
+// See https://openid.net/specs/openid-connect-core-1_0.html#IDToken
+type IDToken struct {
+	// Issuer is "iss" claim.
+	Issuer string
+	// Subject is "sub" claim.
+	Subject string
+	// Audience is "aud" claim.
+	Audience []string
+	// AuthorizedParty is "azp" claim.
+	AuthorizedParty string
+	// Expiry is "exp" claim.
+	Expiry time.Time
+	// IssuedAt is "iat" claim.
+	IssuedAt time.Time
+	// AuthTime is "auth_time" claim. It's zero if absent.
+	AuthTime time.Time
+	// Nonce is "nonce" claim.
+	Nonce string
+	// ACR is "acr" claim.
+	ACR string
+	// AMR is "amr" claim.
+	AMR []string
+	// AccessTokenHash is "at_hash" claim.
+	AccessTokenHash string
+	// CodeHash is "c_hash" claim.
+	CodeHash string
+	// Claims stores all claims including the standard claims above.
+	Claims Claims
+}
+
+// IDTokenVerifier verifies OpenID Connect ID Tokens issued for the client.
+// It enforces the rules of ID Token validation:
+// https://openid.net/specs/openid-connect-core-1_0.html#IDTokenValidation
+type IDTokenVerifier struct {
+	parser   *JWKSParser
+	issuer   string
+	clientID string
+	opts     idTokenOptions
+}
+
+// IDTokenOption represents the option for verifying ID Tokens.
+// Options passed to NewIDTokenVerifier() apply to all ID Tokens,
+// and options passed to Verify() apply to the ID Token only.
+// Use option helper functions to set options:
+// e.g. IDTokenNonce(), IDTokenMaxAge()
+type IDTokenOption struct {
+	f func(o *idTokenOptions)
+}
+
+// idTokenOptions stores the options for verifying ID Tokens.
+type idTokenOptions struct {
+	trustedAudiences []string
+	nonce            string
+	maxAge           time.Duration
+	acrValues        []string
+	accessToken      string
+	code             string
+	now              func() time.Time
+}
+
+var (
+	// ErrInvalidIDToken represents the error of ID Token which breaks ID Token validation rules.
+	// The rule is in the error message.
+	ErrInvalidIDToken = fmt.Errorf("invalid ID token")
+	// ErrNonceMismatch represents the error of "nonce" which does not match the nonce sent in the request.
+	// It's wrapped with ErrInvalidIDToken.
+	ErrNonceMismatch = fmt.Errorf("nonce mismatch")
+	// ErrAuthTooOld represents the error of "auth_time" which is older than max_age.
+	// It's wrapped with ErrInvalidIDToken.
+	ErrAuthTooOld = fmt.Errorf("authentication is too old")
+	// ErrACRNotAllowed represents the error of "acr" which is not one of the requested values.
+	// It's wrapped with ErrInvalidIDToken.
+	ErrACRNotAllowed = fmt.Errorf("acr is not allowed")
+	// ErrHashMismatch represents the error of "at_hash" or "c_hash" which does not match.
+	// It's wrapped with ErrInvalidIDToken.
+	ErrHashMismatch = fmt.Errorf("token hash mismatch")
+)
+
+// IDTokenTrustedAudiences returns the option for audiences trusted besides the client.
+// ID Tokens with other audiences are rejected.
+func IDTokenTrustedAudiences(audiences ...string) IDTokenOption {
+	return IDTokenOption{func(o *idTokenOptions) {
+		o.trustedAudiences = append(o.trustedAudiences, audiences...)
+	}}
+}
+
+// IDTokenNonce returns the option for "nonce" sent in the authentication request.
+// "nonce" claim must match it.
+func IDTokenNonce(nonce string) IDTokenOption {
+	return IDTokenOption{func(o *idTokenOptions) {
+		o.nonce = nonce
+	}}
+}
+
+// IDTokenMaxAge returns the option for "max_age" sent in the authentication request.
+// "auth_time" claim is required and the authentication must not be older than maxAge.
+func IDTokenMaxAge(maxAge time.Duration) IDTokenOption {
+	return IDTokenOption{func(o *idTokenOptions) {
+		o.maxAge = maxAge
+	}}
+}
+
+// IDTokenACRValues returns the option for "acr_values" sent in the authentication request.
+// "acr" claim is required and it must be one of the values.
+func IDTokenACRValues(values ...string) IDTokenOption {
+	return IDTokenOption{func(o *idTokenOptions) {
+		o.acrValues = values
+	}}
+}
+
+// IDTokenAccessToken returns the option for the access token issued with the ID Token.
+// "at_hash" claim is required and it must match the access token.
+func IDTokenAccessToken(accessToken string) IDTokenOption {
+	return IDTokenOption{func(o *idTokenOptions) {
+		o.accessToken = accessToken
+	}}
+}
+
+// IDTokenCode returns the option for the authorization code issued with the ID Token.
+// "c_hash" claim is required and it must match the code.
+func IDTokenCode(code string) IDTokenOption {
+	return IDTokenOption{func(o *idTokenOptions) {
+		o.code = code
+	}}
+}
+
+// IDTokenNow returns the option for the function which returns the current time.
+// It's used to check "auth_time". Default is time.Now.
+func IDTokenNow(now func() time.Time) IDTokenOption {
+	return IDTokenOption{func(o *idTokenOptions) {
+		o.now = now
+	}}
+}
+
+// NewIDTokenVerifier creates an ID Token verifier.
+//
+// p: parser with the JWK Set of the OpenID Provider.
+// issuer: "issuer" of the OpenID Provider. "iss" claim must match it exactly.
+// clientID: "client_id" of the client. "aud" claim must contain it.
+// options: variadic options returned by option helper functions.
+// e.g. IDTokenTrustedAudiences()
+func NewIDTokenVerifier(p *JWKSParser, issuer, clientID string, options ...IDTokenOption) *IDTokenVerifier {
+	v := &IDTokenVerifier{
+		parser:   p,
+		issuer:   issuer,
+		clientID: clientID,
+		opts:     idTokenOptions{now: time.Now},
+	}
+	for _, op := range options {
+		op.f(&v.opts)
+	}
+	return v
+}
+
+// invalidIDToken returns the error wrapped with ErrInvalidIDToken.
+func invalidIDToken(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: "+format, append([]interface{}{ErrInvalidIDToken}, a...)...)
+}
+
+// Verify verifies the ID Token and returns the standard claims.
+//
+// rawIDToken: "id_token" returned by the OpenID Provider.
+// options: variadic options for this ID Token. They override options of NewIDTokenVerifier().
+// e.g. IDTokenNonce(nonce), IDTokenAccessToken(accessToken)
+// comments:
+// The signature, "exp", "nbf" and "iat" are verified by the parser.
+// Errors of the parser are returned as is.
+func (v *IDTokenVerifier) Verify(rawIDToken string, options ...IDTokenOption) (*IDToken, error) {
+	o := v.opts
+	o.trustedAudiences = append([]string{}, v.opts.trustedAudiences...)
+	for _, op := range options {
+		op.f(&o)
+	}
+
+	header, claims, err := v.parser.parse(rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	c := Claims(claims)
+	t := &IDToken{Claims: c}
+
+	// Required claims.
+	if t.Issuer, err = c.String("iss"); err != nil {
+		return nil, wrapError(ErrInvalidIDToken, err)
+	}
+	if t.Subject, err = c.String("sub"); err != nil {
+		return nil, wrapError(ErrInvalidIDToken, err)
+	}
+	if t.Audience, err = c.Audience(); err != nil {
+		return nil, wrapError(ErrInvalidIDToken, err)
+	}
+	if t.Expiry, err = c.Time("exp"); err != nil {
+		return nil, wrapError(ErrInvalidIDToken, err)
+	}
+	if t.IssuedAt, err = c.Time("iat"); err != nil {
+		return nil, wrapError(ErrInvalidIDToken, err)
+	}
+
+	// Optional claims.
+	for name, dst := range map[string]*string{
+		"azp":     &t.AuthorizedParty,
+		"nonce":   &t.Nonce,
+		"acr":     &t.ACR,
+		"at_hash": &t.AccessTokenHash,
+		"c_hash":  &t.CodeHash,
+	} {
+		if c.Has(name) {
+			if *dst, err = c.String(name); err != nil {
+				return nil, wrapError(ErrInvalidIDToken, err)
+			}
+		}
+	}
+	if c.Has("amr") {
+		if t.AMR, err = c.StringSlice("amr"); err != nil {
+			return nil, wrapError(ErrInvalidIDToken, err)
+		}
+	}
+	if c.Has("auth_time") {
+		if t.AuthTime, err = c.Time("auth_time"); err != nil {
+			return nil, wrapError(ErrInvalidIDToken, err)
+		}
+	}
+
+	if t.Issuer != v.issuer {
+		return nil, invalidIDToken("iss %q is not %q", t.Issuer, v.issuer)
+	}
+
+	if err = v.checkAudience(t, o.trustedAudiences); err != nil {
+		return nil, err
+	}
+
+	if o.nonce != "" && subtle.ConstantTimeCompare([]byte(t.Nonce), []byte(o.nonce)) != 1 {
+		return nil, wrapError(ErrInvalidIDToken, ErrNonceMismatch)
+	}
+
+	if o.maxAge > 0 {
+		if t.AuthTime.IsZero() {
+			return nil, wrapError(ErrInvalidIDToken, claimError(ErrClaimNotFound, "auth_time"))
+		}
+		if o.now().Sub(t.AuthTime) > o.maxAge {
+			return nil, wrapError(ErrInvalidIDToken, ErrAuthTooOld)
+		}
+	}
+
+	if len(o.acrValues) > 0 && !contains(o.acrValues, t.ACR) {
+		return nil, wrapError(ErrInvalidIDToken, fmt.Errorf("%w: %q", ErrACRNotAllowed, t.ACR))
+	}
+
+	alg, _ := header["alg"].(string)
+	if o.accessToken != "" {
+		if err = checkTokenHash(alg, "at_hash", t.AccessTokenHash, o.accessToken); err != nil {
+			return nil, err
+		}
+	}
+	if o.code != "" {
+		if err = checkTokenHash(alg, "c_hash", t.CodeHash, o.code); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// checkAudience checks "aud" and "azp" claims.
+// "aud" must contain the client and other audiences must be trusted.
+// "azp" is required for multiple audiences and it must be the client if present.
+func (v *IDTokenVerifier) checkAudience(t *IDToken, trusted []string) error {
+	if !contains(t.Audience, v.clientID) {
+		return invalidIDToken("aud %q does not contain %q", t.Audience, v.clientID)
+	}
+	for _, aud := range t.Audience {
+		if aud != v.clientID && !contains(trusted, aud) {
+			return invalidIDToken("aud %q is not trusted", aud)
+		}
+	}
+
+	if len(t.Audience) > 1 && t.AuthorizedParty == "" {
+		return wrapError(ErrInvalidIDToken, claimError(ErrClaimNotFound, "azp"))
+	}
+	if t.AuthorizedParty != "" && t.AuthorizedParty != v.clientID {
+		return invalidIDToken("azp %q is not %q", t.AuthorizedParty, v.clientID)
+	}
+	return nil
+}
+
+// algHash returns the hash function of the "alg".
+// Ed25519 uses SHA-512.
+func algHash(alg string) (crypto.Hash, bool) {
+	m, ok := jose.Lookup(alg)
+	if !ok {
+		return 0, false
+	}
+	switch a := m.(type) {
+	case *jose.HMAC:
+		return a.Hash, true
+	case *jose.RSA:
+		return a.Hash, true
+	case *jose.RSAPSS:
+		return a.Hash, true
+	case *jose.ECDSA:
+		return a.Hash, true
+	case *jose.EdDSA:
+		return crypto.SHA512, true
+	default:
+		return 0, false
+	}
+}
+
+// TokenHash returns the "at_hash" or "c_hash" value of the token:
+// base64url encoding of the left-most half of the hash of the token
+// with the hash function of the ID Token "alg".
+// See https://openid.net/specs/openid-connect-core-1_0.html#CodeIDToken
+func TokenHash(alg, token string) (string, error) {
+	h, ok := algHash(alg)
+	if !ok {
+		return "", ErrInvalidAlg
+	}
+	hasher := h.New()
+	hasher.Write([]byte(token))
+	sum := hasher.Sum(nil)
+	return encodeSegment(sum[:len(sum)/2]), nil
+}
+
+// checkTokenHash checks the "at_hash" or "c_hash" claim.
+func checkTokenHash(alg, name, value, token string) error {
+	if value == "" {
+		return wrapError(ErrInvalidIDToken, claimError(ErrClaimNotFound, name))
+	}
+	want, err := TokenHash(alg, token)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(value), []byte(want)) != 1 {
+		return wrapError(ErrInvalidIDToken, fmt.Errorf("%w: %v", ErrHashMismatch, name))
+	}
+	return nil
+}
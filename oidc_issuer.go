@@ -0,0 +1,387 @@
+package jwthelper
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IDTokenIssuer issues OpenID Connect ID Tokens with the keys of a MultipleKeysSigner(key ring).
+// It also serves the discovery metadata and JWK Set of the key ring,
+// so IDTokenVerifier and third-party clients can verify the ID Tokens.
+// See https://openid.net/specs/openid-connect-core-1_0.html#IDToken
+type IDTokenIssuer struct {
+	issuer   string
+	signers  *MultipleKeysSigner
+	ttl      time.Duration
+	jwksURI  string
+	metadata ProviderMetadata
+
+	m sync.RWMutex
+	// kid is the "kid" of the signer used to sign ID Tokens.
+	kid string
+}
+
+// IDTokenIssuerOption represents the option for issuing ID Tokens.
+// Use option helper functions to set options:
+// e.g. IDTokenTTL(), IDTokenJWKSURI()
+type IDTokenIssuerOption struct {
+	f func(i *IDTokenIssuer)
+}
+
+// IssueOption represents the option for the claims of an issued token.
+// Use option helper functions to set options:
+// e.g. IssueNonce(), IssueAccessToken()
+type IssueOption struct {
+	f func(o *issueOptions)
+}
+
+// issueOptions stores the claims of an issued token.
+type issueOptions struct {
+	audiences   []string
+	nonce       string
+	authTime    time.Time
+	acr         string
+	amr         []string
+	accessToken string
+	code        string
+	claims      []Claim
+}
+
+var (
+	// ErrSymmetricKey represents the error of HMAC key which can not be published in the JWK Set.
+	ErrSymmetricKey = fmt.Errorf("symmetric key can not be used by issuer")
+)
+
+// IDTokenTTL returns the option for the lifetime of ID Tokens.
+// It's 1 hour by default.
+func IDTokenTTL(ttl time.Duration) IDTokenIssuerOption {
+	return IDTokenIssuerOption{func(i *IDTokenIssuer) {
+		i.ttl = ttl
+	}}
+}
+
+// IDTokenJWKSURI returns the option for "jwks_uri" in the discovery metadata.
+// It's the issuer followed by "/jwks" by default. Serve JWKSHandler() at it.
+func IDTokenJWKSURI(uri string) IDTokenIssuerOption {
+	return IDTokenIssuerOption{func(i *IDTokenIssuer) {
+		i.jwksURI = uri
+	}}
+}
+
+// IDTokenProviderMetadata returns the option for other parameters of the discovery metadata.
+// e.g. "authorization_endpoint", "token_endpoint" and "scopes_supported".
+// "issuer", "jwks_uri" and "id_token_signing_alg_values_supported" are always set by the issuer.
+func IDTokenProviderMetadata(m ProviderMetadata) IDTokenIssuerOption {
+	return IDTokenIssuerOption{func(i *IDTokenIssuer) {
+		i.metadata = m
+	}}
+}
+
+// IssueAudiences returns the option for audiences besides the client.
+// "azp" claim is set to the client if there're other audiences.
+func IssueAudiences(audiences ...string) IssueOption {
+	return IssueOption{func(o *issueOptions) {
+		o.audiences = append(o.audiences, audiences...)
+	}}
+}
+
+// IssueNonce returns the option for "nonce" claim.
+// Pass "nonce" of the authentication request.
+func IssueNonce(nonce string) IssueOption {
+	return IssueOption{func(o *issueOptions) {
+		o.nonce = nonce
+	}}
+}
+
+// IssueAuthTime returns the option for "auth_time" claim: time when the end-user authenticated.
+// It's required if "max_age" is in the authentication request.
+func IssueAuthTime(t time.Time) IssueOption {
+	return IssueOption{func(o *issueOptions) {
+		o.authTime = t
+	}}
+}
+
+// IssueACR returns the option for "acr" claim.
+func IssueACR(acr string) IssueOption {
+	return IssueOption{func(o *issueOptions) {
+		o.acr = acr
+	}}
+}
+
+// IssueAMR returns the option for "amr" claim. e.g. IssueAMR("pwd", "otp").
+func IssueAMR(amr ...string) IssueOption {
+	return IssueOption{func(o *issueOptions) {
+		o.amr = amr
+	}}
+}
+
+// IssueAccessToken returns the option for the access token issued with the ID Token.
+// "at_hash" claim is computed with the hash function of the signing alg.
+func IssueAccessToken(accessToken string) IssueOption {
+	return IssueOption{func(o *issueOptions) {
+		o.accessToken = accessToken
+	}}
+}
+
+// IssueCode returns the option for the authorization code issued with the ID Token.
+// "c_hash" claim is computed with the hash function of the signing alg.
+func IssueCode(code string) IssueOption {
+	return IssueOption{func(o *issueOptions) {
+		o.code = code
+	}}
+}
+
+// IssueClaims returns the option for extra claims. e.g. NewClaim("email", "frank@example.com").
+// They can not override the claims set by the issuer.
+func IssueClaims(claims ...Claim) IssueOption {
+	return IssueOption{func(o *issueOptions) {
+		o.claims = append(o.claims, claims...)
+	}}
+}
+
+// NewIDTokenIssuer creates an ID Token issuer.
+//
+// issuer: https URL of the issuer. e.g. "https://accounts.example.com".
+// signers: key ring. All keys are published in the JWK Set.
+// kid: "kid" of the signer used to sign ID Tokens.
+// options: variadic options returned by option helper functions.
+// e.g. IDTokenTTL(10 * time.Minute)
+// comments:
+// HMAC keys are refused because they can not be published.
+// New keys can be added to the key ring by signers.Set() while the issuer is serving.
+// Keep the old keys in the key ring after rotating by SetSigningKID()
+// until the ID Tokens signed by them expire.
+func NewIDTokenIssuer(issuer string, signers *MultipleKeysSigner, kid string, options ...IDTokenIssuerOption) (*IDTokenIssuer, error) {
+	if err := checkHTTPS("issuer", issuer); err != nil {
+		return nil, err
+	}
+	if signers == nil || !signers.Valid() {
+		return nil, ErrInvalidMultipleKeysSigner
+	}
+
+	i := &IDTokenIssuer{
+		issuer:  issuer,
+		signers: signers,
+		ttl:     time.Hour,
+		jwksURI: strings.TrimSuffix(issuer, "/") + "/jwks",
+	}
+	for _, op := range options {
+		op.f(i)
+	}
+
+	for _, k := range signers.KIDs() {
+		if _, err := i.signer(k); err != nil {
+			return nil, err
+		}
+	}
+	if err := i.SetSigningKID(kid); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// signer returns the signer of the "kid" in the key ring.
+func (i *IDTokenIssuer) signer(kid string) (*Signer, error) {
+	s := i.signers.Get(kid)
+	if s == nil || !s.Valid() {
+		return nil, fmt.Errorf("%w: %q", ErrSignerNotFound, kid)
+	}
+
+	k := s.Key()
+	if k.KID() != "" && k.KID() != kid {
+		return nil, wrapError(ErrUnknownKID, ErrKIDMismatch)
+	}
+	if _, ok := k.verifyingKey().([]byte); ok {
+		return nil, fmt.Errorf("%w: %q", ErrSymmetricKey, kid)
+	}
+	return s, nil
+}
+
+// SetSigningKID sets the "kid" of the signer used to sign ID Tokens for key rotation.
+// The signer must be in the key ring.
+func (i *IDTokenIssuer) SetSigningKID(kid string) error {
+	if _, err := i.signer(kid); err != nil {
+		return err
+	}
+
+	i.m.Lock()
+	defer i.m.Unlock()
+	i.kid = kid
+	return nil
+}
+
+// SigningKID returns the "kid" of the signer used to sign ID Tokens.
+func (i *IDTokenIssuer) SigningKID() string {
+	i.m.RLock()
+	defer i.m.RUnlock()
+	return i.kid
+}
+
+// Issue issues an ID Token.
+//
+// sub: subject(end-user identifier).
+// clientID: "client_id" of the client. It's the "aud" claim.
+// options: variadic options returned by option helper functions.
+// e.g. IssueNonce(nonce), IssueAuthTime(t), IssueAccessToken(accessToken)
+// comments:
+// "iss", "sub", "aud", "exp" and "iat" claims are always set.
+// See https://openid.net/specs/openid-connect-core-1_0.html#IDToken
+func (i *IDTokenIssuer) Issue(sub, clientID string, options ...IssueOption) (string, error) {
+	if sub == "" {
+		return "", claimError(ErrClaimNotFound, "sub")
+	}
+	if clientID == "" {
+		return "", claimError(ErrClaimNotFound, "aud")
+	}
+
+	o := issueOptions{}
+	for _, op := range options {
+		op.f(&o)
+	}
+
+	kid := i.SigningKID()
+	s, err := i.signer(kid)
+	if err != nil {
+		return "", err
+	}
+	alg := s.Key().Alg()
+
+	now := time.Now()
+	claims := append([]Claim{}, o.claims...)
+	claims = append(claims,
+		NewHeader("kid", kid),
+		NewClaim("iss", i.issuer),
+		NewClaim("sub", sub),
+		TimeClaim("iat", now),
+		TimeClaim("exp", now.Add(i.ttl)),
+	)
+
+	if len(o.audiences) == 0 {
+		claims = append(claims, NewClaim("aud", clientID))
+	} else {
+		claims = append(claims,
+			NewClaim("aud", append([]string{clientID}, o.audiences...)),
+			NewClaim("azp", clientID),
+		)
+	}
+
+	if o.nonce != "" {
+		claims = append(claims, NewClaim("nonce", o.nonce))
+	}
+	if !o.authTime.IsZero() {
+		claims = append(claims, TimeClaim("auth_time", o.authTime))
+	}
+	if o.acr != "" {
+		claims = append(claims, NewClaim("acr", o.acr))
+	}
+	if len(o.amr) > 0 {
+		claims = append(claims, NewClaim("amr", o.amr))
+	}
+
+	for name, token := range map[string]string{
+		"at_hash": o.accessToken,
+		"c_hash":  o.code,
+	} {
+		if token == "" {
+			continue
+		}
+		h, err := TokenHash(alg, token)
+		if err != nil {
+			return "", err
+		}
+		claims = append(claims, NewClaim(name, h))
+	}
+
+	return s.SignedString(claims...)
+}
+
+// Keys returns the verifying keys of the key ring with "kid".
+func (i *IDTokenIssuer) Keys() ([]*Key, error) {
+	keys := []*Key{}
+	for _, kid := range i.signers.KIDs() {
+		s, err := i.signer(kid)
+		if err != nil {
+			return nil, err
+		}
+		k := s.Key()
+		keys = append(keys, &Key{kid: kid, method: k.method, key: k.verifyingKey()})
+	}
+	return keys, nil
+}
+
+// JWKS returns the JWK Set of the key ring.
+func (i *IDTokenIssuer) JWKS() ([]byte, error) {
+	keys, err := i.Keys()
+	if err != nil {
+		return nil, err
+	}
+	return MarshalJWKS(keys...)
+}
+
+// Metadata returns the discovery metadata of the issuer.
+// "response_types_supported" is ["code"] and "subject_types_supported" is ["public"]
+// if they're not set by IDTokenProviderMetadata().
+func (i *IDTokenIssuer) Metadata() (*ProviderMetadata, error) {
+	keys, err := i.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	algs := []string{}
+	for _, k := range keys {
+		if !contains(algs, k.Alg()) {
+			algs = append(algs, k.Alg())
+		}
+	}
+	sort.Strings(algs)
+
+	m := i.metadata
+	m.Issuer = i.issuer
+	m.JWKSURI = i.jwksURI
+	m.IDTokenSigningAlgValuesSupported = algs
+	if len(m.ResponseTypesSupported) == 0 {
+		m.ResponseTypesSupported = []string{"code"}
+	}
+	if len(m.SubjectTypesSupported) == 0 {
+		m.SubjectTypesSupported = []string{"public"}
+	}
+	return &m, nil
+}
+
+// serveJSON responds the JSON document returned by f.
+func serveJSON(w http.ResponseWriter, f func() ([]byte, error)) {
+	buf, err := f()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buf)
+}
+
+// DiscoveryHandler returns the handler serving the discovery metadata.
+// Serve it at the issuer path followed by DiscoveryPath.
+func (i *IDTokenIssuer) DiscoveryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveJSON(w, func() ([]byte, error) {
+			m, err := i.Metadata()
+			if err != nil {
+				return nil, err
+			}
+			return json.Marshal(m)
+		})
+	})
+}
+
+// JWKSHandler returns the handler serving the JWK Set of the key ring.
+// Serve it at "jwks_uri".
+func (i *IDTokenIssuer) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveJSON(w, i.JWKS)
+	})
+}
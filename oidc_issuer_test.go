@@ -0,0 +1,339 @@
+package jwthelper_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleIDTokenIssuer_Issue() {
+	// Key ring of the OpenID Provider.
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM)
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+	ring := jwthelper.NewMultipleKeysSigner()
+	ring.Set("ec-1", s)
+
+	issuer, err := jwthelper.NewIDTokenIssuer("https://op.example.com", ring, "ec-1")
+	if err != nil {
+		log.Printf("NewIDTokenIssuer() error: %v", err)
+		return
+	}
+
+	idToken, err := issuer.Issue("frank", "client-1",
+		jwthelper.IssueNonce("n-0S6_WzA2Mj"),
+		jwthelper.IssueAuthTime(time.Now()),
+		jwthelper.IssueAccessToken("access-token"),
+	)
+	if err != nil {
+		log.Printf("Issue() error: %v", err)
+		return
+	}
+
+	// Clients get the JWK Set from "jwks_uri" served by JWKSHandler().
+	jwks, err := issuer.JWKS()
+	if err != nil {
+		log.Printf("JWKS() error: %v", err)
+		return
+	}
+	p, err := jwthelper.NewJWKSParser(jwks)
+	if err != nil {
+		log.Printf("NewJWKSParser() error: %v", err)
+		return
+	}
+
+	v := jwthelper.NewIDTokenVerifier(p, "https://op.example.com", "client-1")
+	t, err := v.Verify(idToken,
+		jwthelper.IDTokenNonce("n-0S6_WzA2Mj"),
+		jwthelper.IDTokenMaxAge(time.Minute),
+		jwthelper.IDTokenAccessToken("access-token"),
+	)
+	if err != nil {
+		log.Printf("Verify() error: %v", err)
+		return
+	}
+	fmt.Println(t.Subject, t.Audience)
+
+	// Output:
+	// frank [client-1]
+}
+
+func TestPublicJWK(t *testing.T) {
+	k := newVectorKeys(t)
+
+	tests := []struct {
+		alg  string
+		priv []byte
+		jwk  string
+	}{
+		// RFC 7515 A.2.
+		{"RS256", k.rsaPriv, `{"kty":"RSA","kid":"key-1","alg":"RS256","use":"sig","n":"ofgWCuLjybRlzo0tZWJjNiuSfb4p4fAkd_wWJcyQoTbji9k0l8W26mPddxHmfHQp-Vaw-4qPCJrcS2mJPMEzP1Pt0Bm4d4QlL-yRT-SFd2lZS-pCgNMsD1W_YpRPEwOWvG6b32690r2jZ47soMZo9wGzjb_7OMg0LOL-bSf63kpaSHSXndS5z5rexMdbBYUsLA9e-KXBdQOS-UTo7WTBEMa2R2CapHg665xsmtdVMTBQY4uDZlxvb3qCo5ZwKh9kG4LT6_I5IhlJH7aGhyxXFvUK-DWNmoudF8NAco9_h9iaGNj8q2ethFkMLs91kzk2PAcDTW9gb54h4FRWyuXpoQ","e":"AQAB"}`},
+		// RFC 7515 A.3.
+		{"ES256", k.es256Priv, `{"kty":"EC","kid":"key-1","alg":"ES256","use":"sig","crv":"P-256","x":"f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU","y":"x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0"}`},
+		// RFC 8037 A.2.
+		{"EdDSA", k.edPriv, `{"kty":"OKP","kid":"key-1","alg":"EdDSA","use":"sig","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`},
+	}
+
+	for _, tt := range tests {
+		key, err := jwthelper.NewSigningKey(tt.alg, tt.priv, jwthelper.KeyID("key-1"))
+		if err != nil {
+			t.Fatalf("NewSigningKey(%v) error: %v", tt.alg, err)
+		}
+		buf, err := key.PublicJWK()
+		if err != nil {
+			t.Fatalf("PublicJWK(%v) error: %v", tt.alg, err)
+		}
+		if string(buf) != tt.jwk {
+			t.Errorf("PublicJWK(%v) = %s, want %s", tt.alg, buf, tt.jwk)
+		}
+
+		// The JWK verifies tokens signed by the private key.
+		pub, err := jwthelper.ParseJWK(buf)
+		if err != nil {
+			t.Fatalf("ParseJWK(%v) error: %v", tt.alg, err)
+		}
+		s, _ := jwthelper.NewSignerFromKey(key)
+		p, _ := jwthelper.NewParserFromKey(pub)
+		str, _ := s.SignedString(jwthelper.NewClaim("sub", "frank"))
+		if _, err = p.Parse(str); err != nil {
+			t.Errorf("Parse(%v) error: %v", tt.alg, err)
+		}
+	}
+
+	secret, err := jwthelper.NewSigningKey("HS256", []byte(strings.Repeat("k", 32)))
+	if err != nil {
+		t.Fatalf("NewSigningKey() error: %v", err)
+	}
+	if _, err = secret.PublicJWK(); !errors.Is(err, jwthelper.ErrUnsupportedJWK) {
+		t.Errorf("PublicJWK(HS256) error: %v, want %v", err, jwthelper.ErrUnsupportedJWK)
+	}
+	if _, err = jwthelper.MarshalJWKS(secret); !errors.Is(err, jwthelper.ErrUnsupportedJWK) {
+		t.Errorf("MarshalJWKS(HS256) error: %v, want %v", err, jwthelper.ErrUnsupportedJWK)
+	}
+}
+
+func TestIDTokenIssuer(t *testing.T) {
+	k := newVectorKeys(t)
+	ring := jwthelper.NewMultipleKeysSigner()
+	for kid, key := range map[string]struct {
+		alg  string
+		priv []byte
+	}{
+		"ec-1":  {"ES256", es256PrivPEM},
+		"rsa-1": {"RS256", k.rsaPriv},
+	} {
+		s, err := jwthelper.NewSigner(key.alg, key.priv)
+		if err != nil {
+			t.Fatalf("NewSigner() error: %v", err)
+		}
+		ring.Set(kid, s)
+	}
+
+	// OpenID Provider serving the discovery metadata and JWK Set.
+	mux := http.NewServeMux()
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	issuer, err := jwthelper.NewIDTokenIssuer(server.URL, ring, "ec-1",
+		jwthelper.IDTokenTTL(10*time.Minute),
+		jwthelper.IDTokenProviderMetadata(jwthelper.ProviderMetadata{
+			TokenEndpoint: server.URL + "/token",
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewIDTokenIssuer() error: %v", err)
+	}
+	mux.Handle(jwthelper.DiscoveryPath, issuer.DiscoveryHandler())
+	mux.Handle("/jwks", issuer.JWKSHandler())
+
+	m, err := jwthelper.Discover(context.Background(), server.URL, server.Client())
+	if err != nil {
+		t.Fatalf("Discover() error: %v", err)
+	}
+	if m.TokenEndpoint != server.URL+"/token" || strings.Join(m.IDTokenSigningAlgValuesSupported, ",") != "ES256,RS256" ||
+		strings.Join(m.ResponseTypesSupported, ",") != "code" || strings.Join(m.SubjectTypesSupported, ",") != "public" {
+		t.Errorf("Discover() = %+v", m)
+	}
+
+	p, err := jwthelper.NewParserFromDiscovery(context.Background(), server.URL, server.Client())
+	if err != nil {
+		t.Fatalf("NewParserFromDiscovery() error: %v", err)
+	}
+	v := jwthelper.NewIDTokenVerifier(p, server.URL, "client-1", jwthelper.IDTokenTrustedAudiences("api-1"))
+
+	authTime := time.Now().Add(-time.Minute)
+	idToken, err := issuer.Issue("frank", "client-1",
+		jwthelper.IssueAudiences("api-1"),
+		jwthelper.IssueNonce("nonce-1"),
+		jwthelper.IssueAuthTime(authTime),
+		jwthelper.IssueACR("urn:mace:incommon:iap:silver"),
+		jwthelper.IssueAMR("pwd", "otp"),
+		jwthelper.IssueAccessToken("access-token"),
+		jwthelper.IssueCode("code"),
+		jwthelper.IssueClaims(jwthelper.NewClaim("email", "frank@example.com"), jwthelper.NewClaim("iss", "https://evil.example.com")),
+	)
+	if err != nil {
+		t.Fatalf("Issue() error: %v", err)
+	}
+
+	tok, err := v.Verify(idToken,
+		jwthelper.IDTokenNonce("nonce-1"),
+		jwthelper.IDTokenMaxAge(5*time.Minute),
+		jwthelper.IDTokenACRValues("urn:mace:incommon:iap:silver"),
+		jwthelper.IDTokenAccessToken("access-token"),
+		jwthelper.IDTokenCode("code"),
+	)
+	if err != nil {
+		t.Fatalf("Verify() error: %v", err)
+	}
+	if tok.Issuer != server.URL || tok.AuthorizedParty != "client-1" || len(tok.Audience) != 2 ||
+		tok.AuthTime.Unix() != authTime.Unix() || len(tok.AMR) != 2 || tok.Claims["email"] != "frank@example.com" {
+		t.Errorf("ID Token = %+v", tok)
+	}
+	if d := tok.Expiry.Sub(tok.IssuedAt); d != 10*time.Minute {
+		t.Errorf("lifetime = %v, want %v", d, 10*time.Minute)
+	}
+	if header, _ := jwthelper.ParseHeader(idToken); header["kid"] != "ec-1" || header["alg"] != "ES256" {
+		t.Errorf("header = %v", header)
+	}
+
+	// Rotate to RS256 key. at_hash uses the hash of the new alg.
+	if err = issuer.SetSigningKID("rsa-1"); err != nil {
+		t.Fatalf("SetSigningKID() error: %v", err)
+	}
+	if idToken, err = issuer.Issue("frank", "client-1", jwthelper.IssueAccessToken("access-token")); err != nil {
+		t.Fatalf("Issue() error: %v", err)
+	}
+	if _, err = v.Verify(idToken, jwthelper.IDTokenAccessToken("access-token")); err != nil {
+		t.Errorf("Verify() error: %v", err)
+	}
+	if header, _ := jwthelper.ParseHeader(idToken); header["kid"] != "rsa-1" {
+		t.Errorf("header = %v", header)
+	}
+
+	if err = issuer.SetSigningKID("rsa-2"); !errors.Is(err, jwthelper.ErrSignerNotFound) {
+		t.Errorf("SetSigningKID() error: %v, want %v", err, jwthelper.ErrSignerNotFound)
+	}
+	if _, err = issuer.Issue("", "client-1"); !errors.Is(err, jwthelper.ErrClaimNotFound) {
+		t.Errorf("Issue() error: %v, want %v", err, jwthelper.ErrClaimNotFound)
+	}
+
+	// The JWK Set never contains private keys.
+	jwks, err := issuer.JWKS()
+	if err != nil {
+		t.Fatalf("JWKS() error: %v", err)
+	}
+	var set struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	if err = json.Unmarshal(jwks, &set); err != nil || len(set.Keys) != 2 {
+		t.Fatalf("JWKS() = %s", jwks)
+	}
+	for _, key := range set.Keys {
+		for _, name := range []string{"d", "p", "q", "dp", "dq", "qi"} {
+			if _, ok := key[name]; ok {
+				t.Errorf("JWK %v has private parameter %q", key["kid"], name)
+			}
+		}
+	}
+}
+
+func TestIDTokenIssuerKeys(t *testing.T) {
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM)
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	hmac, err := jwthelper.NewSigner("HS256", []byte(strings.Repeat("k", 32)))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	other, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-2"))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		issuer  string
+		signers map[string]*jwthelper.Signer
+		kid     string
+		err     error
+	}{
+		{"http issuer", "http://op.example.com", map[string]*jwthelper.Signer{"ec-1": s}, "ec-1", jwthelper.ErrInvalidMetadata},
+		{"unknown kid", "https://op.example.com", map[string]*jwthelper.Signer{"ec-1": s}, "ec-2", jwthelper.ErrSignerNotFound},
+		{"HMAC key", "https://op.example.com", map[string]*jwthelper.Signer{"ec-1": s, "hs-1": hmac}, "ec-1", jwthelper.ErrSymmetricKey},
+		{"kid mismatch", "https://op.example.com", map[string]*jwthelper.Signer{"ec-1": other}, "ec-1", jwthelper.ErrKIDMismatch},
+	}
+
+	for _, tt := range tests {
+		ring := jwthelper.NewMultipleKeysSigner()
+		for kid, s := range tt.signers {
+			ring.Set(kid, s)
+		}
+		if _, err := jwthelper.NewIDTokenIssuer(tt.issuer, ring, tt.kid); !errors.Is(err, tt.err) {
+			t.Errorf("%v: NewIDTokenIssuer() error: %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestIDTokenIssuerConcurrentRotation(t *testing.T) {
+	k := newVectorKeys(t)
+	ec, err := jwthelper.NewSigner("ES256", es256PrivPEM)
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	rsa, err := jwthelper.NewSigner("RS256", k.rsaPriv)
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	ring := jwthelper.NewMultipleKeysSigner()
+	ring.Set("ec-1", ec)
+
+	issuer, err := jwthelper.NewIDTokenIssuer("https://op.example.com", ring, "ec-1")
+	if err != nil {
+		t.Fatalf("NewIDTokenIssuer() error: %v", err)
+	}
+	jwks := issuer.JWKSHandler()
+	discovery := issuer.DiscoveryHandler()
+
+	// Keys are added to the ring while the issuer is serving.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				switch i {
+				case 0:
+					ring.Set(fmt.Sprintf("rsa-%d", j), rsa)
+				case 1:
+					if _, err := issuer.Issue("frank", "client-1"); err != nil {
+						t.Errorf("Issue() error: %v", err)
+						return
+					}
+				case 2:
+					jwks.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/jwks", nil))
+				case 3:
+					discovery.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", jwthelper.DiscoveryPath, nil))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if keys, err := issuer.Keys(); err != nil || len(keys) != 51 {
+		t.Errorf("Keys() returns %v keys, %v, want 51", len(keys), err)
+	}
+}
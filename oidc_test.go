@@ -0,0 +1,199 @@
+package jwthelper_test
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleIDTokenVerifier_Verify() {
+	// Keys of the OpenID Provider.
+	p, err := jwthelper.NewJWKSParser([]byte(testJWKS))
+	if err != nil {
+		log.Printf("NewJWKSParser() error: %v", err)
+		return
+	}
+	v := jwthelper.NewIDTokenVerifier(p, "https://op.example.com", "client-1")
+
+	// ID Token issued by the OpenID Provider.
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-1"))
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+	atHash, _ := jwthelper.TokenHash("ES256", "access-token")
+	now := time.Now()
+	idToken, err := s.SignedString(
+		jwthelper.NewClaim("iss", "https://op.example.com"),
+		jwthelper.NewClaim("sub", "frank"),
+		jwthelper.NewClaim("aud", "client-1"),
+		jwthelper.TimeClaim("exp", now.Add(time.Hour)),
+		jwthelper.TimeClaim("iat", now),
+		jwthelper.NewClaim("nonce", "n-0S6_WzA2Mj"),
+		jwthelper.NewClaim("at_hash", atHash),
+	)
+	if err != nil {
+		log.Printf("SignedString() error: %v", err)
+		return
+	}
+
+	t, err := v.Verify(idToken,
+		jwthelper.IDTokenNonce("n-0S6_WzA2Mj"),
+		jwthelper.IDTokenAccessToken("access-token"),
+	)
+	if err != nil {
+		log.Printf("Verify() error: %v", err)
+		return
+	}
+	fmt.Println(t.Subject, t.Audience)
+
+	_, err = v.Verify(idToken, jwthelper.IDTokenNonce("other"))
+	fmt.Println(errors.Is(err, jwthelper.ErrNonceMismatch))
+
+	// Output:
+	// frank [client-1]
+	// true
+}
+
+func TestIDTokenVerifier(t *testing.T) {
+	const (
+		issuer   = "https://op.example.com"
+		clientID = "client-1"
+	)
+
+	p, err := jwthelper.NewJWKSParser([]byte(testJWKS))
+	if err != nil {
+		t.Fatalf("NewJWKSParser() error: %v", err)
+	}
+	v := jwthelper.NewIDTokenVerifier(p, issuer, clientID, jwthelper.IDTokenTrustedAudiences("api-1"))
+
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-1"))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+
+	now := time.Now()
+	atHash, _ := jwthelper.TokenHash("ES256", "access-token")
+	cHash, _ := jwthelper.TokenHash("ES256", "code")
+
+	// sign signs the ID Token with the standard claims overridden by claims.
+	// Claims with nil value are removed.
+	sign := func(claims map[string]interface{}) string {
+		m := map[string]interface{}{
+			"iss":       issuer,
+			"sub":       "frank",
+			"aud":       clientID,
+			"exp":       now.Add(time.Hour).Unix(),
+			"iat":       now.Unix(),
+			"auth_time": now.Add(-time.Minute).Unix(),
+			"nonce":     "nonce-1",
+			"acr":       "urn:mace:incommon:iap:silver",
+			"amr":       []string{"pwd", "otp"},
+			"at_hash":   atHash,
+			"c_hash":    cHash,
+		}
+		for k, v := range claims {
+			if v == nil {
+				delete(m, k)
+				continue
+			}
+			m[k] = v
+		}
+
+		c := []jwthelper.Claim{}
+		for k, v := range m {
+			c = append(c, jwthelper.NewClaim(k, v))
+		}
+		str, err := s.SignedString(c...)
+		if err != nil {
+			t.Fatalf("SignedString() error: %v", err)
+		}
+		return str
+	}
+
+	all := []jwthelper.IDTokenOption{
+		jwthelper.IDTokenNonce("nonce-1"),
+		jwthelper.IDTokenMaxAge(5 * time.Minute),
+		jwthelper.IDTokenACRValues("urn:mace:incommon:iap:silver", "urn:mace:incommon:iap:gold"),
+		jwthelper.IDTokenAccessToken("access-token"),
+		jwthelper.IDTokenCode("code"),
+	}
+
+	tests := []struct {
+		name    string
+		claims  map[string]interface{}
+		options []jwthelper.IDTokenOption
+		err     error
+	}{
+		{"valid", nil, all, nil},
+		{"valid without options", nil, nil, nil},
+		{"multiple audiences", map[string]interface{}{"aud": []string{clientID, "api-1"}, "azp": clientID}, all, nil},
+		{"wrong issuer", map[string]interface{}{"iss": "https://op.example.com/"}, nil, jwthelper.ErrInvalidIDToken},
+		{"no issuer", map[string]interface{}{"iss": nil}, nil, jwthelper.ErrClaimNotFound},
+		{"no subject", map[string]interface{}{"sub": nil}, nil, jwthelper.ErrClaimNotFound},
+		{"other audience", map[string]interface{}{"aud": "client-2"}, nil, jwthelper.ErrInvalidIDToken},
+		{"untrusted audience", map[string]interface{}{"aud": []string{clientID, "api-2"}, "azp": clientID}, nil, jwthelper.ErrInvalidIDToken},
+		{"multiple audiences without azp", map[string]interface{}{"aud": []string{clientID, "api-1"}}, nil, jwthelper.ErrClaimNotFound},
+		{"azp of other client", map[string]interface{}{"azp": "api-1"}, nil, jwthelper.ErrInvalidIDToken},
+		{"expired", map[string]interface{}{"exp": now.Add(-time.Minute).Unix()}, nil, jwthelper.ErrTokenExpired},
+		{"no exp", map[string]interface{}{"exp": nil}, nil, jwthelper.ErrClaimNotFound},
+		{"no iat", map[string]interface{}{"iat": nil}, nil, jwthelper.ErrClaimNotFound},
+		{"iat in future", map[string]interface{}{"iat": now.Add(time.Minute).Unix()}, nil, jwthelper.ErrTokenNotYetValid},
+		{"nonce mismatch", map[string]interface{}{"nonce": "nonce-2"}, all, jwthelper.ErrNonceMismatch},
+		{"no nonce", map[string]interface{}{"nonce": nil}, all, jwthelper.ErrNonceMismatch},
+		{"auth too old", map[string]interface{}{"auth_time": now.Add(-10 * time.Minute).Unix()}, all, jwthelper.ErrAuthTooOld},
+		{"no auth_time", map[string]interface{}{"auth_time": nil}, all, jwthelper.ErrClaimNotFound},
+		{"acr not allowed", map[string]interface{}{"acr": "urn:mace:incommon:iap:bronze"}, all, jwthelper.ErrACRNotAllowed},
+		{"no acr", map[string]interface{}{"acr": nil}, all, jwthelper.ErrACRNotAllowed},
+		{"at_hash mismatch", map[string]interface{}{"at_hash": cHash}, all, jwthelper.ErrHashMismatch},
+		{"no at_hash", map[string]interface{}{"at_hash": nil}, all, jwthelper.ErrClaimNotFound},
+		{"c_hash mismatch", map[string]interface{}{"c_hash": atHash}, all, jwthelper.ErrHashMismatch},
+		{"amr not array", map[string]interface{}{"amr": 1}, nil, jwthelper.ErrClaimType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := v.Verify(sign(tt.claims), tt.options...)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Verify() error: %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if token.Issuer != issuer || token.Subject != "frank" || token.Nonce != "nonce-1" ||
+				len(token.AMR) != 2 || token.AuthTime.IsZero() || token.Expiry.Unix() != now.Add(time.Hour).Unix() {
+				t.Errorf("ID Token = %+v", token)
+			}
+		})
+	}
+}
+
+func TestTokenHash(t *testing.T) {
+	// Examples of OpenID Connect Core 1.0 appendix A.3 and A.4.
+	tests := []struct {
+		alg   string
+		token string
+		hash  string
+	}{
+		{"RS256", "jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y", "77QmUPtjPfzWtF2AnpK9RQ"},
+		{"RS256", "Qcb0Orv1zh30vL1MPRsbm-diHiMwcLyZvn1arpZv-Jxf_11jnpEX3Tgfvk", "LDktKdoQak3Pk0cnXxCltA"},
+	}
+
+	for _, tt := range tests {
+		got, err := jwthelper.TokenHash(tt.alg, tt.token)
+		if err != nil {
+			t.Fatalf("TokenHash() error: %v", err)
+		}
+		if got != tt.hash {
+			t.Errorf("TokenHash(%v, %v) = %v, want %v", tt.alg, tt.token, got, tt.hash)
+		}
+	}
+
+	if _, err := jwthelper.TokenHash("none", "token"); !errors.Is(err, jwthelper.ErrInvalidAlg) {
+		t.Errorf("TokenHash() error: %v, want %v", err, jwthelper.ErrInvalidAlg)
+	}
+}
@@ -1,19 +1,23 @@
 package jwthelper
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"strings"
+	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/northbright/jwthelper/internal/jose"
 )
 
 // Parser is used to parse JWT token string.
 type Parser struct {
-	key    interface{}
-	parser jwt.Parser
+	key           *Key
+	keyOptions    []KeyOption
+	algs          []string
+	issuer        string
+	useJSONNumber bool
+	revoker       Revoker
+	seen          SeenStore
 }
 
 // ParserOption represents the option for parsing JWT token string.
@@ -29,8 +33,12 @@ var (
 	// ErrParseClaims represents the error of failed to parse claims.
 	ErrParseClaims = fmt.Errorf("failed to parse claims")
 	// ErrInvalidToken represents the error of invalid token.
-	ErrInvalidToken   = fmt.Errorf("invalid token")
+	ErrInvalidToken = fmt.Errorf("invalid token")
+	// ErrInvalidPartNum represents the error of invalid number of JWT parts.
+	// It's wrapped with ErrMalformed.
 	ErrInvalidPartNum = fmt.Errorf("invalid number of JWT part")
+	// ErrInvalidIssuer represents the error of "iss" claim which is not the issuer of the parser.
+	ErrInvalidIssuer = fmt.Errorf("invalid issuer")
 )
 
 // ParserUseJSONNumber returns the option for using JSON number.
@@ -41,34 +49,49 @@ var (
 // See https://godoc.org/encoding/json#Decoder.UseNumber
 func ParserUseJSONNumber(flag bool) ParserOption {
 	return ParserOption{func(p *Parser) {
-		p.parser.UseJSONNumber = flag
+		p.useJSONNumber = flag
+	}}
+}
+
+// ParserKeyOptions returns the option for creating the verifying key.
+// It's used by NewParser() and NewParserFromFile().
+// e.g. ParserKeyOptions(KeyID("key-1"), KeyInsecure(true))
+func ParserKeyOptions(options ...KeyOption) ParserOption {
+	return ParserOption{func(p *Parser) {
+		p.keyOptions = append(p.keyOptions, options...)
+	}}
+}
+
+// ParserAllowedAlgs returns the option for allowed algs.
+// Tokens are rejected if "alg" is not one of them, even if it's the alg bound to the key.
+// e.g. algs of "id_token_signing_alg_values_supported" in OIDC discovery metadata.
+func ParserAllowedAlgs(algs ...string) ParserOption {
+	return ParserOption{func(p *Parser) {
+		p.algs = algs
+	}}
+}
+
+// ParserIssuer returns the option for issuer.
+// "iss" claim is required and it must match the issuer exactly.
+func ParserIssuer(issuer string) ParserOption {
+	return ParserOption{func(p *Parser) {
+		p.issuer = issuer
 	}}
 }
 
 // newParser creates a parser with given signing method and verifying key.
 //
 // m: signing method.
-// use random bytes as key for jwt.SigningMethodHMAC.
-// use PEM string as key for jwt.SigningMethodRSA, jwt.SigningMethodRSAPSS and jwt.SigningMethodECDSA.
-// for jwt.SigningMethodNone, key is ignored.
+// use random bytes as key for jose.HMAC.
+// use PEM string as key for jose.RSA, jose.RSAPSS, jose.ECDSA and jose.EdDSA.
 // options: variadic options returned by option helper functions.
 // e.g. ParserUseJSONNumber.
-func newParser(m jwt.SigningMethod, key []byte, options ...ParserOption) (*Parser, error) {
-	var err error
-
+func newParser(m jose.Algorithm, key []byte, options ...ParserOption) (*Parser, error) {
 	p := &Parser{
-		nil,
-		jwt.Parser{
-			// UseJSONNumber will call encoding/json.Decoder.UseNumber().
-			// It causes the Decoder to unmarshal a number into an interface{} as a Number instead of as a float64.
-			// See https://godoc.org/encoding/json#Decoder.UseNumber
-			UseJSONNumber: true,
-			// If populated, only these methods will be considered valid
-			// See https://godoc.org/github.com/dgrijalva/jwt-go#Parser
-			ValidMethods: []string{
-				m.Alg(),
-			},
-		},
+		// UseJSONNumber will call encoding/json.Decoder.UseNumber().
+		// It causes the Decoder to unmarshal a number into an interface{} as a Number instead of as a float64.
+		// See https://godoc.org/encoding/json#Decoder.UseNumber
+		useJSONNumber: true,
 	}
 
 	// Override customized options.
@@ -76,20 +99,11 @@ func newParser(m jwt.SigningMethod, key []byte, options ...ParserOption) (*Parse
 		op.f(p)
 	}
 
-	switch m.(type) {
-	case *jwt.SigningMethodHMAC:
-		p.key = key
-	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
-		if p.key, err = jwt.ParseRSAPublicKeyFromPEM(key); err != nil {
-			return nil, err
-		}
-	case *jwt.SigningMethodECDSA:
-		if p.key, err = jwt.ParseECPublicKeyFromPEM(key); err != nil {
-			return nil, err
-		}
-	default:
-		return nil, ErrInvalidSigningMethod
+	k, err := newKey(m, key, false, p.keyOptions...)
+	if err != nil {
+		return nil, err
 	}
+	p.key = k
 
 	return p, nil
 }
@@ -102,17 +116,20 @@ func newParser(m jwt.SigningMethod, key []byte, options ...ParserOption) (*Parse
 // key:
 // use random bytes as key for "HS256", "HS384", "HS512".
 // use public PEM string as key for "RS256", "RS384", "RS512", "ES256", "ES384", "ES512",
-// "PS256", "PS384", "PS512".
+// "PS256", "PS384", "PS512", "EdDSA"(Ed25519).
+// comments:
+// HMAC secrets shorter than the hash size and RSA keys under 2048 bits are refused
+// unless ParserKeyOptions(KeyInsecure(true)) is passed.
 func NewParser(alg string, key []byte, options ...ParserOption) (*Parser, error) {
-	m := jwt.GetSigningMethod(alg)
-	if m == nil {
+	m, ok := jose.Lookup(alg)
+	if !ok {
 		return nil, ErrInvalidAlg
 	}
 	return newParser(m, key, options...)
 }
 
 // newParserFromFile creates a parser with given signing method and verifying key file.
-func newParserFromFile(m jwt.SigningMethod, f string, options ...ParserOption) (*Parser, error) {
+func newParserFromFile(m jose.Algorithm, f string, options ...ParserOption) (*Parser, error) {
 	key, err := ioutil.ReadFile(f)
 	if err != nil {
 		return nil, err
@@ -122,13 +139,32 @@ func newParserFromFile(m jwt.SigningMethod, f string, options ...ParserOption) (
 
 // NewParserFromFile creates a parser with given "alg"(RFC7518) and verifying key file.
 func NewParserFromFile(alg string, f string, options ...ParserOption) (*Parser, error) {
-	m := jwt.GetSigningMethod(alg)
-	if m == nil {
+	m, ok := jose.Lookup(alg)
+	if !ok {
 		return nil, ErrInvalidAlg
 	}
 	return newParserFromFile(m, f, options...)
 }
 
+// NewParserFromKey creates a parser with given key.
+// The public key is used if the key is created by NewSigningKey().
+func NewParserFromKey(k *Key, options ...ParserOption) (*Parser, error) {
+	if k == nil {
+		return nil, ErrInvalidParser
+	}
+
+	p := &Parser{key: k, useJSONNumber: true}
+	for _, op := range options {
+		op.f(p)
+	}
+	return p, nil
+}
+
+// Key returns the verifying key.
+func (p *Parser) Key() *Key {
+	return p.key
+}
+
 // Valid validates the parser.
 func (p *Parser) Valid() bool {
 	if p.key == nil {
@@ -150,46 +186,188 @@ func (p *Parser) Valid() bool {
 func (p *Parser) Parse(tokenString string) (map[string]interface{}, error) {
 	m := map[string]interface{}{}
 
+	_, claims, err := p.parse(tokenString)
+	if err != nil {
+		return m, err
+	}
+	return claims, nil
+}
+
+// parse parses the signed string and returns the JOSE header and claims.
+func (p *Parser) parse(tokenString string) (map[string]interface{}, map[string]interface{}, error) {
 	if !p.Valid() {
-		return m, ErrInvalidParser
+		return nil, nil, ErrInvalidParser
 	}
 
-	token, err := p.parser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return p.key, nil
-	})
+	parts, err := jose.Split(tokenString)
+	if err != nil {
+		return nil, nil, wrapError(ErrMalformed, ErrInvalidPartNum)
+	}
 
+	// Check "alg" and "kid" before verifying so that it's not reported as invalid signature.
+	header, err := decodeSegment(parts[0], false)
 	if err != nil {
-		return m, err
+		return nil, nil, err
+	}
+	if err = p.checkKey(header); err != nil {
+		return nil, nil, err
+	}
+
+	// Unencoded payload(RFC 7797) is only supported by VerifyDetached().
+	unencoded, err := unencodedPayload(header)
+	if err != nil {
+		return nil, nil, wrapError(ErrMalformed, err)
+	}
+	if unencoded {
+		return nil, nil, wrapError(ErrMalformed, ErrUnsupportedCrit)
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
+	sig, err := jose.DecodeSegment(parts[2])
+	if err != nil {
+		return nil, nil, wrapError(ErrMalformed, err)
+	}
+	if err = p.key.method.Verify(jose.SigningInput(parts[0], parts[1]), sig, p.key.verifyingKey()); err != nil {
+		return nil, nil, ErrSignatureInvalid
+	}
+
+	claims, err := decodeSegment(parts[1], p.useJSONNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = validateTimes(claims, time.Now()); err != nil {
+		return nil, nil, err
+	}
+
+	if p.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != p.issuer {
+			return nil, nil, fmt.Errorf("%w: %q", ErrInvalidIssuer, iss)
+		}
+	}
+
+	// Check revocation after the signature is verified.
+	if p.revoker != nil {
+		revoked, err := p.revoker.Revoked(revocationClaims(header, claims))
+		if err != nil {
+			return nil, nil, err
+		}
+		if revoked {
+			return nil, nil, ErrTokenRevoked
+		}
+	}
+
+	// Record "jti" at last so that rejected tokens are not recorded.
+	if p.seen != nil {
+		if err = checkReplay(p.seen, claims); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return header, claims, nil
+}
+
+// revocationClaims returns the claims passed to the revoker.
+// "kid" header parameter is added as "kid" claim if it's absent,
+// so that tokens of a single-key Signer can be revoked by RevokeKID().
+// The verified claims are not modified.
+func revocationClaims(header, claims map[string]interface{}) map[string]interface{} {
+	kid, ok := header["kid"].(string)
 	if !ok {
-		return m, ErrParseClaims
+		return claims
+	}
+	if _, ok = claims["kid"]; ok {
+		return claims
 	}
 
-	if !token.Valid {
-		return m, ErrInvalidToken
+	m := make(map[string]interface{}, len(claims)+1)
+	for k, v := range claims {
+		m[k] = v
 	}
+	m["kid"] = kid
+	return m
+}
 
-	return claims, nil
+// checkKey checks the "alg" and "kid" header parameters against the key.
+// It returns ErrAlgNotAllowed if "alg" is not the alg bound to the key or not allowed,
+// and ErrUnknownKID if "kid" is present but it's not the "kid" of the key.
+func (p *Parser) checkKey(header map[string]interface{}) error {
+	alg, _ := header["alg"].(string)
+	if alg != p.key.Alg() || (p.algs != nil && !contains(p.algs, alg)) {
+		return fmt.Errorf("%w: %q", ErrAlgNotAllowed, alg)
+	}
+
+	v, ok := header["kid"]
+	if !ok || p.key.kid == "" {
+		return nil
+	}
+	if kid, ok := v.(string); !ok || kid != p.key.kid {
+		return fmt.Errorf("%w: %v", ErrUnknownKID, v)
+	}
+	return nil
 }
 
-func ParseClaims(tokenString string) (map[string]interface{}, error) {
-	parts := strings.Split(tokenString, ".")
-	if len(parts) != 3 {
-		return nil, ErrInvalidPartNum
+// validateTimes validates "exp", "nbf" and "iat" claims if present.
+func validateTimes(claims map[string]interface{}, now time.Time) error {
+	for _, name := range []string{"exp", "nbf", "iat"} {
+		v, ok := claims[name]
+		if !ok {
+			continue
+		}
+
+		t, ok := numericDate(v)
+		if !ok {
+			return wrapError(ErrMalformed, claimError(ErrClaimType, name))
+		}
+
+		switch name {
+		case "exp":
+			if !now.Before(t) {
+				return &TokenExpiredError{Expiry: t}
+			}
+		default:
+			if now.Before(t) {
+				return &TokenNotYetValidError{NotBefore: t}
+			}
+		}
 	}
+	return nil
+}
 
-	buf, err := jwt.DecodeSegment(parts[1])
+// encodeSegment encodes JWT part with base64url encoding without padding.
+func encodeSegment(buf []byte) string {
+	return jose.EncodeSegment(buf)
+}
+
+// decodeSegment decodes the base64url-encoded JSON object of JWT part.
+// Duplicate member names are rejected.
+func decodeSegment(seg string, useJSONNumber bool) (map[string]interface{}, error) {
+	buf, err := jose.DecodeSegment(seg)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrMalformed, err)
 	}
 
-	m := map[string]interface{}{}
-	dec := json.NewDecoder(bytes.NewBuffer(buf))
-	if err = dec.Decode(&m); err != nil {
-		return nil, err
+	m, err := jose.DecodeObject(buf, useJSONNumber)
+	if err != nil {
+		return nil, wrapError(ErrMalformed, err)
 	}
-
 	return m, nil
 }
+
+// ParseHeader parses the JOSE header but not verify the signature.
+func ParseHeader(tokenString string) (map[string]interface{}, error) {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return nil, wrapError(ErrMalformed, ErrInvalidPartNum)
+	}
+	return decodeSegment(parts[0], false)
+}
+
+// ParseClaims parses the claims but not verify the signature.
+// All numbers will be parsed to json.Number type.
+func ParseClaims(tokenString string) (map[string]interface{}, error) {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return nil, wrapError(ErrMalformed, ErrInvalidPartNum)
+	}
+	return decodeSegment(parts[1], true)
+}
@@ -0,0 +1,179 @@
+package jwthelper
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Policy is an authorization rule over verified claims.
+// Use policy helper functions to get a Policy and combine them:
+// e.g. PolicyAnd(PolicyScopes("read"), PolicyNot(PolicyAnyRole("guest")))
+// The zero Policy denies all claims.
+type Policy struct {
+	f func(claims map[string]interface{}) bool
+	// scopes are the required scopes reported in "insufficient_scope" error.
+	scopes []string
+}
+
+// Allow returns true if the claims satisfy the policy.
+// It returns false for the zero Policy.
+func (p Policy) Allow(claims map[string]interface{}) bool {
+	if p.f == nil {
+		return false
+	}
+	return p.f(claims)
+}
+
+// Scopes returns the granted scopes in claims.
+// It reads "scope"(space-delimited string, RFC 8693) and "scp"(string or array).
+func Scopes(claims map[string]interface{}) []string {
+	scopes := []string{}
+	if s, ok := claims["scope"].(string); ok {
+		scopes = append(scopes, strings.Fields(s)...)
+	}
+	return append(scopes, stringList(claims["scp"])...)
+}
+
+// Roles returns the roles in "roles" claim(string or array).
+func Roles(claims map[string]interface{}) []string {
+	return stringList(claims["roles"])
+}
+
+// contains returns true if the list contains s.
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyClaim returns a Policy which checks the claim value with the predicate.
+// The claim is missing if the value passed to the predicate is nil.
+func PolicyClaim(name string, pred func(v interface{}) bool) Policy {
+	return Policy{f: func(claims map[string]interface{}) bool {
+		return pred(claims[name])
+	}}
+}
+
+// PolicyClaimEquals returns a Policy which requires the string claim equals to the value.
+func PolicyClaimEquals(name, value string) Policy {
+	return PolicyClaim(name, func(v interface{}) bool {
+		s, ok := v.(string)
+		return ok && s == value
+	})
+}
+
+// PolicyScopes returns a Policy which requires all of the scopes.
+func PolicyScopes(scopes ...string) Policy {
+	return Policy{
+		f: func(claims map[string]interface{}) bool {
+			granted := Scopes(claims)
+			for _, s := range scopes {
+				if !contains(granted, s) {
+					return false
+				}
+			}
+			return true
+		},
+		scopes: scopes,
+	}
+}
+
+// PolicyAnyRole returns a Policy which requires any of the roles.
+func PolicyAnyRole(roles ...string) Policy {
+	return Policy{f: func(claims map[string]interface{}) bool {
+		granted := Roles(claims)
+		for _, r := range roles {
+			if contains(granted, r) {
+				return true
+			}
+		}
+		return false
+	}}
+}
+
+// PolicyAnd returns a Policy which requires all of the policies.
+func PolicyAnd(policies ...Policy) Policy {
+	scopes := []string{}
+	for _, p := range policies {
+		scopes = append(scopes, p.scopes...)
+	}
+
+	return Policy{
+		f: func(claims map[string]interface{}) bool {
+			for _, p := range policies {
+				if !p.Allow(claims) {
+					return false
+				}
+			}
+			return true
+		},
+		scopes: scopes,
+	}
+}
+
+// PolicyOr returns a Policy which requires any of the policies.
+// The scopes of all the policies are reported in "insufficient_scope" error.
+func PolicyOr(policies ...Policy) Policy {
+	scopes := []string{}
+	for _, p := range policies {
+		for _, s := range p.scopes {
+			if !contains(scopes, s) {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+
+	return Policy{
+		f: func(claims map[string]interface{}) bool {
+			for _, p := range policies {
+				if p.Allow(claims) {
+					return true
+				}
+			}
+			return false
+		},
+		scopes: scopes,
+	}
+}
+
+// PolicyNot returns a Policy which negates the policy.
+func PolicyNot(p Policy) Policy {
+	return Policy{f: func(claims map[string]interface{}) bool {
+		return !p.Allow(claims)
+	}}
+}
+
+// Require returns the middleware which checks the policy over the claims in the context.
+// Use it after an authentication middleware. e.g. BearerMiddleware(), SessionManager.Middleware().
+// It responds 401 if there are no claims in the context,
+// or 403 with "insufficient_scope" error(RFC 6750) if the policy is not satisfied.
+func Require(p Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				bearerError(w, http.StatusUnauthorized, "", "")
+				return
+			}
+
+			if !p.Allow(claims) {
+				bearerError(w, http.StatusForbidden, "insufficient_scope", strings.Join(p.scopes, " "))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScopes returns the middleware which requires all of the scopes.
+func RequireScopes(scopes ...string) func(http.Handler) http.Handler {
+	return Require(PolicyScopes(scopes...))
+}
+
+// RequireAnyRole returns the middleware which requires any of the roles.
+func RequireAnyRole(roles ...string) func(http.Handler) http.Handler {
+	return Require(PolicyAnyRole(roles...))
+}
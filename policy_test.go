@@ -0,0 +1,105 @@
+package jwthelper_test
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleRequireScopes() {
+	log.Printf("\n\nExample of scope and role authorization")
+
+	s, err := jwthelper.NewSigner("RS256", []byte(rsaPrivPEM))
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+
+	p, err := jwthelper.NewParser("RS256", []byte(rsaPubPEM))
+	if err != nil {
+		log.Printf("NewParser() error: %v", err)
+		return
+	}
+
+	tokenString, err := s.SignedString(
+		jwthelper.NewClaim("scope", "orders:read profile"),
+		jwthelper.NewClaim("roles", []string{"staff"}),
+	)
+	if err != nil {
+		log.Printf("SignedString() error: %v", err)
+		return
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "OK")
+	})
+	auth := jwthelper.BearerMiddleware(p)
+
+	handlers := []http.Handler{
+		auth(jwthelper.RequireScopes("orders:read")(ok)),
+		auth(jwthelper.RequireScopes("orders:write")(ok)),
+		auth(jwthelper.Require(jwthelper.PolicyAnd(
+			jwthelper.PolicyAnyRole("staff", "admin"),
+			jwthelper.PolicyNot(jwthelper.PolicyAnyRole("guest")),
+		))(ok)),
+	}
+
+	for _, h := range handlers {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+tokenString)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		fmt.Println(w.Code, w.Header().Get("WWW-Authenticate") != "")
+	}
+
+	// Output:
+	// 200 false
+	// 403 true
+	// 200 false
+}
+
+func TestRequire(t *testing.T) {
+	s, err := jwthelper.NewSigner("RS256", []byte(rsaPrivPEM))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	p, err := jwthelper.NewParser("RS256", []byte(rsaPubPEM))
+	if err != nil {
+		t.Fatalf("NewParser() error: %v", err)
+	}
+	tokenString, err := s.SignedString(jwthelper.NewClaim("scope", "profile"))
+	if err != nil {
+		t.Fatalf("SignedString() error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		policy    jwthelper.Policy
+		status    int
+		challenge string
+	}{
+		{"scope", jwthelper.PolicyScopes("profile"), http.StatusOK, ""},
+		{"zero policy", jwthelper.Policy{}, http.StatusForbidden, `Bearer error="insufficient_scope"`},
+		{"or", jwthelper.PolicyOr(jwthelper.PolicyScopes("read"), jwthelper.PolicyScopes("admin", "read")), http.StatusForbidden, `Bearer error="insufficient_scope", scope="read admin"`},
+		{"or allowed", jwthelper.PolicyOr(jwthelper.PolicyScopes("read"), jwthelper.PolicyScopes("profile")), http.StatusOK, ""},
+		{"and", jwthelper.PolicyAnd(jwthelper.PolicyScopes("profile"), jwthelper.PolicyScopes("write")), http.StatusForbidden, `Bearer error="insufficient_scope", scope="profile write"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := jwthelper.BearerMiddleware(p)(jwthelper.Require(tt.policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Authorization", "Bearer "+tokenString)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.status || w.Header().Get("WWW-Authenticate") != tt.challenge {
+				t.Errorf("Require() = %v %q, want %v %q", w.Code, w.Header().Get("WWW-Authenticate"), tt.status, tt.challenge)
+			}
+		})
+	}
+}
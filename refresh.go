@@ -0,0 +1,322 @@
+package jwthelper
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RefreshStore stores refresh token families.
+// A family is the chain of refresh tokens rotated from the one issued at login.
+// Only the latest refresh token of a family is valid.
+type RefreshStore interface {
+	// Create creates a family with its first refresh token "jti".
+	// The family is kept until exp.
+	Create(family, jti string, exp time.Time) error
+	// Rotate replaces the current refresh token "jti" of the family with the new one.
+	// If oldJTI is not the current one, the rotated token is reused:
+	// it must revoke the whole family and return ErrRefreshTokenReused.
+	// It returns ErrRefreshTokenRevoked if the family is revoked or not found.
+	// Check and replace must be atomic under concurrent calls.
+	Rotate(family, oldJTI, newJTI string, exp time.Time) error
+	// Revoke revokes the whole family.
+	Revoke(family string) error
+}
+
+var (
+	// ErrRefreshTokenReused represents the error of reusing a rotated refresh token.
+	ErrRefreshTokenReused = fmt.Errorf("refresh token is reused")
+	// ErrRefreshTokenRevoked represents the error of revoked refresh token family.
+	ErrRefreshTokenRevoked = fmt.Errorf("refresh token is revoked")
+	// ErrInvalidTokenType represents the error of unexpected "typ" header.
+	ErrInvalidTokenType = fmt.Errorf("invalid token type")
+	// ErrInvalidAudience represents the error of unexpected "aud" claim.
+	ErrInvalidAudience = fmt.Errorf("invalid audience")
+	// ErrInvalidRefreshToken represents the error of refresh token without required claims.
+	ErrInvalidRefreshToken = fmt.Errorf("invalid refresh token")
+)
+
+// refreshFamily stores the state of a refresh token family.
+type refreshFamily struct {
+	current string
+	revoked bool
+	expiry  time.Time
+}
+
+// MemoryRefreshStore is an in-memory RefreshStore.
+// Families are evicted after they expire.
+// It's safe for concurrent use.
+type MemoryRefreshStore struct {
+	m        sync.Mutex
+	families map[string]*refreshFamily
+}
+
+// NewMemoryRefreshStore news a MemoryRefreshStore.
+func NewMemoryRefreshStore() *MemoryRefreshStore {
+	return &MemoryRefreshStore{
+		families: map[string]*refreshFamily{},
+	}
+}
+
+// Create implements RefreshStore interface.
+func (s *MemoryRefreshStore) Create(family, jti string, exp time.Time) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	now := time.Now()
+	for k, f := range s.families {
+		if now.After(f.expiry) {
+			delete(s.families, k)
+		}
+	}
+
+	s.families[family] = &refreshFamily{current: jti, expiry: exp}
+	return nil
+}
+
+// Rotate implements RefreshStore interface.
+func (s *MemoryRefreshStore) Rotate(family, oldJTI, newJTI string, exp time.Time) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	f, ok := s.families[family]
+	if !ok || f.revoked || time.Now().After(f.expiry) {
+		return ErrRefreshTokenRevoked
+	}
+
+	if f.current != oldJTI {
+		f.revoked = true
+		return ErrRefreshTokenReused
+	}
+
+	f.current = newJTI
+	f.expiry = exp
+	return nil
+}
+
+// Revoke implements RefreshStore interface.
+func (s *MemoryRefreshStore) Revoke(family string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if f, ok := s.families[family]; ok {
+		f.revoked = true
+	}
+	return nil
+}
+
+// TokenPair contains an access token and a refresh token.
+type TokenPair struct {
+	AccessToken        string
+	AccessTokenExpiry  time.Time
+	RefreshToken       string
+	RefreshTokenExpiry time.Time
+}
+
+// TokenPairIssuer issues access and refresh token pairs and rotates refresh tokens.
+type TokenPairIssuer struct {
+	signer          *Signer
+	parser          *Parser
+	store           RefreshStore
+	accessTTL       time.Duration
+	refreshTTL      time.Duration
+	accessAudience  string
+	refreshAudience string
+}
+
+// TokenPairOption represents the option for issuing token pairs.
+// Use option helper functions to set options:
+// e.g. AccessTokenTTL()
+type TokenPairOption struct {
+	f func(i *TokenPairIssuer)
+}
+
+// "typ" header parameters of access and refresh tokens.
+const (
+	AccessTokenType  = "at+jwt"
+	RefreshTokenType = "rt+jwt"
+)
+
+// AccessTokenTTL returns the option for the lifetime of access tokens.
+// It's 15 minutes by default.
+func AccessTokenTTL(ttl time.Duration) TokenPairOption {
+	return TokenPairOption{func(i *TokenPairIssuer) {
+		i.accessTTL = ttl
+	}}
+}
+
+// RefreshTokenTTL returns the option for the lifetime of refresh tokens.
+// It's 30 days by default.
+// Each rotation issues a new refresh token with the full lifetime.
+func RefreshTokenTTL(ttl time.Duration) TokenPairOption {
+	return TokenPairOption{func(i *TokenPairIssuer) {
+		i.refreshTTL = ttl
+	}}
+}
+
+// AccessTokenAudience returns the option for "aud" of access tokens.
+func AccessTokenAudience(aud string) TokenPairOption {
+	return TokenPairOption{func(i *TokenPairIssuer) {
+		i.accessAudience = aud
+	}}
+}
+
+// RefreshTokenAudience returns the option for "aud" of refresh tokens.
+// It's "refresh" by default.
+func RefreshTokenAudience(aud string) TokenPairOption {
+	return TokenPairOption{func(i *TokenPairIssuer) {
+		i.refreshAudience = aud
+	}}
+}
+
+// NewTokenPairIssuer news a TokenPairIssuer.
+//
+//     Params:
+//         signer: signer to sign both access and refresh tokens.
+//         parser: parser to verify refresh tokens. It should use the key of the signer.
+//         store: refresh store to track refresh token families.
+//         options: variadic options returned by option helper functions.
+//                  e.g. AccessTokenTTL(), RefreshTokenAudience().
+func NewTokenPairIssuer(signer *Signer, parser *Parser, store RefreshStore, options ...TokenPairOption) *TokenPairIssuer {
+	i := &TokenPairIssuer{
+		signer:          signer,
+		parser:          parser,
+		store:           store,
+		accessTTL:       15 * time.Minute,
+		refreshTTL:      30 * 24 * time.Hour,
+		refreshAudience: "refresh",
+	}
+
+	for _, op := range options {
+		op.f(i)
+	}
+	return i
+}
+
+// issue mints a token pair of the refresh token family.
+func (i *TokenPairIssuer) issue(sub, family, jti string, refreshExp time.Time, claims ...Claim) (*TokenPair, error) {
+	now := time.Now()
+	accessJTI, err := newJTI()
+	if err != nil {
+		return nil, err
+	}
+
+	accessExp := now.Add(i.accessTTL)
+	// Copy claims so that the caller's slice is not modified.
+	accessClaims := make([]Claim, 0, len(claims)+6)
+	accessClaims = append(accessClaims, claims...)
+	accessClaims = append(accessClaims,
+		NewHeader("typ", AccessTokenType),
+		NewClaim("sub", sub),
+		NewClaim("jti", accessJTI),
+		TimeClaim("iat", now),
+		TimeClaim("exp", accessExp),
+	)
+	if i.accessAudience != "" {
+		accessClaims = append(accessClaims, NewClaim("aud", i.accessAudience))
+	}
+
+	access, err := i.signer.SignedString(accessClaims...)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := i.signer.SignedString(
+		NewHeader("typ", RefreshTokenType),
+		NewClaim("sub", sub),
+		NewClaim("aud", i.refreshAudience),
+		NewClaim("jti", jti),
+		NewClaim("fid", family),
+		TimeClaim("iat", now),
+		TimeClaim("exp", refreshExp),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:        access,
+		AccessTokenExpiry:  accessExp,
+		RefreshToken:       refresh,
+		RefreshTokenExpiry: refreshExp,
+	}, nil
+}
+
+// Issue issues a token pair for the subject and starts a new refresh token family.
+//
+// sub: subject of the tokens.
+// claims: extra claims of the access token.
+func (i *TokenPairIssuer) Issue(sub string, claims ...Claim) (*TokenPair, error) {
+	family, err := newJTI()
+	if err != nil {
+		return nil, err
+	}
+	jti, err := newJTI()
+	if err != nil {
+		return nil, err
+	}
+
+	exp := time.Now().Add(i.refreshTTL)
+	if err = i.store.Create(family, jti, exp); err != nil {
+		return nil, err
+	}
+	return i.issue(sub, family, jti, exp, claims...)
+}
+
+// verifyRefreshToken verifies the refresh token and returns subject, family and "jti".
+func (i *TokenPairIssuer) verifyRefreshToken(refreshToken string) (string, string, string, error) {
+	header, claims, err := i.parser.parse(refreshToken)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if typ, _ := header["typ"].(string); typ != RefreshTokenType {
+		return "", "", "", ErrInvalidTokenType
+	}
+
+	if !hasAudience(claims, i.refreshAudience) {
+		return "", "", "", ErrInvalidAudience
+	}
+
+	sub, _ := claims["sub"].(string)
+	family, _ := claims["fid"].(string)
+	jti, _ := claims["jti"].(string)
+	if sub == "" || family == "" || jti == "" {
+		return "", "", "", ErrInvalidRefreshToken
+	}
+	return sub, family, jti, nil
+}
+
+// Refresh verifies and rotates the refresh token and issues a new token pair.
+//
+// refreshToken: refresh token of the current pair. It's invalidated after rotation.
+// claims: extra claims of the new access token.
+// Comments:
+// It returns ErrRefreshTokenReused if a rotated refresh token is presented.
+// The whole family is revoked in this case and all refresh tokens of it are rejected.
+func (i *TokenPairIssuer) Refresh(refreshToken string, claims ...Claim) (*TokenPair, error) {
+	sub, family, jti, err := i.verifyRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := newJTI()
+	if err != nil {
+		return nil, err
+	}
+
+	exp := time.Now().Add(i.refreshTTL)
+	if err = i.store.Rotate(family, jti, next, exp); err != nil {
+		return nil, err
+	}
+	return i.issue(sub, family, next, exp, claims...)
+}
+
+// Revoke revokes the family of the refresh token. e.g. on logout.
+func (i *TokenPairIssuer) Revoke(refreshToken string) error {
+	_, family, _, err := i.verifyRefreshToken(refreshToken)
+	if err != nil {
+		return err
+	}
+	return i.store.Revoke(family)
+}
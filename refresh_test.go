@@ -0,0 +1,117 @@
+package jwthelper_test
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleTokenPairIssuer_Refresh() {
+	log.Printf("\n\nExample of refresh token rotation")
+
+	s, err := jwthelper.NewSigner("RS256", []byte(rsaPrivPEM))
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+
+	p, err := jwthelper.NewParser("RS256", []byte(rsaPubPEM))
+	if err != nil {
+		log.Printf("NewParser() error: %v", err)
+		return
+	}
+
+	issuer := jwthelper.NewTokenPairIssuer(
+		s,
+		p,
+		jwthelper.NewMemoryRefreshStore(),
+		jwthelper.AccessTokenAudience("api"),
+	)
+
+	// Issue a token pair on login.
+	pair, err := issuer.Issue("admin", jwthelper.NewClaim("role", "admin"))
+	if err != nil {
+		log.Printf("Issue() error: %v", err)
+		return
+	}
+
+	// Access token can not be used as refresh token.
+	_, err = issuer.Refresh(pair.AccessToken)
+	fmt.Println(err)
+
+	// Exchange refresh token for a new pair. The old refresh token is invalidated.
+	newPair, err := issuer.Refresh(pair.RefreshToken)
+	if err != nil {
+		log.Printf("Refresh() error: %v", err)
+		return
+	}
+
+	// Reuse of the rotated refresh token revokes the whole family.
+	_, err = issuer.Refresh(pair.RefreshToken)
+	fmt.Println(err)
+	_, err = issuer.Refresh(newPair.RefreshToken)
+	fmt.Println(err)
+
+	// Output:
+	// invalid token type
+	// refresh token is reused
+	// refresh token is revoked
+}
+
+func TestTokenPairIssuerBearer(t *testing.T) {
+	s, err := jwthelper.NewSigner("RS256", []byte(rsaPrivPEM))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	p, err := jwthelper.NewParser("RS256", []byte(rsaPubPEM))
+	if err != nil {
+		t.Fatalf("NewParser() error: %v", err)
+	}
+	issuer := jwthelper.NewTokenPairIssuer(s, p, jwthelper.NewMemoryRefreshStore())
+
+	// Extra claims with spare capacity must not be overwritten.
+	claims := make([]jwthelper.Claim, 8)
+	for i := range claims {
+		claims[i] = jwthelper.NewClaim("role", "admin")
+	}
+	pair, err := issuer.Issue("admin", claims[:1]...)
+	if err != nil {
+		t.Fatalf("Issue() error: %v", err)
+	}
+	str, err := s.SignedString(claims...)
+	if err != nil {
+		t.Fatalf("SignedString() error: %v", err)
+	}
+	header, _ := jwthelper.ParseHeader(str)
+	m, _ := jwthelper.ParseClaims(str)
+	if _, ok := m["jti"]; ok || header["typ"] != "JWT" {
+		t.Errorf("Issue() modified the caller's slice: %v %v", header, m)
+	}
+
+	// Refresh token is signed by the same key but it's not a bearer token.
+	h := jwthelper.BearerMiddleware(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"access token", pair.AccessToken, http.StatusOK},
+		{"refresh token", pair.RefreshToken, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("BearerMiddleware() status = %v, want %v", w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package jwthelper
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SeenStore records "jti" of tokens which have been accepted.
+// Use ParserReplayProtection() to set the seen store of a parser.
+type SeenStore interface {
+	// Seen records the "jti" until exp and returns true if it was recorded before.
+	// Check and record must be atomic under concurrent calls.
+	Seen(jti string, exp time.Time) (bool, error)
+}
+
+var (
+	// ErrTokenReplayed represents the error of a single-use token presented more than once.
+	ErrTokenReplayed = fmt.Errorf("token is replayed")
+	// ErrJTINotFound represents the error of "jti" not found in claims.
+	ErrJTINotFound = fmt.Errorf("jti not found in claims")
+	// ErrExpNotFound represents the error of "exp" not found in claims.
+	ErrExpNotFound = fmt.Errorf("exp not found in claims")
+)
+
+// MemorySeenStore is an in-memory SeenStore.
+// Entries are evicted after the tokens expire.
+// It's safe for concurrent use.
+type MemorySeenStore struct {
+	m         sync.Mutex
+	seen      map[string]time.Time
+	lastEvict time.Time
+}
+
+// evictInterval is the minimum interval between two evictions of MemorySeenStore.
+const evictInterval = time.Minute
+
+// NewMemorySeenStore news a MemorySeenStore.
+func NewMemorySeenStore() *MemorySeenStore {
+	return &MemorySeenStore{
+		seen: map[string]time.Time{},
+	}
+}
+
+// Seen implements SeenStore interface.
+func (s *MemorySeenStore) Seen(jti string, exp time.Time) (bool, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastEvict) > evictInterval {
+		for k, v := range s.seen {
+			if now.After(v) {
+				delete(s.seen, k)
+			}
+		}
+		s.lastEvict = now
+	}
+
+	if v, ok := s.seen[jti]; ok && !now.After(v) {
+		return true, nil
+	}
+	s.seen[jti] = exp
+	return false, nil
+}
+
+// ParserReplayProtection returns the option for accepting each token only once.
+// Tokens must have "jti" and "exp" claims.
+// Parser.Parse() records "jti" in the store until "exp"
+// and returns ErrTokenReplayed when the token is presented again.
+//
+// comments:
+// "jti" is recorded by Parser.Parse() after the signature, times, issuer and revocation are checked.
+// Wrapping verifiers(e.g. IDTokenVerifier, AccessTokenValidator, ClientAssertionVerifier)
+// run their own checks after Parse(), so a token rejected by them for "aud", "typ" or other claims
+// has already used up its "jti" and can not be presented again.
+// ClientAssertionVerifier and StreamAuthenticator tickets record "jti" after their checks with their own store:
+// don't set this option on their parsers.
+func ParserReplayProtection(store SeenStore) ParserOption {
+	return ParserOption{func(p *Parser) {
+		p.seen = store
+	}}
+}
+
+// checkReplay records "jti" of the verified claims in the seen store.
+func checkReplay(store SeenStore, claims map[string]interface{}) error {
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return ErrJTINotFound
+	}
+
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return ErrExpNotFound
+	}
+
+	seen, err := store.Seen(jti, exp)
+	if err != nil {
+		return err
+	}
+	if seen {
+		return ErrTokenReplayed
+	}
+	return nil
+}
+
+// newJTI returns a random "jti"(JWT ID).
+func newJTI() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// SignedSingleUseString returns the signed string of a single-use token.
+//
+// ttl: lifetime of the token. "exp" is set to now + ttl.
+// claims: variadic Claim returned by claim helper functions.
+// Comments:
+// It adds a random "jti", "iat" and "exp" to the claims.
+// Use ParserReplayProtection() to accept the token only once.
+func (s *Signer) SignedSingleUseString(ttl time.Duration, claims ...Claim) (string, error) {
+	jti, err := newJTI()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims = append(claims,
+		NewClaim("jti", jti),
+		TimeClaim("iat", now),
+		TimeClaim("exp", now.Add(ttl)),
+	)
+	return s.SignedString(claims...)
+}
@@ -0,0 +1,94 @@
+package jwthelper_test
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleSigner_SignedSingleUseString() {
+	log.Printf("\n\nExample of single-use token")
+
+	s, err := jwthelper.NewSigner("RS256", []byte(rsaPrivPEM))
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+
+	// Sign a password-reset token with a random "jti".
+	str, err := s.SignedSingleUseString(
+		15*time.Minute,
+		jwthelper.NewClaim("sub", "admin"),
+		jwthelper.NewClaim("purpose", "reset-password"),
+	)
+	if err != nil {
+		log.Printf("SignedSingleUseString() error: %v", err)
+		return
+	}
+
+	p, err := jwthelper.NewParser(
+		"RS256",
+		[]byte(rsaPubPEM),
+		jwthelper.ParserReplayProtection(jwthelper.NewMemorySeenStore()),
+	)
+	if err != nil {
+		log.Printf("NewParser() error: %v", err)
+		return
+	}
+
+	// The token is accepted only once.
+	_, err = p.Parse(str)
+	fmt.Println(err)
+	_, err = p.Parse(str)
+	fmt.Println(err)
+
+	// Output:
+	// <nil>
+	// token is replayed
+}
+
+func TestParserReplayProtectionConcurrent(t *testing.T) {
+	s, err := jwthelper.NewSigner("RS256", []byte(rsaPrivPEM))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	p, err := jwthelper.NewParser("RS256", []byte(rsaPubPEM), jwthelper.ParserReplayProtection(jwthelper.NewMemorySeenStore()))
+	if err != nil {
+		t.Fatalf("NewParser() error: %v", err)
+	}
+
+	str, err := s.SignedSingleUseString(time.Minute, jwthelper.NewClaim("sub", "admin"))
+	if err != nil {
+		t.Fatalf("SignedSingleUseString() error: %v", err)
+	}
+
+	const n = 50
+	var ok, replayed int32
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := p.Parse(str)
+			switch {
+			case err == nil:
+				atomic.AddInt32(&ok, 1)
+			case errors.Is(err, jwthelper.ErrTokenReplayed):
+				atomic.AddInt32(&replayed, 1)
+			default:
+				t.Errorf("Parse() error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ok != 1 || replayed != n-1 {
+		t.Errorf("accepted %v and replayed %v, want 1 and %v", ok, replayed, n-1)
+	}
+}
@@ -0,0 +1,169 @@
+package jwthelper
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Revoker is used to check whether a token is revoked.
+// It's called by Parser.Parse() after the signature is verified.
+// Use ParserRevoker() to set the revoker of a parser.
+type Revoker interface {
+	// Revoked returns true if the token with given verified claims is revoked.
+	Revoked(claims map[string]interface{}) (bool, error)
+}
+
+var (
+	// ErrTokenRevoked represents the error of revoked token.
+	ErrTokenRevoked = fmt.Errorf("token is revoked")
+)
+
+// Kinds of revocation entries.
+const (
+	revokeJTI = "jti"
+	revokeSub = "sub"
+	revokeKID = "kid"
+)
+
+// revocation represents a revocation entry.
+type revocation struct {
+	// Kind is one of "jti", "sub" and "kid".
+	Kind string `json:"kind"`
+	// Value is the value of "jti", "sub" or "kid" claim.
+	Value string `json:"value"`
+	// Before is only used by "sub" revocation.
+	// Tokens of the subject issued before the second of it are revoked.
+	Before time.Time `json:"before,omitempty"`
+	// Expiry is the time after which revoked tokens would have expired anyway.
+	// The entry is evicted after it.
+	Expiry time.Time `json:"expiry"`
+}
+
+// revocationList stores revocation entries.
+// It's not safe for concurrent use.
+type revocationList map[string]revocation
+
+// add adds an entry to the list.
+// For "sub" revocation, the later "before" and "expiry" win.
+func (l revocationList) add(r revocation) {
+	k := r.Kind + ":" + r.Value
+	if old, ok := l[k]; ok {
+		if old.Before.After(r.Before) {
+			r.Before = old.Before
+		}
+		if old.Expiry.After(r.Expiry) {
+			r.Expiry = old.Expiry
+		}
+	}
+	l[k] = r
+}
+
+// evict removes expired entries.
+func (l revocationList) evict(now time.Time) {
+	for k, r := range l {
+		if now.After(r.Expiry) {
+			delete(l, k)
+		}
+	}
+}
+
+// lookup returns the unexpired entry by kind and value.
+func (l revocationList) lookup(kind, value string, now time.Time) (revocation, bool) {
+	r, ok := l[kind+":"+value]
+	if !ok || now.After(r.Expiry) {
+		return revocation{}, false
+	}
+	return r, true
+}
+
+// revoked checks claims against the list.
+func (l revocationList) revoked(claims map[string]interface{}, now time.Time) bool {
+	if jti, ok := claims["jti"].(string); ok {
+		if _, ok = l.lookup(revokeJTI, jti, now); ok {
+			return true
+		}
+	}
+
+	if sub, ok := claims["sub"].(string); ok {
+		if r, ok := l.lookup(revokeSub, sub, now); ok {
+			// Token without "iat" can not be proved to be issued after revocation.
+			// "iat" has second precision, so tokens issued in the same second as "before" are not revoked.
+			iat, ok := numericDate(claims["iat"])
+			if !ok || iat.Before(r.Before.Truncate(time.Second)) {
+				return true
+			}
+		}
+	}
+
+	if kid, ok := claims["kid"].(string); ok {
+		if _, ok = l.lookup(revokeKID, kid, now); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MemoryRevoker is an in-memory Revoker.
+// Entries are evicted once the revoked tokens would have expired anyway.
+// It's safe for concurrent use.
+type MemoryRevoker struct {
+	m    sync.Mutex
+	list revocationList
+}
+
+// NewMemoryRevoker news a MemoryRevoker.
+func NewMemoryRevoker() *MemoryRevoker {
+	return &MemoryRevoker{
+		list: revocationList{},
+	}
+}
+
+// add adds an entry and evicts expired ones.
+func (r *MemoryRevoker) add(e revocation) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.list.evict(time.Now())
+	r.list.add(e)
+}
+
+// RevokeJTI revokes the token with given "jti".
+//
+// exp: expiration time of the token. The entry is evicted after it.
+func (r *MemoryRevoker) RevokeJTI(jti string, exp time.Time) {
+	r.add(revocation{Kind: revokeJTI, Value: jti, Expiry: exp})
+}
+
+// RevokeSubject revokes all tokens of the subject("sub") issued before given time.
+//
+// before: tokens with "iat" before the second of it are revoked.
+// Tokens issued in the same second are not revoked because "iat" has second precision.
+// Pass the next second to revoke all tokens issued until now. e.g. time.Now().Add(time.Second).
+// exp: the latest expiration time of the revoked tokens. The entry is evicted after it.
+func (r *MemoryRevoker) RevokeSubject(sub string, before, exp time.Time) {
+	r.add(revocation{Kind: revokeSub, Value: sub, Before: before, Expiry: exp})
+}
+
+// RevokeKID revokes all tokens with given "kid".
+//
+// exp: the latest expiration time of the tokens signed by the key. The entry is evicted after it.
+func (r *MemoryRevoker) RevokeKID(kid string, exp time.Time) {
+	r.add(revocation{Kind: revokeKID, Value: kid, Expiry: exp})
+}
+
+// Revoked implements Revoker interface.
+func (r *MemoryRevoker) Revoked(claims map[string]interface{}) (bool, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.list.revoked(claims, time.Now()), nil
+}
+
+// ParserRevoker returns the option for checking revocation.
+// Parser.Parse() returns ErrTokenRevoked if the verified token is revoked.
+func ParserRevoker(r Revoker) ParserOption {
+	return ParserOption{func(p *Parser) {
+		p.revoker = r
+	}}
+}
@@ -0,0 +1,305 @@
+package jwthelper_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleParserRevoker() {
+	log.Printf("\n\nExample of revoking tokens")
+
+	s, err := jwthelper.NewSigner("RS256", []byte(rsaPrivPEM))
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+
+	now := time.Now()
+	exp := now.Add(time.Hour)
+	str, err := s.SignedString(
+		jwthelper.NewClaim("jti", "session-1"),
+		jwthelper.NewClaim("sub", "admin"),
+		jwthelper.TimeClaim("iat", now),
+		jwthelper.TimeClaim("exp", exp),
+	)
+	if err != nil {
+		log.Printf("SignedString() error: %v", err)
+		return
+	}
+
+	// Revoked tokens will be evicted after they expire.
+	r := jwthelper.NewMemoryRevoker()
+	p, err := jwthelper.NewParser("RS256", []byte(rsaPubPEM), jwthelper.ParserRevoker(r))
+	if err != nil {
+		log.Printf("NewParser() error: %v", err)
+		return
+	}
+
+	_, err = p.Parse(str)
+	fmt.Println(err)
+
+	// Revoke all tokens of "admin" issued until now.
+	// "iat" has second precision, so pass the next second.
+	r.RevokeSubject("admin", now.Add(time.Second), exp)
+	_, err = p.Parse(str)
+	fmt.Println(err)
+
+	// Output:
+	// <nil>
+	// token is revoked
+}
+
+// revokeEntry revokes an entry with the memory or file revoker.
+func revokeEntry(t *testing.T, r jwthelper.Revoker, kind, value string, before, exp time.Time) {
+	var err error
+	switch r := r.(type) {
+	case *jwthelper.MemoryRevoker:
+		switch kind {
+		case "jti":
+			r.RevokeJTI(value, exp)
+		case "sub":
+			r.RevokeSubject(value, before, exp)
+		case "kid":
+			r.RevokeKID(value, exp)
+		}
+	case *jwthelper.FileRevoker:
+		switch kind {
+		case "jti":
+			err = r.RevokeJTI(value, exp)
+		case "sub":
+			err = r.RevokeSubject(value, before, exp)
+		case "kid":
+			err = r.RevokeKID(value, exp)
+		}
+	}
+	if err != nil {
+		t.Fatalf("revoke %v %q error: %v", kind, value, err)
+	}
+}
+
+func TestRevokers(t *testing.T) {
+	now := time.Now()
+	exp := now.Add(time.Hour)
+	// sec is the start of a second. Revocation at sec + 0.5s keeps tokens issued in that second.
+	sec := now.Truncate(time.Second)
+
+	tests := []struct {
+		name   string
+		kind   string
+		value  string
+		before time.Time
+		exp    time.Time
+		claims map[string]interface{}
+		want   bool
+	}{
+		{"jti", "jti", "id-1", time.Time{}, exp, map[string]interface{}{"jti": "id-1"}, true},
+		{"other jti", "jti", "id-1", time.Time{}, exp, map[string]interface{}{"jti": "id-2"}, false},
+		{"expired jti", "jti", "id-1", time.Time{}, now.Add(-time.Second), map[string]interface{}{"jti": "id-1"}, false},
+		{"sub issued before", "sub", "frank", now, exp, map[string]interface{}{"sub": "frank", "iat": float64(now.Add(-time.Minute).Unix())}, true},
+		{"sub issued after", "sub", "frank", now, exp, map[string]interface{}{"sub": "frank", "iat": float64(now.Add(time.Minute).Unix())}, false},
+		{"sub issued in the same second", "sub", "frank", sec.Add(500 * time.Millisecond), exp, map[string]interface{}{"sub": "frank", "iat": float64(sec.Unix())}, false},
+		{"sub issued in the previous second", "sub", "frank", sec.Add(500 * time.Millisecond), exp, map[string]interface{}{"sub": "frank", "iat": float64(sec.Unix() - 1)}, true},
+		{"sub without iat", "sub", "frank", now, exp, map[string]interface{}{"sub": "frank"}, true},
+		{"other sub", "sub", "frank", now, exp, map[string]interface{}{"sub": "bob"}, false},
+		{"expired sub", "sub", "frank", now, now.Add(-time.Second), map[string]interface{}{"sub": "frank"}, false},
+		{"kid", "kid", "key-1", time.Time{}, exp, map[string]interface{}{"kid": "key-1"}, true},
+		{"other kid", "kid", "key-1", time.Time{}, exp, map[string]interface{}{"kid": "key-2"}, false},
+		{"expired kid", "kid", "key-1", time.Time{}, now.Add(-time.Second), map[string]interface{}{"kid": "key-1"}, false},
+	}
+
+	newRevokers := map[string]func(t *testing.T) jwthelper.Revoker{
+		"memory": func(t *testing.T) jwthelper.Revoker {
+			return jwthelper.NewMemoryRevoker()
+		},
+		"file": func(t *testing.T) jwthelper.Revoker {
+			r, err := jwthelper.NewFileRevoker(filepath.Join(t.TempDir(), "revoked"))
+			if err != nil {
+				t.Fatalf("NewFileRevoker() error: %v", err)
+			}
+			return r
+		},
+	}
+
+	for name, newRevoker := range newRevokers {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				r := newRevoker(t)
+				revokeEntry(t, r, tt.kind, tt.value, tt.before, tt.exp)
+				revoked, err := r.Revoked(tt.claims)
+				if err != nil {
+					t.Fatalf("Revoked() error: %v", err)
+				}
+				if revoked != tt.want {
+					t.Errorf("Revoked(%v) = %v, want %v", tt.claims, revoked, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestFileRevokerSharing(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "revoked")
+	r1, err := jwthelper.NewFileRevoker(file)
+	if err != nil {
+		t.Fatalf("NewFileRevoker() error: %v", err)
+	}
+	r2, err := jwthelper.NewFileRevoker(file)
+	if err != nil {
+		t.Fatalf("NewFileRevoker() error: %v", err)
+	}
+
+	revoked := func(r *jwthelper.FileRevoker, jti string) bool {
+		ok, err := r.Revoked(map[string]interface{}{"jti": jti})
+		if err != nil {
+			t.Fatalf("Revoked() error: %v", err)
+		}
+		return ok
+	}
+
+	// r2 reloads the file after r1 appends an entry.
+	now := time.Now()
+	if revoked(r2, "id-1") {
+		t.Fatalf("id-1 is revoked before RevokeJTI()")
+	}
+	if err = r1.RevokeJTI("id-1", now.Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeJTI() error: %v", err)
+	}
+	if !revoked(r2, "id-1") {
+		t.Errorf("r2: id-1 is not revoked by r1")
+	}
+
+	// Entries are shared in both directions.
+	if err = r2.RevokeJTI("id-2", now.Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeJTI() error: %v", err)
+	}
+	if !revoked(r1, "id-2") || !revoked(r1, "id-1") {
+		t.Errorf("r1: id-1 or id-2 is not revoked")
+	}
+
+	// Malformed lines are skipped.
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("OpenFile() error: %v", err)
+	}
+	if _, err = f.WriteString("not json\n{\"kind\":\n"); err != nil {
+		t.Fatalf("WriteString() error: %v", err)
+	}
+	f.Close()
+	if err = r1.RevokeJTI("id-3", now.Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeJTI() error: %v", err)
+	}
+	if !revoked(r2, "id-1") || !revoked(r2, "id-3") {
+		t.Errorf("r2: entries around malformed lines are not revoked")
+	}
+
+	// Expired entries are skipped when a new instance loads the file.
+	if err = r1.RevokeJTI("id-4", now.Add(-time.Second)); err != nil {
+		t.Fatalf("RevokeJTI() error: %v", err)
+	}
+	r3, err := jwthelper.NewFileRevoker(file)
+	if err != nil {
+		t.Fatalf("NewFileRevoker() error: %v", err)
+	}
+	if revoked(r3, "id-4") {
+		t.Errorf("r3: expired id-4 is revoked")
+	}
+	if !revoked(r3, "id-1") || !revoked(r3, "id-2") || !revoked(r3, "id-3") {
+		t.Errorf("r3: unexpired entries are not revoked")
+	}
+}
+
+func TestFileRevokerCompaction(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "revoked")
+	r1, err := jwthelper.NewFileRevoker(file)
+	if err != nil {
+		t.Fatalf("NewFileRevoker() error: %v", err)
+	}
+
+	// lines returns the number of lines in the file.
+	lines := func() int {
+		buf, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("ReadFile() error: %v", err)
+		}
+		return bytes.Count(buf, []byte("\n"))
+	}
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if err = r1.RevokeJTI(fmt.Sprintf("expired-%d", i), now.Add(-time.Second)); err != nil {
+			t.Fatalf("RevokeJTI() error: %v", err)
+		}
+	}
+	if err = r1.RevokeJTI("id-1", now.Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeJTI() error: %v", err)
+	}
+	if n := lines(); n != 4 {
+		t.Fatalf("lines = %v, want 4", n)
+	}
+
+	// A new instance compacts the file when it's loaded.
+	r2, err := jwthelper.NewFileRevoker(file)
+	if err != nil {
+		t.Fatalf("NewFileRevoker() error: %v", err)
+	}
+	if n := lines(); n != 1 {
+		t.Errorf("lines after compaction = %v, want 1", n)
+	}
+
+	// Both instances keep sharing entries after compaction.
+	if err = r2.RevokeJTI("id-2", now.Add(time.Hour)); err != nil {
+		t.Fatalf("RevokeJTI() error: %v", err)
+	}
+	for _, jti := range []string{"id-1", "id-2"} {
+		if ok, err := r1.Revoked(map[string]interface{}{"jti": jti}); err != nil || !ok {
+			t.Errorf("r1: Revoked(%v) = %v, %v, want true", jti, ok, err)
+		}
+	}
+	if ok, err := r2.Revoked(map[string]interface{}{"jti": "expired-0"}); err != nil || ok {
+		t.Errorf("r2: Revoked(expired-0) = %v, %v, want false", ok, err)
+	}
+}
+
+func TestRevokeKIDHeader(t *testing.T) {
+	// Single-key Signer writes "kid" only to the header.
+	s, err := jwthelper.NewSigner("RS256", []byte(rsaPrivPEM), jwthelper.KeyID("key-1"))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	r := jwthelper.NewMemoryRevoker()
+	p, err := jwthelper.NewParser("RS256", []byte(rsaPubPEM), jwthelper.ParserRevoker(r))
+	if err != nil {
+		t.Fatalf("NewParser() error: %v", err)
+	}
+
+	exp := time.Now().Add(time.Hour)
+	str, err := s.SignedString(jwthelper.NewClaim("sub", "admin"), jwthelper.TimeClaim("exp", exp))
+	if err != nil {
+		t.Fatalf("SignedString() error: %v", err)
+	}
+
+	claims, err := p.Parse(str)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if _, ok := claims["kid"]; ok {
+		t.Errorf("Parse() = %v, want no kid claim", claims)
+	}
+
+	r.RevokeKID("key-2", exp)
+	if _, err = p.Parse(str); err != nil {
+		t.Errorf("Parse() after revoking other key error: %v", err)
+	}
+	r.RevokeKID("key-1", exp)
+	if _, err = p.Parse(str); !errors.Is(err, jwthelper.ErrTokenRevoked) {
+		t.Errorf("Parse() after RevokeKID() error: %v, want %v", err, jwthelper.ErrTokenRevoked)
+	}
+}
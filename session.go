@@ -0,0 +1,256 @@
+package jwthelper
+
+import (
+	"net/http"
+	"time"
+)
+
+// SessionManager manages sessions stored in signed JWT cookies.
+// It issues the cookie on login, verifies it on each request,
+// re-issues it when it's close to expiry(sliding sessions) and clears it on logout.
+// Cookies are created by NewSecureCookie(): "__Host-jwt", Secure, HttpOnly, SameSite=Lax and Path=/ by default.
+type SessionManager struct {
+	signer        *Signer
+	parser        *Parser
+	ttl           time.Duration
+	renewBefore   time.Duration
+	maxLifetime   time.Duration
+	cookieOptions []CookieOption
+	csrf          bool
+	csrfOptions   []CookieOption
+}
+
+// SessionOption represents the option for session manager.
+// Use option helper functions to set options:
+// e.g. SessionTTL()
+type SessionOption struct {
+	f func(m *SessionManager)
+}
+
+// SessionTTL returns the option for the lifetime of sessions.
+// It's 30 minutes by default.
+func SessionTTL(ttl time.Duration) SessionOption {
+	return SessionOption{func(m *SessionManager) {
+		m.ttl = ttl
+	}}
+}
+
+// SessionRenewBefore returns the option for renewing sessions.
+// The cookie is re-issued when the token expires within given duration.
+// It's 10 minutes by default. Set it to 0 to disable sliding sessions.
+func SessionRenewBefore(d time.Duration) SessionOption {
+	return SessionOption{func(m *SessionManager) {
+		m.renewBefore = d
+	}}
+}
+
+// SessionMaxLifetime returns the option for the absolute lifetime of sessions.
+// Sliding sessions are not renewed beyond "auth_time" + d, so users must log in again after it.
+// It's 24 hours by default. Set it to 0 to disable the limit.
+func SessionMaxLifetime(d time.Duration) SessionOption {
+	return SessionOption{func(m *SessionManager) {
+		m.maxLifetime = d
+	}}
+}
+
+// SessionCookieOptions returns the option for the session cookie.
+// The cookie is created by NewSecureCookie(): options override the secure defaults.
+// Expires and MaxAge options are overridden by the token's "exp".
+func SessionCookieOptions(options ...CookieOption) SessionOption {
+	return SessionOption{func(m *SessionManager) {
+		m.cookieOptions = options
+	}}
+}
+
+// SessionCSRF returns the option to issue a CSRF token with the session.
+// A random "csrf" claim is embedded in the session token on login
+// and the companion cookie(see NewCSRFCookie()) is set with the session cookie.
+// The companion cookie is re-issued on renewal and cleared on logout.
+// Use CSRFMiddleware() after Middleware() to check it.
+//
+// options: Cookie options(optional) of the companion cookie. Path is "/" by default.
+func SessionCSRF(options ...CookieOption) SessionOption {
+	return SessionOption{func(m *SessionManager) {
+		m.csrf = true
+		m.csrfOptions = options
+	}}
+}
+
+// NewSessionManager news a SessionManager.
+//
+//     Params:
+//         signer: signer to sign session tokens.
+//         parser: parser to verify session tokens. It should use the key of the signer.
+//         options: variadic options returned by option helper functions.
+//                  e.g. SessionTTL(), SessionCookieOptions().
+func NewSessionManager(signer *Signer, parser *Parser, options ...SessionOption) *SessionManager {
+	m := &SessionManager{
+		signer:      signer,
+		parser:      parser,
+		ttl:         30 * time.Minute,
+		renewBefore: 10 * time.Minute,
+		maxLifetime: 24 * time.Hour,
+	}
+
+	for _, op := range options {
+		op.f(m)
+	}
+	return m
+}
+
+// cookieName returns the name of the session cookie.
+func (m *SessionManager) cookieName() string {
+	return m.newCookie("").Name
+}
+
+// newCookie returns the session cookie with the cookie options and extra ones appended.
+// It's safe to be called by concurrent requests.
+func (m *SessionManager) newCookie(tokenString string, extra ...CookieOption) *http.Cookie {
+	options := make([]CookieOption, 0, len(m.cookieOptions)+len(extra))
+	options = append(options, m.cookieOptions...)
+	options = append(options, extra...)
+	return NewSecureCookie(tokenString, options...)
+}
+
+// newCSRFCookie returns the companion cookie of the CSRF token with the CSRF cookie options and extra ones appended.
+func (m *SessionManager) newCSRFCookie(csrfToken string, extra ...CookieOption) *http.Cookie {
+	options := make([]CookieOption, 0, len(m.csrfOptions)+len(extra)+1)
+	options = append(options, CookiePath("/"))
+	options = append(options, m.csrfOptions...)
+	options = append(options, extra...)
+	return NewCSRFCookie(csrfToken, options...)
+}
+
+// expiry returns the expiration time of the session token issued at now.
+// It's capped by the absolute lifetime of the session which started at authTime.
+func (m *SessionManager) expiry(now, authTime time.Time) time.Time {
+	exp := now.Add(m.ttl)
+	if m.maxLifetime > 0 {
+		if limit := authTime.Add(m.maxLifetime); exp.After(limit) {
+			exp = limit
+		}
+	}
+	return time.Unix(exp.Unix(), 0)
+}
+
+// setCookie signs the claims and sets the session cookie.
+// The companion cookie is also set if csrfToken is not empty.
+// Cookie lifetime comes from the token's "exp".
+func (m *SessionManager) setCookie(w http.ResponseWriter, now, authTime, exp time.Time, csrfToken string, claims ...Claim) error {
+	c := make([]Claim, 0, len(claims)+3)
+	c = append(c, claims...)
+	c = append(c,
+		TimeClaim("iat", now),
+		TimeClaim("exp", exp),
+		TimeClaim("auth_time", authTime),
+	)
+
+	tokenString, err := m.signer.SignedString(c...)
+	if err != nil {
+		return err
+	}
+
+	lifetime := []CookieOption{
+		CookieExpires(exp),
+		CookieMaxAge(int(exp.Unix() - now.Unix())),
+	}
+	http.SetCookie(w, m.newCookie(tokenString, lifetime...))
+	if csrfToken != "" {
+		http.SetCookie(w, m.newCSRFCookie(csrfToken, lifetime...))
+	}
+	return nil
+}
+
+// Login issues a session cookie with given claims.
+// "iat", "exp" and "auth_time" claims are set by the session manager.
+// "csrf" claim and the companion cookie are also set if SessionCSRF() is used.
+func (m *SessionManager) Login(w http.ResponseWriter, claims ...Claim) error {
+	csrfToken := ""
+	if m.csrf {
+		var err error
+		if csrfToken, err = newJTI(); err != nil {
+			return err
+		}
+		c := make([]Claim, 0, len(claims)+1)
+		c = append(c, claims...)
+		claims = append(c, NewClaim(CSRFClaimName, csrfToken))
+	}
+
+	now := time.Now()
+	return m.setCookie(w, now, now, m.expiry(now, now), csrfToken, claims...)
+}
+
+// Get reads and verifies the session cookie and returns the claims.
+// It re-issues the cookie if the token is close to expiry
+// unless the absolute lifetime of the session is reached(see SessionMaxLifetime()).
+func (m *SessionManager) Get(w http.ResponseWriter, r *http.Request) (map[string]interface{}, error) {
+	cookie, err := r.Cookie(m.cookieName())
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := m.parser.Parse(cookie.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return nil, ErrExpNotFound
+	}
+
+	if m.renewBefore > 0 && time.Until(exp) < m.renewBefore {
+		// Sessions issued without "auth_time" started at "iat" at the latest.
+		authTime, ok := numericDate(claims["auth_time"])
+		if !ok {
+			if authTime, ok = numericDate(claims["iat"]); !ok {
+				authTime = exp.Add(-m.ttl)
+			}
+		}
+
+		now := time.Now()
+		if renewedExp := m.expiry(now, authTime); renewedExp.After(exp) {
+			renewed := []Claim{}
+			for k, v := range claims {
+				if k != "iat" && k != "exp" && k != "auth_time" {
+					renewed = append(renewed, NewClaim(k, v))
+				}
+			}
+			csrfToken := ""
+			if m.csrf {
+				csrfToken, _ = claims[CSRFClaimName].(string)
+			}
+			if err = m.setCookie(w, now, authTime, renewedExp, csrfToken, renewed...); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return claims, nil
+}
+
+// Logout clears the session cookie and the companion cookie of the CSRF token.
+func (m *SessionManager) Logout(w http.ResponseWriter) {
+	clear := []CookieOption{
+		CookieExpires(time.Unix(0, 0)),
+		CookieMaxAge(-1),
+	}
+	http.SetCookie(w, m.newCookie("", clear...))
+	if m.csrf {
+		http.SetCookie(w, m.newCSRFCookie("", clear...))
+	}
+}
+
+// Middleware returns a handler which verifies the session cookie
+// and stores the claims in the request context before calling next.
+// Use ClaimsFromContext() to get the claims.
+// It responds 401 if there's no valid session.
+func (m *SessionManager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := m.Get(w, r)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+	})
+}
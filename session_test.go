@@ -0,0 +1,192 @@
+package jwthelper_test
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleSessionManager() {
+	log.Printf("\n\nExample of cookie-based sessions")
+
+	s, err := jwthelper.NewSigner("RS256", []byte(rsaPrivPEM))
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+
+	p, err := jwthelper.NewParser("RS256", []byte(rsaPubPEM))
+	if err != nil {
+		log.Printf("NewParser() error: %v", err)
+		return
+	}
+
+	m := jwthelper.NewSessionManager(
+		s,
+		p,
+		jwthelper.SessionTTL(time.Hour),
+		jwthelper.SessionCookieOptions(jwthelper.CookieName("session")),
+	)
+
+	// Issue the session cookie on login.
+	w := httptest.NewRecorder()
+	if err = m.Login(w, jwthelper.NewClaim("username", "admin")); err != nil {
+		log.Printf("Login() error: %v", err)
+		return
+	}
+	cookie := w.Result().Cookies()[0]
+	fmt.Println(cookie.Name, cookie.MaxAge)
+
+	// Verify the session cookie on each request.
+	hello := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := jwthelper.ClaimsFromContext(r.Context())
+		fmt.Fprintf(w, "hello, %v!", claims["username"])
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	hello.ServeHTTP(w, r)
+	fmt.Println(w.Body.String())
+
+	// Clear the session cookie on logout.
+	w = httptest.NewRecorder()
+	m.Logout(w)
+	cookie = w.Result().Cookies()[0]
+	fmt.Println(cookie.Name, cookie.MaxAge)
+
+	// Output:
+	// session 3600
+	// hello, admin!
+	// session -1
+}
+
+func TestSessionManagerCookie(t *testing.T) {
+	s, err := jwthelper.NewSigner("RS256", []byte(rsaPrivPEM))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	p, err := jwthelper.NewParser("RS256", []byte(rsaPubPEM))
+	if err != nil {
+		t.Fatalf("NewParser() error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		options  []jwthelper.CookieOption
+		cookie   string
+		secure   bool
+		httpOnly bool
+		sameSite http.SameSite
+	}{
+		{"secure defaults", nil, "__Host-jwt", true, true, http.SameSiteLaxMode},
+		{"overridden", []jwthelper.CookieOption{jwthelper.CookieName("session"), jwthelper.CookieSecure(false), jwthelper.CookieSameSite(http.SameSiteStrictMode)}, "session", false, true, http.SameSiteStrictMode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := jwthelper.NewSessionManager(s, p, jwthelper.SessionCookieOptions(tt.options...))
+
+			w := httptest.NewRecorder()
+			if err := m.Login(w, jwthelper.NewClaim("username", "admin")); err != nil {
+				t.Fatalf("Login() error: %v", err)
+			}
+			w2 := httptest.NewRecorder()
+			m.Logout(w2)
+
+			for _, c := range []*http.Cookie{w.Result().Cookies()[0], w2.Result().Cookies()[0]} {
+				if c.Name != tt.cookie || c.Secure != tt.secure || c.HttpOnly != tt.httpOnly || c.SameSite != tt.sameSite || c.Path != "/" {
+					t.Errorf("cookie = %v, want name %v, Secure %v, HttpOnly %v, SameSite %v and Path /", c, tt.cookie, tt.secure, tt.httpOnly, tt.sameSite)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionManagerRenew(t *testing.T) {
+	s, err := jwthelper.NewSigner("RS256", []byte(rsaPrivPEM))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	p, err := jwthelper.NewParser("RS256", []byte(rsaPubPEM))
+	if err != nil {
+		t.Fatalf("NewParser() error: %v", err)
+	}
+	m := jwthelper.NewSessionManager(s, p, jwthelper.SessionTTL(30*time.Minute), jwthelper.SessionMaxLifetime(24*time.Hour))
+
+	now := time.Now()
+	tests := []struct {
+		name     string
+		authTime time.Time
+		exp      time.Time
+		// renewed is the expected "exp" of the renewed token, or zero if it's not renewed.
+		renewed time.Time
+	}{
+		{"far from expiry", now.Add(-time.Minute), now.Add(29 * time.Minute), time.Time{}},
+		{"near expiry", now.Add(-time.Hour), now.Add(time.Minute), now.Add(30 * time.Minute)},
+		{"capped by max lifetime", now.Add(-24*time.Hour + 5*time.Minute), now.Add(time.Minute), now.Add(5 * time.Minute)},
+		{"max lifetime reached", now.Add(-24*time.Hour + time.Minute), now.Add(time.Minute), time.Time{}},
+		{"no auth_time", time.Time{}, now.Add(time.Minute), now.Add(30 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := []jwthelper.Claim{
+				jwthelper.NewClaim("username", "admin"),
+				jwthelper.TimeClaim("iat", tt.exp.Add(-30*time.Minute)),
+				jwthelper.TimeClaim("exp", tt.exp),
+			}
+			if !tt.authTime.IsZero() {
+				claims = append(claims, jwthelper.TimeClaim("auth_time", tt.authTime))
+			}
+			tokenString, err := s.SignedString(claims...)
+			if err != nil {
+				t.Fatalf("SignedString() error: %v", err)
+			}
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.AddCookie(jwthelper.NewSecureCookie(tokenString))
+			w := httptest.NewRecorder()
+			if _, err = m.Get(w, r); err != nil {
+				t.Fatalf("Get() error: %v", err)
+			}
+
+			cookies := w.Result().Cookies()
+			if tt.renewed.IsZero() {
+				if len(cookies) != 0 {
+					t.Errorf("Get() set cookie %v, want no cookie", cookies[0])
+				}
+				return
+			}
+			if len(cookies) != 1 {
+				t.Fatalf("Get() set %v cookies, want 1", len(cookies))
+			}
+
+			renewed, err := p.Parse(cookies[0].Value)
+			if err != nil {
+				t.Fatalf("Parse() of renewed token error: %v", err)
+			}
+			exp, _ := jwthelper.Claims(renewed).Time("exp")
+			if d := exp.Sub(tt.renewed); d < -2*time.Second || d > 2*time.Second {
+				t.Errorf("renewed exp = %v, want %v", exp, tt.renewed)
+			}
+			if renewed["username"] != "admin" {
+				t.Errorf("renewed claims = %v, want username admin", renewed)
+			}
+			if authTime, _ := jwthelper.Claims(renewed).Time("auth_time"); !tt.authTime.IsZero() && authTime.Unix() != tt.authTime.Unix() {
+				t.Errorf("renewed auth_time = %v, want %v", authTime, tt.authTime)
+			}
+			if !cookies[0].Expires.Equal(exp) {
+				t.Errorf("Expires = %v, want %v", cookies[0].Expires, exp)
+			}
+			if d := time.Duration(cookies[0].MaxAge)*time.Second - time.Until(exp); d < -2*time.Second || d > 2*time.Second {
+				t.Errorf("MaxAge = %v, want %v", cookies[0].MaxAge, int(time.Until(exp)/time.Second))
+			}
+		})
+	}
+}
@@ -1,17 +1,17 @@
 package jwthelper
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/northbright/jwthelper/internal/jose"
 )
 
 // Signer is used to sign JWT tokens.
-// It stores signing method and key internally.
+// It stores the signing key bound to the alg internally.
 type Signer struct {
-	method jwt.SigningMethod
-	key    interface{}
+	key *Key
 }
 
 var (
@@ -27,27 +27,16 @@ var (
 //
 // m: signing method.
 // key: signing key.
-// use random bytes as key for jwt.SigningMethodHMAC.
-// use PEM string as key for jwt.SigningMethodRSA, jwt.SigningMethodRSAPSS and jwt.SigningMethodECDSA.
-func newSigner(m jwt.SigningMethod, key []byte) (*Signer, error) {
-	var err error
-	s := &Signer{method: m}
-
-	switch m.(type) {
-	case *jwt.SigningMethodHMAC:
-		s.key = key
-	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
-		if s.key, err = jwt.ParseRSAPrivateKeyFromPEM(key); err != nil {
-			return nil, err
-		}
-	case *jwt.SigningMethodECDSA:
-		if s.key, err = jwt.ParseECPrivateKeyFromPEM(key); err != nil {
-			return nil, err
-		}
-	default:
-		return nil, ErrInvalidSigningMethod
+// use random bytes as key for jose.HMAC.
+// use PEM string as key for jose.RSA, jose.RSAPSS, jose.ECDSA and jose.EdDSA.
+// options: variadic options returned by option helper functions.
+// e.g. KeyID(), KeyInsecure()
+func newSigner(m jose.Algorithm, key []byte, options ...KeyOption) (*Signer, error) {
+	k, err := newKey(m, key, true, options...)
+	if err != nil {
+		return nil, err
 	}
-	return s, nil
+	return &Signer{key: k}, nil
 }
 
 // NewSigner creates a signer with given "alg"(RFC7518) and signing key.
@@ -58,36 +47,58 @@ func newSigner(m jwt.SigningMethod, key []byte) (*Signer, error) {
 // key:
 // use random bytes as key for "HS256", "HS384", "HS512".
 // use private PEM string as key for "RS256", "RS384", "RS512", "ES256", "ES384", "ES512",
-// "PS256", "PS384", "PS512".
-func NewSigner(alg string, key []byte) (*Signer, error) {
-	m := jwt.GetSigningMethod(alg)
-	if m == nil {
+// "PS256", "PS384", "PS512", "EdDSA"(Ed25519).
+// options: variadic options returned by option helper functions.
+// e.g. KeyID("key-1")
+// comments:
+// HMAC secrets shorter than the hash size and RSA keys under 2048 bits are refused
+// unless KeyInsecure(true) is passed.
+func NewSigner(alg string, key []byte, options ...KeyOption) (*Signer, error) {
+	m, ok := jose.Lookup(alg)
+	if !ok {
 		return nil, ErrInvalidAlg
 	}
-	return newSigner(m, key)
+	return newSigner(m, key, options...)
 }
 
 // newSignerFromFile creates a signer with given signing method and signing key file.
-func newSignerFromFile(m jwt.SigningMethod, f string) (*Signer, error) {
+func newSignerFromFile(m jose.Algorithm, f string, options ...KeyOption) (*Signer, error) {
 	key, err := ioutil.ReadFile(f)
 	if err != nil {
 		return nil, err
 	}
-	return newSigner(m, key)
+	return newSigner(m, key, options...)
 }
 
 // NewSignerFromFile creates a signer with given "alg"(RFC7518) and signing key file.
-func NewSignerFromFile(alg string, f string) (*Signer, error) {
-	m := jwt.GetSigningMethod(alg)
-	if m == nil {
+func NewSignerFromFile(alg string, f string, options ...KeyOption) (*Signer, error) {
+	m, ok := jose.Lookup(alg)
+	if !ok {
 		return nil, ErrInvalidAlg
 	}
-	return newSignerFromFile(m, f)
+	return newSignerFromFile(m, f, options...)
+}
+
+// NewSignerFromKey creates a signer with given signing key.
+// The key must be created by NewSigningKey().
+func NewSignerFromKey(k *Key) (*Signer, error) {
+	if k == nil {
+		return nil, ErrInvalidSigner
+	}
+	if !k.private {
+		return nil, ErrPublicKey
+	}
+	return &Signer{key: k}, nil
+}
+
+// Key returns the signing key.
+func (s *Signer) Key() *Key {
+	return s.key
 }
 
 // Valid validates a signer.
 func (s *Signer) Valid() bool {
-	if s.method == nil || s.key == nil {
+	if s.key == nil {
 		return false
 	}
 	return true
@@ -110,6 +121,42 @@ func (s *Signer) SignedString(claims ...Claim) (string, error) {
 		claim.f(&myClaims)
 	}
 
-	token := jwt.NewWithClaims(s.method, myClaims.claims)
-	return token.SignedString(s.key)
+	header := map[string]interface{}{
+		"typ": "JWT",
+	}
+	for k, v := range myClaims.header {
+		header[k] = v
+	}
+	s.setKeyHeader(header)
+
+	return s.sign(header, myClaims.claims)
+}
+
+// sign returns the JWS compact serialization of the header and claims.
+func (s *Signer) sign(header, claims map[string]interface{}) (string, error) {
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := jose.SigningInput(jose.EncodeSegment(h), jose.EncodeSegment(c))
+	sig, err := s.key.method.Sign(input, s.key.key)
+	if err != nil {
+		return "", err
+	}
+	return input + "." + jose.EncodeSegment(sig), nil
+}
+
+// setKeyHeader sets "alg" and "kid" header parameters of the signing key.
+// They can not be overridden by NewHeader().
+func (s *Signer) setKeyHeader(header map[string]interface{}) {
+	header["alg"] = s.key.Alg()
+	if s.key.kid != "" {
+		header["kid"] = s.key.kid
+	}
 }
@@ -0,0 +1,329 @@
+package jwthelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Browsers can't set "Authorization" header on WebSocket upgrades or EventSource requests.
+// The token is sent in "Sec-WebSocket-Protocol" header or as a short-lived ticket in the query string.
+const (
+	// WebSocketTokenProtocol is the subprotocol followed by the token in "Sec-WebSocket-Protocol" header.
+	// e.g. new WebSocket(url, ["bearer", token]) in browsers.
+	// The server must select it(not the token) as the subprotocol of the connection.
+	WebSocketTokenProtocol = "bearer"
+	// StreamTicketType is "typ" header parameter of stream tickets.
+	StreamTicketType = "ticket+jwt"
+	// ticketClaim stores the time and ID claims of the original token in stream tickets.
+	ticketClaim = "tkt"
+)
+
+// StreamAuthenticator authenticates long-lived connections: WebSocket and Server-Sent Events(SSE).
+// It's safe for concurrent use.
+type StreamAuthenticator struct {
+	parser        TokenParser
+	ticketParser  TokenParser
+	ticketParam   string
+	seen          SeenStore
+	revoker       Revoker
+	checkInterval time.Duration
+}
+
+// StreamOption represents the option for authenticating streams.
+// Use option helper functions to set options:
+// e.g. StreamTickets(), StreamRevoker()
+type StreamOption struct {
+	f func(a *StreamAuthenticator)
+}
+
+// StreamTickets returns the option to accept stream tickets in the query string.
+// Tickets are not accepted by default.
+//
+// p: parser of the tickets. It verifies tickets signed by Signer.SignedStreamTicket().
+// param: name of the query parameter. e.g. "ticket".
+func StreamTickets(p TokenParser, param string) StreamOption {
+	return StreamOption{func(a *StreamAuthenticator) {
+		a.ticketParser = p
+		a.ticketParam = param
+	}}
+}
+
+// StreamTicketReplayStore returns the option for the seen store of tickets.
+// A MemorySeenStore is used by default. Use a shared store for multiple instances.
+func StreamTicketReplayStore(store SeenStore) StreamOption {
+	return StreamOption{func(a *StreamAuthenticator) {
+		a.seen = store
+	}}
+}
+
+// StreamRevoker returns the option for the revoker which is checked periodically after the connection is established.
+// Revocation is not checked by default.
+func StreamRevoker(r Revoker) StreamOption {
+	return StreamOption{func(a *StreamAuthenticator) {
+		a.revoker = r
+	}}
+}
+
+// StreamCheckInterval returns the option for the interval of checking revocation.
+// It's 30 seconds by default. The default is kept if d <= 0.
+func StreamCheckInterval(d time.Duration) StreamOption {
+	return StreamOption{func(a *StreamAuthenticator) {
+		if d > 0 {
+			a.checkInterval = d
+		}
+	}}
+}
+
+// NewStreamAuthenticator creates a stream authenticator.
+//
+// p: parser of the tokens. e.g. Parser, MultipleKeysParser, JWKSParser.
+// options: variadic options returned by option helper functions.
+// e.g. StreamTickets(ticketParser, "ticket"), StreamRevoker(revoker)
+func NewStreamAuthenticator(p TokenParser, options ...StreamOption) *StreamAuthenticator {
+	a := &StreamAuthenticator{
+		parser:        p,
+		checkInterval: 30 * time.Second,
+	}
+	for _, op := range options {
+		op.f(a)
+	}
+	if a.ticketParser != nil && a.seen == nil {
+		a.seen = NewMemorySeenStore()
+	}
+	return a
+}
+
+// SignedStreamTicket returns the signed string of a single-use stream ticket.
+//
+// claims: verified claims of the token which authenticated the request for the ticket.
+// Add "kid" header parameter of the token as "kid" claim to revoke the connection by the signing key.
+// ttl: lifetime of the ticket. It should be short. e.g. 30 seconds.
+// comments:
+// The ticket carries the claims of the token.
+// "exp" of the ticket is now + ttl while the connection is bound to "exp" of the token.
+// Get the ticket with bearer authentication and pass it to new WebSocket() or new EventSource() in the query string.
+func (s *Signer) SignedStreamTicket(claims map[string]interface{}, ttl time.Duration) (string, error) {
+	tkt := map[string]interface{}{}
+	c := []Claim{NewHeader("typ", StreamTicketType)}
+	for k, v := range claims {
+		switch k {
+		case "exp", "nbf", "iat", "jti":
+			tkt[k] = v
+		default:
+			c = append(c, NewClaim(k, v))
+		}
+	}
+	c = append(c, NewClaim(ticketClaim, tkt))
+	return s.SignedSingleUseString(ttl, c...)
+}
+
+// WebSocketToken returns the token following WebSocketTokenProtocol in "Sec-WebSocket-Protocol" header.
+// It returns ErrNoBearerToken if there's no token.
+func WebSocketToken(r *http.Request) (string, error) {
+	protocols := []string{}
+	for _, v := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(v, ",") {
+			protocols = append(protocols, strings.TrimSpace(p))
+		}
+	}
+
+	for i, p := range protocols {
+		if p == WebSocketTokenProtocol && i+1 < len(protocols) && protocols[i+1] != "" {
+			return protocols[i+1], nil
+		}
+	}
+	return "", ErrNoBearerToken
+}
+
+// WebSocketProtocol returns the subprotocol which the server must select for the WebSocket upgrade.
+// It returns WebSocketTokenProtocol if the token is sent in "Sec-WebSocket-Protocol" header, otherwise "".
+//
+// comments:
+// Browsers fail the handshake if the server doesn't select one of the requested subprotocols.
+// Set the returned subprotocol in "Sec-WebSocket-Protocol" header of the upgrade response if it's not empty.
+// e.g. gorilla/websocket: upgrader.Upgrade(w, r, http.Header{"Sec-WebSocket-Protocol": {p}})
+func WebSocketProtocol(r *http.Request) string {
+	if _, err := WebSocketToken(r); err != nil {
+		return ""
+	}
+	return WebSocketTokenProtocol
+}
+
+// parseTicket verifies the ticket and returns the claims of the original token.
+func (a *StreamAuthenticator) parseTicket(ticket string) (map[string]interface{}, error) {
+	claims, err := a.ticketParser.Parse(ticket)
+	if err != nil {
+		return nil, err
+	}
+	header, err := ParseHeader(ticket)
+	if err != nil {
+		return nil, err
+	}
+	if typ, _ := header["typ"].(string); typ != StreamTicketType {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTokenType, typ)
+	}
+	tkt, ok := claims[ticketClaim].(map[string]interface{})
+	if !ok {
+		return nil, claimError(ErrClaimNotFound, ticketClaim)
+	}
+	if err = checkReplay(a.seen, claims); err != nil {
+		return nil, err
+	}
+
+	for _, k := range []string{"exp", "nbf", "iat", "jti"} {
+		delete(claims, k)
+		if v, ok := tkt[k]; ok {
+			claims[k] = v
+		}
+	}
+	delete(claims, ticketClaim)
+
+	// The original token may expire or be revoked after the ticket is signed.
+	if exp, err := Claims(claims).Time("exp"); err == nil && !time.Now().Before(exp) {
+		return nil, &TokenExpiredError{Expiry: exp}
+	}
+	if a.revoker != nil {
+		revoked, err := a.revoker.Revoked(claims)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return claims, nil
+}
+
+// parseToken verifies the token from "Authorization" or "Sec-WebSocket-Protocol" header.
+// It returns the claims and the claims for the revoker with "kid" header parameter.
+func (a *StreamAuthenticator) parseToken(token string) (map[string]interface{}, map[string]interface{}, error) {
+	claims, err := a.parser.Parse(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Tickets can only be used in the query string and refresh tokens can't be used at all.
+	if err = CheckBearerToken(token, claims); err != nil {
+		return nil, nil, err
+	}
+	header, err := ParseHeader(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	return claims, revocationClaims(header, claims), nil
+}
+
+// Authenticate verifies the token of the request and returns the claims.
+//
+// comments:
+// The token is read from the ticket query parameter(if StreamTickets() is set),
+// "Authorization: Bearer" header or "Sec-WebSocket-Protocol" header in order.
+// For tickets, the claims of the original token are returned.
+// It returns ErrNoBearerToken if there's no token.
+// Errors of the parsers are returned as is.
+func (a *StreamAuthenticator) Authenticate(r *http.Request) (map[string]interface{}, error) {
+	claims, _, err := a.authenticate(r)
+	return claims, err
+}
+
+// authenticate verifies the token of the request and returns the claims and the claims for the revoker.
+func (a *StreamAuthenticator) authenticate(r *http.Request) (map[string]interface{}, map[string]interface{}, error) {
+	if a.ticketParser != nil {
+		if ticket := r.URL.Query().Get(a.ticketParam); ticket != "" {
+			claims, err := a.parseTicket(ticket)
+			return claims, claims, err
+		}
+	}
+
+	token, err := BearerToken(r)
+	if err != nil {
+		if token, err = WebSocketToken(r); err != nil {
+			return nil, nil, err
+		}
+	}
+	return a.parseToken(token)
+}
+
+// Watch returns a copy of ctx which is canceled when the token expires or is revoked.
+// The handler should close the connection when the context is done.
+// context.Cause() returns *TokenExpiredError or ErrTokenRevoked.
+//
+// ctx: context of the connection. e.g. r.Context().
+// claims: claims returned by Authenticate().
+// Add "kid" header parameter of the token as "kid" claim to check revocation by the signing key.
+// Middleware() does it.
+// comments:
+// Call the returned cancel function to stop watching when the connection is closed.
+// Revocation is checked every check interval if StreamRevoker() is set.
+// Errors of the revoker are ignored so that connections survive transient failures.
+func (a *StreamAuthenticator) Watch(ctx context.Context, claims map[string]interface{}) (context.Context, context.CancelFunc) {
+	return a.watch(ctx, claims, claims)
+}
+
+// watch watches "exp" of claims and checks revocation with the revocation claims.
+func (a *StreamAuthenticator) watch(ctx context.Context, claims, revocation map[string]interface{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	var expired <-chan time.Time
+	exp, err := Claims(claims).Time("exp")
+	if err == nil {
+		timer := time.NewTimer(time.Until(exp))
+		context.AfterFunc(ctx, func() { timer.Stop() })
+		expired = timer.C
+	}
+
+	var check <-chan time.Time
+	if a.revoker != nil {
+		ticker := time.NewTicker(a.checkInterval)
+		context.AfterFunc(ctx, ticker.Stop)
+		check = ticker.C
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-expired:
+				cancel(&TokenExpiredError{Expiry: exp})
+				return
+			case <-check:
+				if revoked, err := a.revoker.Revoked(revocation); err == nil && revoked {
+					cancel(ErrTokenRevoked)
+					return
+				}
+			}
+		}
+	}()
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// Middleware returns the middleware which authenticates the request
+// and stores the claims in the request context before calling next.
+// Use ClaimsFromContext() to get the claims.
+//
+// comments:
+// The request context is canceled when the token expires or is revoked(see Watch()).
+// SSE handlers return and WebSocket handlers close the connection when it's done.
+// WebSocket handlers must select WebSocketProtocol(r) as the subprotocol when they upgrade the connection.
+// It responds 401 with "WWW-Authenticate" header(RFC 6750) if the token is missing or invalid.
+func (a *StreamAuthenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, revocation, err := a.authenticate(r)
+		if err != nil {
+			code := "invalid_token"
+			if errors.Is(err, ErrNoBearerToken) {
+				code = ""
+			}
+			bearerError(w, http.StatusUnauthorized, code, "")
+			return
+		}
+
+		ctx, cancel := a.watch(NewContext(r.Context(), claims), claims, revocation)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,295 @@
+package jwthelper_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleStreamAuthenticator_Middleware() {
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-1"))
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+	p, err := jwthelper.NewJWKSParser([]byte(testJWKS))
+	if err != nil {
+		log.Printf("NewJWKSParser() error: %v", err)
+		return
+	}
+
+	// Revoke the session while the SSE stream is open.
+	r := jwthelper.NewMemoryRevoker()
+	a := jwthelper.NewStreamAuthenticator(p,
+		jwthelper.StreamTickets(p, "ticket"),
+		jwthelper.StreamRevoker(r),
+		jwthelper.StreamCheckInterval(10*time.Millisecond),
+	)
+
+	// SSE handler sends events until the token expires or is revoked.
+	events := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := jwthelper.ClaimsFromContext(r.Context())
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "data: hello, %v\n\n", claims["sub"])
+
+		<-r.Context().Done()
+		fmt.Fprintf(w, "event: close\ndata: %v\n\n", context.Cause(r.Context()))
+	}))
+
+	// The client gets a ticket with its access token(e.g. by a POST request with "Authorization" header).
+	exp := time.Now().Add(time.Hour)
+	token, err := s.SignedString(
+		jwthelper.NewClaim("sub", "frank"),
+		jwthelper.NewClaim("jti", "session-1"),
+		jwthelper.TimeClaim("exp", exp),
+	)
+	if err != nil {
+		log.Printf("SignedString() error: %v", err)
+		return
+	}
+	claims, err := p.Parse(token)
+	if err != nil {
+		log.Printf("Parse() error: %v", err)
+		return
+	}
+	ticket, err := s.SignedStreamTicket(claims, 30*time.Second)
+	if err != nil {
+		log.Printf("SignedStreamTicket() error: %v", err)
+		return
+	}
+
+	// new EventSource("/events?ticket=...") in browsers.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		r.RevokeJTI("session-1", exp)
+	}()
+	w := httptest.NewRecorder()
+	events.ServeHTTP(w, httptest.NewRequest("GET", "/events?ticket="+url.QueryEscape(ticket), nil))
+	fmt.Print(w.Body.String())
+
+	// Output:
+	// data: hello, frank
+	//
+	// event: close
+	// data: token is revoked
+}
+
+func TestStreamAuthenticator(t *testing.T) {
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-1"))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	p, err := jwthelper.NewJWKSParser([]byte(testJWKS))
+	if err != nil {
+		t.Fatalf("NewJWKSParser() error: %v", err)
+	}
+	r := jwthelper.NewMemoryRevoker()
+	a := jwthelper.NewStreamAuthenticator(p, jwthelper.StreamTickets(p, "ticket"), jwthelper.StreamRevoker(r))
+
+	now := time.Now()
+	sign := func(claims ...jwthelper.Claim) string {
+		str, err := s.SignedString(append([]jwthelper.Claim{jwthelper.NewClaim("sub", "frank")}, claims...)...)
+		if err != nil {
+			t.Fatalf("SignedString() error: %v", err)
+		}
+		return str
+	}
+	// ticket returns a ticket of the token's claims, which are not verified so that expired tokens can be used.
+	ticket := func(token string) string {
+		claims, err := jwthelper.ParseClaims(token)
+		if err != nil {
+			t.Fatalf("ParseClaims() error: %v", err)
+		}
+		str, err := s.SignedStreamTicket(claims, 30*time.Second)
+		if err != nil {
+			t.Fatalf("SignedStreamTicket() error: %v", err)
+		}
+		return str
+	}
+
+	token := sign(jwthelper.TimeClaim("exp", now.Add(time.Hour)), jwthelper.NewClaim("jti", "session-1"))
+	replayed := ticket(token)
+	if _, err = a.Authenticate(httptest.NewRequest("GET", "/?ticket="+replayed, nil)); err != nil {
+		t.Fatalf("Authenticate() error: %v", err)
+	}
+	revoked := sign(jwthelper.TimeClaim("exp", now.Add(time.Hour)), jwthelper.NewClaim("jti", "session-2"))
+	r.RevokeJTI("session-2", now.Add(time.Hour))
+
+	tests := []struct {
+		name   string
+		query  string
+		header map[string]string
+		err    error
+		jti    interface{}
+	}{
+		{"authorization header", "", map[string]string{"Authorization": "Bearer " + token}, nil, "session-1"},
+		{"subprotocol", "", map[string]string{"Sec-WebSocket-Protocol": "chat, bearer, " + token}, nil, "session-1"},
+		{"ticket", "ticket=" + ticket(token), nil, nil, "session-1"},
+		{"replayed ticket", "ticket=" + replayed, nil, jwthelper.ErrTokenReplayed, nil},
+		{"ticket of expired token", "ticket=" + ticket(sign(jwthelper.TimeClaim("exp", now.Add(-time.Minute)))), nil, jwthelper.ErrTokenExpired, nil},
+		{"ticket of revoked token", "ticket=" + ticket(revoked), nil, jwthelper.ErrTokenRevoked, nil},
+		{"ticket in header", "", map[string]string{"Authorization": "Bearer " + ticket(token)}, jwthelper.ErrInvalidTokenType, nil},
+		{"token as ticket", "ticket=" + token, nil, jwthelper.ErrInvalidTokenType, nil},
+		{"refresh token", "", map[string]string{"Authorization": "Bearer " + sign(jwthelper.NewHeader("typ", jwthelper.RefreshTokenType))}, jwthelper.ErrInvalidTokenType, nil},
+		{"DPoP-bound token", "", map[string]string{"Authorization": "Bearer " + sign(jwthelper.DPoPConfirmation("jkt"))}, jwthelper.ErrInvalidTokenType, nil},
+		{"no token after subprotocol", "", map[string]string{"Sec-WebSocket-Protocol": "chat, bearer"}, jwthelper.ErrNoBearerToken, nil},
+		{"no token", "", nil, jwthelper.ErrNoBearerToken, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/?"+tt.query, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			claims, err := a.Authenticate(req)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Authenticate() error: %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if claims["sub"] != "frank" || claims["jti"] != tt.jti {
+				t.Errorf("Authenticate() = %v, want sub frank and jti %v", claims, tt.jti)
+			}
+			if _, ok := claims["tkt"]; ok {
+				t.Errorf("Authenticate() = %v, want no tkt claim", claims)
+			}
+			if exp, _ := jwthelper.Claims(claims).Time("exp"); exp.Unix() != now.Add(time.Hour).Unix() {
+				t.Errorf("exp = %v, want %v", exp, now.Add(time.Hour))
+			}
+		})
+	}
+
+	// Middleware responds 401 with "WWW-Authenticate" header.
+	w := httptest.NewRecorder()
+	a.Middleware(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/?ticket="+replayed, nil))
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `Bearer error="invalid_token"` {
+		t.Errorf("Middleware() = %v %q, want 401", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestStreamAuthenticatorWatch(t *testing.T) {
+	r := jwthelper.NewMemoryRevoker()
+	a := jwthelper.NewStreamAuthenticator(nil, jwthelper.StreamRevoker(r), jwthelper.StreamCheckInterval(10*time.Millisecond))
+
+	// wait returns the cause of the canceled context.
+	wait := func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(3 * time.Second):
+			return nil
+		}
+	}
+
+	// Expiry.
+	exp := time.Now().Add(time.Second)
+	ctx, cancel := a.Watch(context.Background(), map[string]interface{}{"exp": float64(exp.Unix())})
+	defer cancel()
+	err := wait(ctx)
+	var expired *jwthelper.TokenExpiredError
+	if !errors.As(err, &expired) || expired.Expiry.Unix() != exp.Unix() {
+		t.Errorf("cause = %v, want %v", err, jwthelper.ErrTokenExpired)
+	}
+
+	// Revocation.
+	ctx, cancel = a.Watch(context.Background(), map[string]interface{}{"jti": "session-1", "exp": float64(time.Now().Add(time.Hour).Unix())})
+	defer cancel()
+	r.RevokeJTI("session-1", time.Now().Add(time.Hour))
+	if err = wait(ctx); !errors.Is(err, jwthelper.ErrTokenRevoked) {
+		t.Errorf("cause = %v, want %v", err, jwthelper.ErrTokenRevoked)
+	}
+
+	// Cancel and parent.
+	ctx, cancel = a.Watch(context.Background(), map[string]interface{}{"jti": "session-2"})
+	cancel()
+	if err = wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("cause = %v, want %v", err, context.Canceled)
+	}
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel = a.Watch(parent, map[string]interface{}{"jti": "session-3"})
+	defer cancel()
+	cancelParent()
+	if err = wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("cause = %v, want %v", err, context.Canceled)
+	}
+
+	// Non-positive interval falls back to the default.
+	a = jwthelper.NewStreamAuthenticator(nil, jwthelper.StreamRevoker(r), jwthelper.StreamCheckInterval(0))
+	ctx, cancel = a.Watch(context.Background(), map[string]interface{}{"jti": "session-4"})
+	cancel()
+	if err = wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("cause = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestWebSocketProtocol(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []string
+		want   string
+	}{
+		{"token", []string{"chat, bearer, token"}, jwthelper.WebSocketTokenProtocol},
+		{"multiple headers", []string{"chat", "bearer", "token"}, jwthelper.WebSocketTokenProtocol},
+		{"no token after subprotocol", []string{"chat, bearer"}, ""},
+		{"other subprotocols", []string{"chat"}, ""},
+		{"no header", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			for _, v := range tt.header {
+				r.Header.Add("Sec-WebSocket-Protocol", v)
+			}
+			if got := jwthelper.WebSocketProtocol(r); got != tt.want {
+				t.Errorf("WebSocketProtocol() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamAuthenticatorRevokeKID(t *testing.T) {
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-1"))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	p, err := jwthelper.NewJWKSParser([]byte(testJWKS))
+	if err != nil {
+		t.Fatalf("NewJWKSParser() error: %v", err)
+	}
+	r := jwthelper.NewMemoryRevoker()
+	a := jwthelper.NewStreamAuthenticator(p, jwthelper.StreamRevoker(r), jwthelper.StreamCheckInterval(10*time.Millisecond))
+
+	exp := time.Now().Add(time.Hour)
+	token, err := s.SignedString(jwthelper.NewClaim("sub", "frank"), jwthelper.TimeClaim("exp", exp))
+	if err != nil {
+		t.Fatalf("SignedString() error: %v", err)
+	}
+
+	// The connection is closed when the signing key is revoked.
+	var cause error
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.RevokeKID("ec-1", exp)
+		select {
+		case <-req.Context().Done():
+			cause = context.Cause(req.Context())
+		case <-time.After(3 * time.Second):
+		}
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if !errors.Is(cause, jwthelper.ErrTokenRevoked) {
+		t.Errorf("cause = %v, want %v", cause, jwthelper.ErrTokenRevoked)
+	}
+}
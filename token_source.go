@@ -0,0 +1,249 @@
+package jwthelper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TokenSource provides tokens for outbound requests.
+type TokenSource interface {
+	// Token returns a token which is not expired.
+	Token(ctx context.Context) (string, error)
+}
+
+// invalidator is implemented by token sources which can drop a rejected token.
+type invalidator interface {
+	Invalidate(token string)
+}
+
+// CachedTokenSource caches the token until shortly before it expires.
+// Concurrent calls share one fetch when the token needs to be refreshed.
+// It's safe for concurrent use.
+type CachedTokenSource struct {
+	fetch         func(ctx context.Context) (string, time.Time, error)
+	refreshBefore time.Duration
+
+	m         sync.Mutex
+	token     string
+	refreshAt time.Time
+	call      *tokenCall
+}
+
+// tokenCall is an in-flight fetch of a token.
+type tokenCall struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// TokenSourceOption represents the option for token sources.
+// Use option helper functions to set options:
+// e.g. TokenSourceRefreshBefore()
+type TokenSourceOption struct {
+	f func(s *CachedTokenSource)
+}
+
+// TokenSourceRefreshBefore returns the option for the time to refresh the token before it expires.
+// It's 1 minute by default.
+// It's capped to half of the lifetime of the token so that short-lived tokens are still cached.
+func TokenSourceRefreshBefore(d time.Duration) TokenSourceOption {
+	return TokenSourceOption{func(s *CachedTokenSource) {
+		s.refreshBefore = d
+	}}
+}
+
+// NewCachedTokenSource creates a token source which caches the tokens returned by fetch.
+//
+// fetch: function to fetch a new token and its expiry. e.g. requesting the token endpoint.
+// If the returned expiry is zero, it's read from the "exp" claim of the token(not verified).
+// The context passed to fetch is not canceled when the caller gives up,
+// because other callers may wait for the same fetch.
+// options: variadic options returned by option helper functions.
+// e.g. TokenSourceRefreshBefore(30 * time.Second)
+func NewCachedTokenSource(fetch func(ctx context.Context) (string, time.Time, error), options ...TokenSourceOption) *CachedTokenSource {
+	s := &CachedTokenSource{
+		fetch:         fetch,
+		refreshBefore: time.Minute,
+	}
+	for _, op := range options {
+		op.f(s)
+	}
+	return s
+}
+
+// NewSignerTokenSource creates a token source of self-signed tokens.
+//
+// s: signer of the tokens.
+// ttl: lifetime of each token.
+// claims: claims of the tokens. e.g. "iss", "sub", "aud".
+// comments:
+// "iat", "exp" and a random "jti" are set for each token.
+func NewSignerTokenSource(s *Signer, ttl time.Duration, claims []Claim, options ...TokenSourceOption) *CachedTokenSource {
+	return NewCachedTokenSource(func(ctx context.Context) (string, time.Time, error) {
+		jti, err := newJTI()
+		if err != nil {
+			return "", time.Time{}, err
+		}
+
+		now := time.Now()
+		exp := now.Add(ttl)
+		c := make([]Claim, 0, len(claims)+3)
+		c = append(c, claims...)
+		c = append(c, TimeClaim("iat", now), TimeClaim("exp", exp), NewClaim("jti", jti))
+
+		token, err := s.SignedString(c...)
+		return token, exp, err
+	}, options...)
+}
+
+// Token implements TokenSource interface.
+// It returns the cached token or waits for the fetch of a new token.
+func (s *CachedTokenSource) Token(ctx context.Context) (string, error) {
+	s.m.Lock()
+	if s.token != "" && time.Now().Before(s.refreshAt) {
+		token := s.token
+		s.m.Unlock()
+		return token, nil
+	}
+
+	c := s.call
+	if c == nil {
+		c = &tokenCall{done: make(chan struct{})}
+		s.call = c
+		go s.refresh(context.WithoutCancel(ctx), c)
+	}
+	s.m.Unlock()
+
+	select {
+	case <-c.done:
+		return c.token, c.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// refresh fetches a new token and finishes the call.
+func (s *CachedTokenSource) refresh(ctx context.Context, c *tokenCall) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	token, exp, err := s.fetch(ctx)
+	if err == nil && exp.IsZero() {
+		var claims map[string]interface{}
+		if claims, err = ParseClaims(token); err == nil {
+			exp, err = Claims(claims).Time("exp")
+		}
+	}
+
+	now := time.Now()
+	if err == nil && !exp.After(now) {
+		err = fmt.Errorf("%w: fetched token expired at %v", ErrTokenExpired, exp)
+	}
+
+	s.m.Lock()
+	if err == nil {
+		before := s.refreshBefore
+		if half := exp.Sub(now) / 2; before > half {
+			before = half
+		}
+		s.token, s.refreshAt = token, exp.Add(-before)
+	}
+	s.call = nil
+	s.m.Unlock()
+
+	if err != nil {
+		token = ""
+	}
+	c.token, c.err = token, err
+	close(c.done)
+}
+
+// Invalidate drops the cached token if it's the given token.
+// The next call of Token() fetches a new token.
+// It's called when the token is rejected. e.g. 401 response.
+func (s *CachedTokenSource) Invalidate(token string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+// BearerTransport is an http.RoundTripper which sets the token of the token source
+// in "Authorization: Bearer" header of outbound requests.
+type BearerTransport struct {
+	src  TokenSource
+	base http.RoundTripper
+}
+
+// NewBearerTransport creates a bearer transport.
+//
+// src: token source. e.g. CachedTokenSource.
+// base: underlying round tripper. http.DefaultTransport is used if it's nil.
+// comments:
+// Use it as the Transport of http.Client:
+// client := &http.Client{Transport: NewBearerTransport(src, nil)}
+func NewBearerTransport(src TokenSource, base http.RoundTripper) *BearerTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &BearerTransport{src: src, base: base}
+}
+
+// withBearer returns a copy of the request with the bearer token.
+func withBearer(r *http.Request, token string) *http.Request {
+	r2 := r.Clone(r.Context())
+	r2.Header.Set("Authorization", "Bearer "+token)
+	return r2
+}
+
+// RoundTrip implements http.RoundTripper interface.
+//
+// comments:
+// The request is not modified.
+// If the response is 401, the token is invalidated and the request is sent once more with a new token.
+// The request is not retried if the token source can't invalidate the token,
+// it returns the same token or the request body can't be replayed(r.GetBody is nil).
+func (t *BearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	token, err := t.src.Token(r.Context())
+	if err != nil {
+		if r.Body != nil {
+			r.Body.Close()
+		}
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(withBearer(r, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	inv, ok := t.src.(invalidator)
+	if !ok || (r.Body != nil && r.Body != http.NoBody && r.GetBody == nil) {
+		return resp, nil
+	}
+	inv.Invalidate(token)
+
+	fresh, err := t.src.Token(r.Context())
+	if err != nil || fresh == token {
+		return resp, nil
+	}
+
+	r2 := withBearer(r, fresh)
+	if r.GetBody != nil {
+		body, err := r.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		r2.Body = body
+	}
+
+	// Drain the body of the 401 response so that the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	return t.base.RoundTrip(r2)
+}
@@ -0,0 +1,237 @@
+package jwthelper_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleNewBearerTransport() {
+	// Service A signs its own tokens to call service B.
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-1"))
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+	src := jwthelper.NewSignerTokenSource(s, 5*time.Minute, []jwthelper.Claim{
+		jwthelper.NewClaim("iss", "svc-a"),
+		jwthelper.NewClaim("sub", "svc-a"),
+		jwthelper.NewClaim("aud", "svc-b"),
+	})
+
+	// Service B.
+	p, err := jwthelper.NewJWKSParser([]byte(testJWKS))
+	if err != nil {
+		log.Printf("NewJWKSParser() error: %v", err)
+		return
+	}
+	ts := httptest.NewServer(jwthelper.BearerMiddleware(p)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := jwthelper.ClaimsFromContext(r.Context())
+		fmt.Fprintf(w, "hello, %v", claims["sub"])
+	})))
+	defer ts.Close()
+
+	client := &http.Client{Transport: jwthelper.NewBearerTransport(src, nil)}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		log.Printf("Get() error: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	fmt.Println(resp.StatusCode, string(body))
+
+	// Output:
+	// 200 hello, svc-a
+}
+
+// countingFetch returns a fetch function which returns "token-N" expiring after ttl.
+func countingFetch(n *int32, ttl time.Duration) func(ctx context.Context) (string, time.Time, error) {
+	return func(ctx context.Context) (string, time.Time, error) {
+		i := atomic.AddInt32(n, 1)
+		// Make concurrent callers wait for the same fetch.
+		time.Sleep(10 * time.Millisecond)
+		return fmt.Sprintf("token-%d", i), time.Now().Add(ttl), nil
+	}
+}
+
+func TestCachedTokenSource(t *testing.T) {
+	ctx := context.Background()
+
+	// Concurrent calls share one fetch.
+	var n int32
+	src := jwthelper.NewCachedTokenSource(countingFetch(&n, time.Hour))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := src.Token(ctx); err != nil || token != "token-1" {
+				t.Errorf("Token() = %v, %v, want token-1", token, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n != 1 {
+		t.Errorf("fetch count = %v, want 1", n)
+	}
+
+	// Cached token is returned until it's invalidated.
+	if token, _ := src.Token(ctx); token != "token-1" {
+		t.Errorf("Token() = %v, want token-1", token)
+	}
+	src.Invalidate("token-0")
+	if token, _ := src.Token(ctx); token != "token-1" {
+		t.Errorf("Token() after invalidating other token = %v, want token-1", token)
+	}
+	src.Invalidate("token-1")
+	if token, _ := src.Token(ctx); token != "token-2" {
+		t.Errorf("Token() after Invalidate() = %v, want token-2", token)
+	}
+
+	// Token is refreshed before it expires.
+	n = 0
+	src = jwthelper.NewCachedTokenSource(countingFetch(&n, 300*time.Millisecond), jwthelper.TokenSourceRefreshBefore(100*time.Millisecond))
+	src.Token(ctx)
+	time.Sleep(250 * time.Millisecond)
+	if token, _ := src.Token(ctx); token != "token-2" {
+		t.Errorf("Token() near expiry = %v, want token-2", token)
+	}
+
+	// Refresh before is capped to half of the lifetime.
+	n = 0
+	src = jwthelper.NewCachedTokenSource(countingFetch(&n, 2*time.Second), jwthelper.TokenSourceRefreshBefore(time.Hour))
+	src.Token(ctx)
+	if token, _ := src.Token(ctx); token != "token-1" {
+		t.Errorf("Token() of short-lived token = %v, want token-1", token)
+	}
+
+	// Expiry is read from "exp" claim.
+	s, err := jwthelper.NewSigner("ES256", es256PrivPEM, jwthelper.KeyID("ec-1"))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+	sign := func(exp time.Time) func(ctx context.Context) (string, time.Time, error) {
+		return func(ctx context.Context) (string, time.Time, error) {
+			token, err := s.SignedString(jwthelper.TimeClaim("exp", exp))
+			return token, time.Time{}, err
+		}
+	}
+	if _, err = jwthelper.NewCachedTokenSource(sign(time.Now().Add(time.Hour))).Token(ctx); err != nil {
+		t.Errorf("Token() with exp claim error: %v", err)
+	}
+	if _, err = jwthelper.NewCachedTokenSource(sign(time.Now().Add(-time.Hour))).Token(ctx); !errors.Is(err, jwthelper.ErrTokenExpired) {
+		t.Errorf("Token() of expired token error: %v, want %v", err, jwthelper.ErrTokenExpired)
+	}
+
+	// Errors are not cached.
+	fail := true
+	src = jwthelper.NewCachedTokenSource(func(ctx context.Context) (string, time.Time, error) {
+		if fail {
+			return "", time.Time{}, io.ErrUnexpectedEOF
+		}
+		return "token", time.Now().Add(time.Hour), nil
+	})
+	if _, err = src.Token(ctx); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Token() error: %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	fail = false
+	if token, err := src.Token(ctx); err != nil || token != "token" {
+		t.Errorf("Token() after error = %v, %v, want token", token, err)
+	}
+
+	// Caller gives up without canceling the fetch.
+	n = 0
+	src = jwthelper.NewCachedTokenSource(countingFetch(&n, time.Hour))
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = src.Token(canceled); !errors.Is(err, context.Canceled) {
+		t.Errorf("Token() with canceled context error: %v, want %v", err, context.Canceled)
+	}
+	if token, _ := src.Token(ctx); token != "token-1" {
+		t.Errorf("Token() after cancel = %v, want token-1", token)
+	}
+}
+
+// staticTokenSource always returns the same token.
+type staticTokenSource string
+
+func (s staticTokenSource) Token(ctx context.Context) (string, error) {
+	return string(s), nil
+}
+
+func TestBearerTransport(t *testing.T) {
+	// Server rejects "token-1" and echoes the body.
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		token, err := jwthelper.BearerToken(r)
+		if err != nil || token == "token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%v %s", token, body)
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		src      jwthelper.TokenSource
+		body     io.Reader
+		status   int
+		want     string
+		requests int32
+	}{
+		{"retry", nil, nil, http.StatusOK, "token-2 ", 2},
+		{"retry with body", nil, strings.NewReader("hello"), http.StatusOK, "token-2 hello", 2},
+		{"body can't be replayed", nil, io.MultiReader(strings.NewReader("hello")), http.StatusUnauthorized, "", 1},
+		{"no invalidator", staticTokenSource("token-1"), nil, http.StatusUnauthorized, "", 1},
+		{"accepted", staticTokenSource("token-3"), nil, http.StatusOK, "token-3 ", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := tt.src
+			if src == nil {
+				var n int32
+				src = jwthelper.NewCachedTokenSource(countingFetch(&n, time.Hour))
+			}
+			client := &http.Client{Transport: jwthelper.NewBearerTransport(src, nil)}
+
+			r, err := http.NewRequest("POST", ts.URL, tt.body)
+			if err != nil {
+				t.Fatalf("NewRequest() error: %v", err)
+			}
+			atomic.StoreInt32(&requests, 0)
+			resp, err := client.Do(r)
+			if err != nil {
+				t.Fatalf("Do() error: %v", err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status || (tt.want != "" && string(body) != tt.want) {
+				t.Errorf("response = %v %q, want %v %q", resp.StatusCode, body, tt.status, tt.want)
+			}
+			if requests != tt.requests {
+				t.Errorf("requests = %v, want %v", requests, tt.requests)
+			}
+			if r.Header.Get("Authorization") != "" {
+				t.Errorf("request is modified")
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package jwthelper
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Claims provides typed accessors on the claims map returned by Parser.Parse().
+// e.g. jwthelper.Claims(m).String("sub")
+// Numbers may be json.Number or float64 depending on ParserUseJSONNumber option.
+// Both are handled.
+type Claims map[string]interface{}
+
+var (
+	// ErrClaimNotFound represents the error of missing claim.
+	ErrClaimNotFound = fmt.Errorf("claim not found")
+	// ErrClaimType represents the error of claim with unexpected type.
+	ErrClaimType = fmt.Errorf("invalid claim type")
+)
+
+// claimError wraps the error with the claim name.
+// Use errors.Is() to check ErrClaimNotFound and ErrClaimType.
+func claimError(err error, name string) error {
+	return fmt.Errorf("%w: %s", err, name)
+}
+
+// Has returns true if the claim exists.
+func (c Claims) Has(name string) bool {
+	_, ok := c[name]
+	return ok
+}
+
+// get returns the claim value or ErrClaimNotFound.
+func (c Claims) get(name string) (interface{}, error) {
+	v, ok := c[name]
+	if !ok {
+		return nil, claimError(ErrClaimNotFound, name)
+	}
+	return v, nil
+}
+
+// String returns the string claim.
+func (c Claims) String(name string) (string, error) {
+	v, err := c.get(name)
+	if err != nil {
+		return "", err
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return "", claimError(ErrClaimType, name)
+	}
+	return s, nil
+}
+
+// Bool returns the boolean claim.
+func (c Claims) Bool(name string) (bool, error) {
+	v, err := c.get(name)
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		return false, claimError(ErrClaimType, name)
+	}
+	return b, nil
+}
+
+// Float64 returns the number claim as float64.
+func (c Claims) Float64(name string) (float64, error) {
+	v, err := c.get(name)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		if err != nil {
+			return 0, claimError(ErrClaimType, name)
+		}
+		return f, nil
+	case float64:
+		return n, nil
+	default:
+		return 0, claimError(ErrClaimType, name)
+	}
+}
+
+// Int64 returns the integer claim as int64.
+// It returns ErrClaimType if the number has a fractional part or is out of range.
+// Integral numbers in exponent or decimal notation(e.g. 1e3, 100.0) are accepted
+// whether ParserUseJSONNumber is set or not.
+func (c Claims) Int64(name string) (int64, error) {
+	v, err := c.get(name)
+	if err != nil {
+		return 0, err
+	}
+
+	switch n := v.(type) {
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return 0, claimError(ErrClaimType, name)
+		}
+		i, ok := floatToInt64(f)
+		if !ok {
+			return 0, claimError(ErrClaimType, name)
+		}
+		return i, nil
+	case float64:
+		i, ok := floatToInt64(n)
+		if !ok {
+			return 0, claimError(ErrClaimType, name)
+		}
+		return i, nil
+	default:
+		return 0, claimError(ErrClaimType, name)
+	}
+}
+
+// floatToInt64 converts the integral float64 in the range of int64.
+func floatToInt64(f float64) (int64, bool) {
+	// float64(math.MaxInt64) rounds up to 2^63, so compare with 2^63 exclusively.
+	if f != math.Trunc(f) || f >= 1<<63 || f < -1<<63 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// Time returns the NumericDate claim as time.Time. e.g. "exp", "iat", "nbf".
+func (c Claims) Time(name string) (time.Time, error) {
+	v, err := c.get(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t, ok := numericDate(v)
+	if !ok {
+		return time.Time{}, claimError(ErrClaimType, name)
+	}
+	return t, nil
+}
+
+// StringSlice returns the claim which may be a single string or an array of strings.
+func (c Claims) StringSlice(name string) ([]string, error) {
+	v, err := c.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch a := v.(type) {
+	case string:
+		return []string{a}, nil
+	case []string:
+		return a, nil
+	case []interface{}:
+		s := make([]string, 0, len(a))
+		for _, e := range a {
+			str, ok := e.(string)
+			if !ok {
+				return nil, claimError(ErrClaimType, name)
+			}
+			s = append(s, str)
+		}
+		return s, nil
+	default:
+		return nil, claimError(ErrClaimType, name)
+	}
+}
+
+// Audience returns the "aud" claim which may be a single string or an array of strings.
+func (c Claims) Audience() ([]string, error) {
+	return c.StringSlice("aud")
+}
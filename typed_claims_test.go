@@ -0,0 +1,151 @@
+package jwthelper_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/northbright/jwthelper"
+)
+
+func ExampleClaims() {
+	log.Printf("\n\nExample of typed claim accessors")
+
+	s, err := jwthelper.NewSigner("RS256", []byte(rsaPrivPEM))
+	if err != nil {
+		log.Printf("NewSigner() error: %v", err)
+		return
+	}
+
+	str, err := s.SignedString(
+		jwthelper.NewClaim("sub", "admin"),
+		jwthelper.NewClaim("aud", "api"),
+		jwthelper.NewClaim("count", 100),
+		jwthelper.TimeClaim("exp", time.Unix(4102444800, 0)),
+	)
+	if err != nil {
+		log.Printf("SignedString() error: %v", err)
+		return
+	}
+
+	// Numbers are the same whether they're parsed as json.Number or float64.
+	for _, useJSONNumber := range []bool{true, false} {
+		p, err := jwthelper.NewParser("RS256", []byte(rsaPubPEM), jwthelper.ParserUseJSONNumber(useJSONNumber))
+		if err != nil {
+			log.Printf("NewParser() error: %v", err)
+			return
+		}
+
+		m, err := p.Parse(str)
+		if err != nil {
+			log.Printf("Parse() error: %v", err)
+			return
+		}
+
+		c := jwthelper.Claims(m)
+		sub, _ := c.String("sub")
+		aud, _ := c.Audience()
+		count, _ := c.Int64("count")
+		exp, _ := c.Time("exp")
+		fmt.Println(sub, aud, count, exp.UTC().Year())
+	}
+
+	// Errors distinguish a missing claim from one with the wrong type.
+	c := jwthelper.Claims{"count": "100"}
+	_, err = c.Int64("count")
+	fmt.Println(errors.Is(err, jwthelper.ErrClaimType))
+	_, err = c.Int64("uid")
+	fmt.Println(errors.Is(err, jwthelper.ErrClaimNotFound))
+
+	// Output:
+	// admin [api] 100 2100
+	// admin [api] 100 2100
+	// true
+	// true
+}
+
+func TestClaimsInt64(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want int64
+		err  error
+	}{
+		{"float64", float64(100), 100, nil},
+		{"negative float64", float64(-100), -100, nil},
+		{"min int64", float64(math.MinInt64), math.MinInt64, nil},
+		{"2^63", float64(1 << 63), 0, jwthelper.ErrClaimType},
+		{"max int64 as float64", float64(math.MaxInt64), 0, jwthelper.ErrClaimType},
+		{"below min int64", -float64(1<<63) * 2, 0, jwthelper.ErrClaimType},
+		{"fraction", 1.5, 0, jwthelper.ErrClaimType},
+		{"json.Number", json.Number("9223372036854775807"), math.MaxInt64, nil},
+		{"json.Number overflow", json.Number("9223372036854775808"), 0, jwthelper.ErrClaimType},
+		{"json.Number exponent", json.Number("1e3"), 1000, nil},
+		{"json.Number negative exponent", json.Number("-1e3"), -1000, nil},
+		{"json.Number decimal", json.Number("100.0"), 100, nil},
+		{"json.Number fraction", json.Number("1.5"), 0, jwthelper.ErrClaimType},
+		{"json.Number exponent overflow", json.Number("1e19"), 0, jwthelper.ErrClaimType},
+		{"float64 exponent", 1e3, 1000, nil},
+		{"string", "100", 0, jwthelper.ErrClaimType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := jwthelper.Claims{"n": tt.v}.Int64("n")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Int64() error: %v, want %v", err, tt.err)
+			}
+			if n != tt.want {
+				t.Errorf("Int64() = %v, want %v", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimsInt64JSONNumber(t *testing.T) {
+	s, err := jwthelper.NewSigner("RS256", []byte(rsaPrivPEM))
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		v    json.Number
+		want int64
+		err  error
+	}{
+		{"integer", "100", 100, nil},
+		{"exponent", "1e3", 1000, nil},
+		{"decimal", "100.0", 100, nil},
+		{"fraction", "1.5", 0, jwthelper.ErrClaimType},
+	}
+
+	// The result doesn't depend on the number representation of the parser.
+	for _, useJSONNumber := range []bool{false, true} {
+		p, err := jwthelper.NewParser("RS256", []byte(rsaPubPEM), jwthelper.ParserUseJSONNumber(useJSONNumber))
+		if err != nil {
+			t.Fatalf("NewParser() error: %v", err)
+		}
+
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%v/json.Number %v", tt.name, useJSONNumber), func(t *testing.T) {
+				str, err := s.SignedString(jwthelper.NewClaim("n", tt.v))
+				if err != nil {
+					t.Fatalf("SignedString() error: %v", err)
+				}
+				claims, err := p.Parse(str)
+				if err != nil {
+					t.Fatalf("Parse() error: %v", err)
+				}
+				n, err := jwthelper.Claims(claims).Int64("n")
+				if !errors.Is(err, tt.err) || n != tt.want {
+					t.Errorf("Int64() = %v, %v, want %v, %v", n, err, tt.want, tt.err)
+				}
+			})
+		}
+	}
+}